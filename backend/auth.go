@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"strategy-analyst/internal/config"
+	"strategy-analyst/internal/middleware"
+)
+
+// newTokenVerifier builds the verifier selected by AUTH_PROVIDER
+func newTokenVerifier(cfg *config.Config) (middleware.TokenVerifier, error) {
+	switch cfg.AuthProvider {
+	case "firebase":
+		app, err := config.InitFirebase(cfg.FirebaseCredentialsPath)
+		if err != nil {
+			return nil, err
+		}
+		client, err := app.Auth(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Firebase Auth: %w", err)
+		}
+		return middleware.NewFirebaseVerifier(client), nil
+
+	case "oidc":
+		return middleware.NewJWTVerifier(middleware.JWTConfig{
+			Issuer:      cfg.OIDCIssuer,
+			Audience:    cfg.OIDCAudience,
+			JWKSURL:     cfg.OIDCJWKSURL,
+			JWKSFile:    cfg.OIDCJWKSFile,
+			UserIDClaim: cfg.OIDCUserIDClaim,
+			EmailClaim:  cfg.OIDCEmailClaim,
+		})
+
+	case "static":
+		log.Println("WARNING: static token authentication is enabled; use it for development only")
+		return middleware.NewStaticTokenVerifier(cfg.StaticAuthToken, cfg.StaticAuthUserID, cfg.StaticAuthEmail)
+	}
+
+	return nil, fmt.Errorf("unknown AUTH_PROVIDER %q: must be firebase, oidc or static", cfg.AuthProvider)
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"strings" // Used for string manipulation
 
 	firebase "firebase.google.com/go/v4" // Official firebase go SDK
@@ -17,6 +18,76 @@ type Config struct {
 	GCSBucket               string
 	GeminiAPIKey            string
 	FirebaseCredentialsPath string
+	// Characters of document content that fit in a single LLM prompt
+	ContextCharBudget int
+	// Optional JSON file with additional analysis templates
+	AnalysisTemplatesPath string
+	// Local poppler binary used to render PDF pages to PNG
+	PDFRendererPath string
+	// Lifetime of signed download URLs in seconds; 0 streams every download
+	// through the server instead
+	SignedURLTTLSeconds int
+	// Largest accepted upload in bytes; 0 disables the limit
+	MaxUploadBytes int64
+	// Largest file accepted through a resumable upload session, which is
+	// sent in parts and so is not bound by MaxUploadBytes; 0 disables the limit
+	MaxResumableUploadBytes int64
+	// Most files accepted in one upload request
+	MaxBatchFiles int
+	// Most entries unpacked from one ZIP or tar.gz archive
+	MaxArchiveEntries int
+	// Largest archive, and largest total uncompressed content, in bytes
+	MaxArchiveBytes int64
+	// Resumable upload sessions idle for longer than this are discarded
+	UploadSessionTTLHours int
+	// Deleted documents stay restorable from the trash for this many days
+	// before they are purged
+	TrashRetentionDays int
+	// Hours between storage reconciliation runs; 0 disables the scheduled job
+	StorageReconcileIntervalHours int
+	// Unreferenced objects younger than this many hours are left alone
+	StorageOrphanGraceHours int
+	// Whether scheduled reconciliation deletes orphans or only reports them
+	StorageReconcileDelete bool
+
+	// Per-user quotas; 0 means unlimited. Storage and documents count every
+	// document the user uploaded until it is purged, the others reset at the
+	// start of each calendar month (UTC).
+	QuotaStorageBytes        int64
+	QuotaDocuments           int64
+	QuotaPagesPerMonth       int64
+	QuotaLLMTokensPerMonth   int64
+	QuotaComparisonsPerMonth int64
+	// Optional JSON file with LLM prices per model, added to the built-in ones
+	LLMPricingPath string
+
+	// Rate limits per caller as "<requests>/<period>[:<burst>]": the default
+	// for routes without their own, and "<method> <path>=<limit>" entries
+	// separated by semicolons
+	RateLimitDefault string
+	RateLimitRoutes  string
+	// Where buckets are kept: memory (one instance) or postgres (shared)
+	RateLimitStore string
+	// Proxies whose X-Forwarded-For is believed, as comma-separated IP
+	// addresses and CIDR ranges. Empty trusts none.
+	TrustedProxies string
+
+	// Which tokens authenticate API requests: firebase, oidc or static
+	AuthProvider string
+	// For oidc: the expected issuer and audience (both required with a JWKS
+	// URL, either may be empty with a JWKS file), the
+	// JWKS to verify signatures with, from a URL or a local file, and the
+	// claims holding the user ID and email
+	OIDCIssuer      string
+	OIDCAudience    string
+	OIDCJWKSURL     string
+	OIDCJWKSFile    string
+	OIDCUserIDClaim string
+	OIDCEmailClaim  string
+	// For static (development only): the one accepted token and its user
+	StaticAuthToken  string
+	StaticAuthUserID string
+	StaticAuthEmail  string
 }
 
 // Load function to load configuration from environment variables or .env file
@@ -29,6 +100,46 @@ func Load() *Config {
 		GCSBucket:               getEnv("GCS_BUCKET", ""),
 		GeminiAPIKey:            getEnv("GEMINI_API_KEY", ""),
 		FirebaseCredentialsPath: getEnv("FIREBASE_CREDENTIALS_PATH", "firebase-credentials.json"),
+		ContextCharBudget:       getEnvPositiveInt("CONTEXT_CHAR_BUDGET", 200000),
+		AnalysisTemplatesPath:   getEnv("ANALYSIS_TEMPLATES_PATH", ""),
+		PDFRendererPath:         getEnv("PDF_RENDERER_PATH", "pdftoppm"),
+		SignedURLTTLSeconds:     getEnvInt("SIGNED_URL_TTL_SECONDS", 300),
+		MaxUploadBytes:          int64(getEnvInt("MAX_UPLOAD_BYTES", 32<<20)),
+		MaxResumableUploadBytes: int64(getEnvInt("MAX_RESUMABLE_UPLOAD_BYTES", 1<<30)),
+		UploadSessionTTLHours:   getEnvInt("UPLOAD_SESSION_TTL_HOURS", 24),
+		MaxBatchFiles:           getEnvInt("MAX_BATCH_FILES", 20),
+		MaxArchiveEntries:       getEnvInt("MAX_ARCHIVE_ENTRIES", 200),
+		MaxArchiveBytes:         int64(getEnvInt("MAX_ARCHIVE_BYTES", 256<<20)),
+		TrashRetentionDays:      getEnvInt("TRASH_RETENTION_DAYS", 30),
+
+		StorageReconcileIntervalHours: getEnvInt("STORAGE_RECONCILE_INTERVAL_HOURS", 24),
+		StorageOrphanGraceHours:       getEnvInt("STORAGE_ORPHAN_GRACE_HOURS", 24),
+		StorageReconcileDelete:        getEnv("STORAGE_RECONCILE_DELETE", "false") == "true",
+
+		QuotaStorageBytes:        int64(getEnvInt("QUOTA_STORAGE_BYTES", 0)),
+		QuotaDocuments:           int64(getEnvInt("QUOTA_DOCUMENTS", 0)),
+		QuotaPagesPerMonth:       int64(getEnvInt("QUOTA_PAGES_PER_MONTH", 0)),
+		QuotaLLMTokensPerMonth:   int64(getEnvInt("QUOTA_LLM_TOKENS_PER_MONTH", 0)),
+		QuotaComparisonsPerMonth: int64(getEnvInt("QUOTA_COMPARISONS_PER_MONTH", 0)),
+		LLMPricingPath:           getEnv("LLM_PRICING_PATH", ""),
+
+		RateLimitDefault: getEnv("RATE_LIMIT_DEFAULT", "300/1m"),
+		RateLimitRoutes: getEnv("RATE_LIMIT_ROUTES", "POST /api/documents/{id}/chat=20/1m;POST /api/collections/chat=20/1m;"+
+			"POST /api/documents/compare=5/1m;POST /api/documents/{id}/analyses=10/1m;POST /api/documents/{id}/reprocess=10/1m;"+
+			"GET /api/public/shares/{token}=60/1m"),
+		RateLimitStore: getEnv("RATE_LIMIT_STORE", "memory"),
+		TrustedProxies: getEnv("TRUSTED_PROXIES", ""),
+
+		AuthProvider:     getEnv("AUTH_PROVIDER", "firebase"),
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCAudience:     getEnv("OIDC_AUDIENCE", ""),
+		OIDCJWKSURL:      getEnv("OIDC_JWKS_URL", ""),
+		OIDCJWKSFile:     getEnv("OIDC_JWKS_FILE", ""),
+		OIDCUserIDClaim:  getEnv("OIDC_USER_ID_CLAIM", "sub"),
+		OIDCEmailClaim:   getEnv("OIDC_EMAIL_CLAIM", "email"),
+		StaticAuthToken:  getEnv("STATIC_AUTH_TOKEN", ""),
+		StaticAuthUserID: getEnv("STATIC_AUTH_USER_ID", "dev-user"),
+		StaticAuthEmail:  getEnv("STATIC_AUTH_EMAIL", "dev@example.com"),
 	}
 }
 
@@ -39,6 +150,31 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Warning: invalid integer for %s (%q), using default %d\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvPositiveInt is getEnvInt for settings where zero or less would
+// disable a feature by accident
+func getEnvPositiveInt(key string, defaultValue int) int {
+	value := getEnvInt(key, defaultValue)
+	if value <= 0 {
+		fmt.Printf("Warning: %s must be positive (%d), using default %d\n", key, value, defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
 func loadEnvFile() {
 	file, err := os.Open(".env")
 	if err != nil {
@@ -66,6 +66,349 @@ func Migrate(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_chat_history_user_id ON chat_history(user_id)`,
 		// Migration to allow NULL storage_path for existing tables
 		`ALTER TABLE documents ALTER COLUMN storage_path DROP NOT NULL`,
+		`CREATE TABLE IF NOT EXISTS document_summaries (
+			document_id VARCHAR(255) PRIMARY KEY,
+			executive_summary TEXT NOT NULL,
+			description TEXT NOT NULL,
+			key_entities JSONB NOT NULL DEFAULT '[]',
+			key_figures JSONB NOT NULL DEFAULT '[]',
+			suggested_questions JSONB NOT NULL DEFAULT '[]',
+			generated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS document_summary_nodes (
+			document_id VARCHAR(255) NOT NULL,
+			level INT NOT NULL,
+			group_index INT NOT NULL,
+			source_hash VARCHAR(64) NOT NULL,
+			content TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (document_id, level, group_index),
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE
+		)`,
+		// Summaries are kept per group size, so that callers with different
+		// budgets do not overwrite each other's groups. Rows from before
+		// group_chars existed cannot be matched and are dropped.
+		`ALTER TABLE document_summary_nodes ADD COLUMN IF NOT EXISTS group_chars INT NOT NULL DEFAULT 0`,
+		`DELETE FROM document_summary_nodes WHERE group_chars = 0`,
+		`ALTER TABLE document_summary_nodes DROP CONSTRAINT IF EXISTS document_summary_nodes_pkey`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_document_summary_nodes_key ON document_summary_nodes(document_id, level, group_chars, group_index)`,
+		`CREATE TABLE IF NOT EXISTS document_analyses (
+			id VARCHAR(255) PRIMARY KEY,
+			document_id VARCHAR(255) NOT NULL,
+			user_id VARCHAR(255) NOT NULL,
+			template_name VARCHAR(100) NOT NULL,
+			template_definition JSONB NOT NULL,
+			result JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_analyses_document_id ON document_analyses(document_id)`,
+		`CREATE TABLE IF NOT EXISTS document_entities (
+			id VARCHAR(255) PRIMARY KEY,
+			document_id VARCHAR(255) NOT NULL,
+			chunk_id VARCHAR(255),
+			name TEXT NOT NULL,
+			entity_type VARCHAR(20) NOT NULL CHECK (entity_type IN ('company', 'person', 'product', 'location')),
+			mentions INT NOT NULL DEFAULT 1,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (chunk_id) REFERENCES document_chunks(id) ON DELETE SET NULL
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_document_entities_unique ON document_entities(document_id, entity_type, LOWER(name))`,
+		`CREATE INDEX IF NOT EXISTS idx_document_entities_type ON document_entities(entity_type)`,
+		`CREATE TABLE IF NOT EXISTS document_metrics (
+			id VARCHAR(255) PRIMARY KEY,
+			document_id VARCHAR(255) NOT NULL,
+			chunk_id VARCHAR(255),
+			name TEXT NOT NULL,
+			value DOUBLE PRECISION NOT NULL,
+			value_text TEXT NOT NULL DEFAULT '',
+			unit VARCHAR(50) NOT NULL DEFAULT '',
+			period VARCHAR(100) NOT NULL DEFAULT '',
+			context TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (chunk_id) REFERENCES document_chunks(id) ON DELETE SET NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_metrics_document_id ON document_metrics(document_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_metrics_name ON document_metrics(LOWER(name))`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS title TEXT`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS author TEXT`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_created_at TIMESTAMP`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS pdf_modified_at TIMESTAMP`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS page_count INT`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS outline JSONB`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS is_encrypted BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS is_image_only BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS has_thumbnail BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE TABLE IF NOT EXISTS document_tables (
+			id VARCHAR(255) PRIMARY KEY,
+			document_id VARCHAR(255) NOT NULL,
+			chunk_id VARCHAR(255),
+			page_number INT NOT NULL,
+			table_index INT NOT NULL,
+			rows JSONB NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (chunk_id) REFERENCES document_chunks(id) ON DELETE SET NULL,
+			UNIQUE (document_id, table_index)
+		)`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS sha256 VARCHAR(64)`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS size_bytes BIGINT`,
+		`CREATE TABLE IF NOT EXISTS upload_sessions (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			file_name VARCHAR(255) NOT NULL,
+			total_size BIGINT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at)`,
+		`CREATE TABLE IF NOT EXISTS upload_parts (
+			session_id VARCHAR(255) NOT NULL,
+			byte_offset BIGINT NOT NULL,
+			size BIGINT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (session_id, byte_offset),
+			FOREIGN KEY (session_id) REFERENCES upload_sessions(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS blobs (
+			sha256 VARCHAR(64) PRIMARY KEY,
+			storage_path VARCHAR(255) NOT NULL,
+			size_bytes BIGINT NOT NULL,
+			ref_count INT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS folders (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			parent_id VARCHAR(255),
+			name VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (parent_id) REFERENCES folders(id) ON DELETE CASCADE
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_unique_name ON folders(user_id, COALESCE(parent_id, ''), LOWER(name))`,
+		`CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders(parent_id)`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS folder_id VARCHAR(255) REFERENCES folders(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_folder_id ON documents(folder_id)`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_unique_name ON tags(user_id, LOWER(name))`,
+		`CREATE TABLE IF NOT EXISTS document_tags (
+			document_id VARCHAR(255) NOT NULL,
+			tag_id VARCHAR(255) NOT NULL,
+			PRIMARY KEY (document_id, tag_id),
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_tags_tag_id ON document_tags(tag_id)`,
+		`CREATE TABLE IF NOT EXISTS collection_chat_history (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			scope JSONB NOT NULL,
+			scope_key VARCHAR(512) NOT NULL,
+			message_type VARCHAR(10) NOT NULL CHECK (message_type IN ('user', 'ai')),
+			message_content TEXT NOT NULL,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_collection_chat_history_scope ON collection_chat_history(user_id, scope_key)`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS display_title TEXT`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS description TEXT`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS custom_metadata JSONB NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_deleted_at ON documents(deleted_at) WHERE deleted_at IS NOT NULL`,
+		`CREATE TABLE IF NOT EXISTS pending_storage_deletions (
+			object_name TEXT PRIMARY KEY,
+			is_prefix BOOLEAN NOT NULL DEFAULT FALSE,
+			attempts INT NOT NULL DEFAULT 0,
+			last_error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_pending_storage_deletions_next_attempt ON pending_storage_deletions(next_attempt_at)`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS storage_missing BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE TABLE IF NOT EXISTS workspaces (
+			id VARCHAR(255) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			personal_for VARCHAR(255) UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+			created_by VARCHAR(255) REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id VARCHAR(255) NOT NULL,
+			user_id VARCHAR(255) NOT NULL,
+			role VARCHAR(20) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (workspace_id, user_id),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id)`,
+		// Existing users get a personal workspace owning their existing data
+		`INSERT INTO workspaces (id, name, personal_for, created_by, created_at, updated_at)
+			SELECT md5(random()::text || u.id)::uuid::text, 'Personal', u.id, u.id, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP FROM users u
+			ON CONFLICT (personal_for) DO NOTHING`,
+		`INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+			SELECT id, personal_for, 'owner', CURRENT_TIMESTAMP FROM workspaces WHERE personal_for IS NOT NULL
+			ON CONFLICT DO NOTHING`,
+		`ALTER TABLE documents ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(255) REFERENCES workspaces(id)`,
+		`UPDATE documents d SET workspace_id = w.id FROM workspaces w WHERE d.workspace_id IS NULL AND w.personal_for = d.user_id`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_workspace_id ON documents(workspace_id)`,
+		// Every document belongs to a workspace, and a workspace cannot be
+		// deleted while documents are in it: their files have to be released by
+		// the purger first. The application never deletes users; deleting one
+		// directly must purge their documents before their personal workspace.
+		`ALTER TABLE documents ALTER COLUMN workspace_id SET NOT NULL`,
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'documents'::regclass
+				AND conname = 'documents_workspace_id_fkey' AND confdeltype <> 'r') THEN
+				ALTER TABLE documents DROP CONSTRAINT documents_workspace_id_fkey;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'documents'::regclass
+				AND conname = 'documents_workspace_id_fkey') THEN
+				ALTER TABLE documents ADD CONSTRAINT documents_workspace_id_fkey
+					FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE RESTRICT;
+			END IF;
+		END $$`,
+		// Duplicates are looked up within a workspace
+		`DROP INDEX IF EXISTS idx_documents_sha256`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_workspace_sha256 ON documents(workspace_id, sha256)`,
+		`ALTER TABLE folders ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(255) REFERENCES workspaces(id) ON DELETE CASCADE`,
+		`UPDATE folders f SET workspace_id = w.id FROM workspaces w WHERE f.workspace_id IS NULL AND w.personal_for = f.user_id`,
+		`DROP INDEX IF EXISTS idx_folders_unique_name`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_workspace_name ON folders(workspace_id, COALESCE(parent_id, ''), LOWER(name))`,
+		`ALTER TABLE tags ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(255) REFERENCES workspaces(id) ON DELETE CASCADE`,
+		`UPDATE tags t SET workspace_id = w.id FROM workspaces w WHERE t.workspace_id IS NULL AND w.personal_for = t.user_id`,
+		`DROP INDEX IF EXISTS idx_tags_unique_name`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_workspace_name ON tags(workspace_id, LOWER(name))`,
+		`ALTER TABLE collection_chat_history ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(255) REFERENCES workspaces(id) ON DELETE CASCADE`,
+		`UPDATE collection_chat_history c SET workspace_id = w.id FROM workspaces w WHERE c.workspace_id IS NULL AND w.personal_for = c.user_id`,
+		`CREATE INDEX IF NOT EXISTS idx_collection_chat_history_workspace ON collection_chat_history(workspace_id, scope_key)`,
+		// Messages from before conversations were shared stay private to their author
+		`ALTER TABLE chat_history ADD COLUMN IF NOT EXISTS shared BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE upload_sessions ADD COLUMN IF NOT EXISTS workspace_id VARCHAR(255) REFERENCES workspaces(id) ON DELETE CASCADE`,
+		`UPDATE upload_sessions s SET workspace_id = w.id FROM workspaces w WHERE s.workspace_id IS NULL AND w.personal_for = s.user_id`,
+		// Every attempt at sending a part gets its own object; sessions being
+		// completed or aborted take no more parts
+		`ALTER TABLE upload_parts ADD COLUMN IF NOT EXISTS object_name VARCHAR(512)`,
+		`ALTER TABLE upload_sessions ADD COLUMN IF NOT EXISTS completing BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE TABLE IF NOT EXISTS document_shares (
+			document_id VARCHAR(255) NOT NULL,
+			user_id VARCHAR(255) NOT NULL,
+			permission VARCHAR(20) NOT NULL CHECK (permission IN ('view', 'chat')),
+			shared_by VARCHAR(255) REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (document_id, user_id),
+			FOREIGN KEY (document_id) REFERENCES documents(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_document_shares_user_id ON document_shares(user_id)`,
+		`CREATE TABLE IF NOT EXISTS share_links (
+			id VARCHAR(255) PRIMARY KEY,
+			document_id VARCHAR(255) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+			token_hash VARCHAR(64) NOT NULL UNIQUE,
+			message_ids TEXT[] NOT NULL DEFAULT '{}',
+			created_by VARCHAR(255) REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_links_document_id ON share_links(document_id)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(20) NOT NULL,
+			key_hash VARCHAR(64) NOT NULL UNIQUE,
+			scope VARCHAR(20) NOT NULL CHECK (scope IN ('read_only', 'chat', 'full')),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP,
+			revoked_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id)`,
+		// Monthly usage per user; storage and document counts are computed
+		// from the documents table instead
+		`CREATE TABLE IF NOT EXISTS usage_counters (
+			user_id VARCHAR(255) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			period DATE NOT NULL,
+			pages_processed BIGINT NOT NULL DEFAULT 0,
+			llm_input_tokens BIGINT NOT NULL DEFAULT 0,
+			llm_output_tokens BIGINT NOT NULL DEFAULT 0,
+			comparisons BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (user_id, period)
+		)`,
+		// One row per LLM call, priced when it was made. Calls outlive the
+		// documents and chat messages they link to, and their user's account.
+		`CREATE TABLE IF NOT EXISTS llm_calls (
+			id VARCHAR(255) PRIMARY KEY,
+			user_id VARCHAR(255) REFERENCES users(id) ON DELETE SET NULL,
+			workspace_id VARCHAR(255) REFERENCES workspaces(id) ON DELETE CASCADE,
+			document_ids TEXT[] NOT NULL DEFAULT '{}',
+			chat_message_id VARCHAR(255),
+			comparison_id VARCHAR(255),
+			operation VARCHAR(50) NOT NULL,
+			model VARCHAR(255) NOT NULL,
+			prompt_tokens INT NOT NULL DEFAULT 0,
+			completion_tokens INT NOT NULL DEFAULT 0,
+			total_tokens INT NOT NULL DEFAULT 0,
+			latency_ms INT NOT NULL DEFAULT 0,
+			cost_usd NUMERIC(18, 8),
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_calls_workspace ON llm_calls(workspace_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_calls_chat_message ON llm_calls(chat_message_id) WHERE chat_message_id IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_calls_comparison ON llm_calls(comparison_id) WHERE comparison_id IS NOT NULL`,
+		// Token buckets of the Postgres rate limit store. allowed reports
+		// whether the last request was let through, for RETURNING.
+		`CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+			key VARCHAR(512) PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			allowed BOOLEAN NOT NULL,
+			rate DOUBLE PRECISION NOT NULL,
+			burst DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// The audit log has no foreign keys so entries outlive what they
+		// describe, and a trigger rejects changes to written entries
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id VARCHAR(255) PRIMARY KEY,
+			occurred_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			actor_id VARCHAR(255),
+			actor_email VARCHAR(255),
+			api_key_id VARCHAR(255),
+			workspace_id VARCHAR(255),
+			action VARCHAR(100) NOT NULL,
+			target_type VARCHAR(50) NOT NULL,
+			target_id VARCHAR(255) NOT NULL,
+			ip VARCHAR(64) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			request_id VARCHAR(128) NOT NULL DEFAULT '',
+			details JSONB NOT NULL DEFAULT '{}'
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_workspace ON audit_events(workspace_id, occurred_at DESC, id DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id)`,
+		`CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_events is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`,
+		`CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+			FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only()`,
 	}
 
 	fmt.Println("Starting database migrations...")
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+	"strategy-analyst/internal/services"
+)
+
+func (h *Handlers) GetAnalysisTemplates(w http.ResponseWriter, r *http.Request) {
+	if h.analysisService == nil {
+		http.Error(w, "Analysis service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.analysisService.Templates())
+}
+
+func (h *Handlers) CreateAnalysis(w http.ResponseWriter, r *http.Request) {
+	if h.analysisService == nil {
+		http.Error(w, "Analysis service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	documentID := vars["id"]
+
+	var req models.CreateAnalysisRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Template) == "" {
+		http.Error(w, "Template is required", http.StatusBadRequest)
+		return
+	}
+
+	analysis, err := h.analysisService.CreateAnalysis(r.Context(), documentID, userID, req.Template)
+	if err != nil {
+		if strings.Contains(err.Error(), "unknown analysis template") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if writeForbidden(w, err) || writeQuotaError(w, err) {
+			return
+		} else if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "still being processed") {
+			http.Error(w, err.Error(), http.StatusAccepted)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to create analysis: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.audit(r, "document.analyze", "document", documentID, map[string]string{
+		"analysis_id": analysis.ID,
+		"template":    req.Template,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(analysis)
+}
+
+func (h *Handlers) GetAnalyses(w http.ResponseWriter, r *http.Request) {
+	if h.analysisService == nil {
+		http.Error(w, "Analysis service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	documentID := vars["id"]
+
+	analyses, err := h.analysisService.GetAnalyses(r.Context(), documentID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get analyses: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analyses)
+}
+
+func (h *Handlers) GetAnalysis(w http.ResponseWriter, r *http.Request) {
+	if h.analysisService == nil {
+		http.Error(w, "Analysis service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	analysis, err := h.analysisService.GetAnalysis(r.Context(), vars["id"], vars["analysisId"], userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Analysis not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get analysis: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analysis)
+}
+
+// ExportAnalysis downloads an analysis as JSON (default) or Markdown (?format=markdown)
+func (h *Handlers) ExportAnalysis(w http.ResponseWriter, r *http.Request) {
+	if h.analysisService == nil {
+		http.Error(w, "Analysis service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	documentID := vars["id"]
+
+	analysis, err := h.analysisService.GetAnalysis(r.Context(), documentID, vars["analysisId"], userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Analysis not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get analysis: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	document, err := h.documentService.GetDocument(r.Context(), documentID, userID)
+	if err != nil {
+		http.Error(w, "Document not found", http.StatusNotFound)
+		return
+	}
+
+	baseName := fmt.Sprintf("%s-%s", analysis.Template.Name, analysis.ID)
+	auditDetails := map[string]string{"analysis_id": analysis.ID}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		h.audit(r, "document.export_analysis", "document", documentID, auditDetails)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, baseName))
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(analysis)
+	case "markdown", "md":
+		h.audit(r, "document.export_analysis", "document", documentID, auditDetails)
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, baseName))
+		w.Write([]byte(services.RenderAnalysisMarkdown(analysis, document.FileName)))
+	default:
+		http.Error(w, "Unsupported export format. Use json or markdown", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+)
+
+// GetAPIKeys lists the user's API keys without their secrets:
+// GET /api-keys
+func (h *Handlers) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if h.apiKeyService == nil {
+		http.Error(w, "API key service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyService.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get API keys")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// CreateAPIKey creates an API key; the response is the only time the key is
+// shown: POST /api-keys {"name", "scope"}
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if h.apiKeyService == nil {
+		http.Error(w, "API key service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.apiKeyService.CreateAPIKey(r.Context(), userID, req)
+	if err != nil {
+		writeOrganizationError(w, err, "create API key")
+		return
+	}
+
+	// Keys belong to a user rather than a workspace, so the event has none
+	h.audit(r, "api_key.create", "api_key", key.ID, map[string]string{
+		"name":  key.Name,
+		"scope": string(key.Scope),
+	})
+
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// RevokeAPIKey disables an API key: DELETE /api-keys/{id}
+func (h *Handlers) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if h.apiKeyService == nil {
+		http.Error(w, "API key service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	keyID := mux.Vars(r)["id"]
+	if err := h.apiKeyService.RevokeAPIKey(r.Context(), keyID, userID); err != nil {
+		writeOrganizationError(w, err, "revoke API key")
+		return
+	}
+
+	h.audit(r, "api_key.revoke", "api_key", keyID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
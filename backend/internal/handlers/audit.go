@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"strategy-analyst/internal/middleware"
+	"strategy-analyst/internal/models"
+)
+
+// audit records an action taken by the current request. The actor, API key,
+// client address and request ID come from the request; failures are logged
+// and never fail the request itself.
+func (h *Handlers) audit(r *http.Request, action, targetType, targetID string, details map[string]string) {
+	h.auditIn(r, "", action, targetType, targetID, details)
+}
+
+// auditIn is audit for targets whose workspace cannot be looked up
+// afterwards, such as a purged document or a deleted workspace
+func (h *Handlers) auditIn(r *http.Request, workspaceID, action, targetType, targetID string, details map[string]string) {
+	if h.auditService == nil {
+		return
+	}
+
+	ctx := r.Context()
+	event := &models.AuditEvent{
+		ActorID:     optionalString(middleware.GetUserID(ctx)),
+		APIKeyID:    optionalString(middleware.GetAPIKeyID(ctx)),
+		WorkspaceID: optionalString(workspaceID),
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		IP:          middleware.ClientIP(r),
+		UserAgent:   r.UserAgent(),
+		RequestID:   middleware.GetRequestID(ctx),
+		Details:     details,
+	}
+	if err := h.auditService.Record(ctx, event); err != nil {
+		fmt.Printf("Failed to record audit event %s on %s %s: %v\n", action, targetType, targetID, err)
+	}
+}
+
+// uploadAuditDetails describes an uploaded file for the audit log
+func uploadAuditDetails(result models.BatchUploadResult) map[string]string {
+	details := map[string]string{"file_name": result.FileName}
+	if result.Archive != "" {
+		details["archive"] = result.Archive
+	}
+	if result.Reused {
+		details["reused"] = "true"
+	}
+	return details
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// parseAuditFilter reads ?actor_id=&action=&target_type=&target_id=&since=&until=
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		ActorID:    query.Get("actor_id"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+	}
+
+	for param, target := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := query.Get(param); raw != "" {
+			value, err := parseDateParam(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value", param)
+			}
+			*target = &value
+		}
+	}
+
+	return filter, nil
+}
+
+// GetAuditEvents lists the workspace's audit log, newest first; owners only:
+// GET /audit?actor_id=&action=&target_type=&target_id=&since=&until=&limit=&cursor=
+func (h *Handlers) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if h.auditService == nil {
+		http.Error(w, "Audit service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	events, err := h.auditService.ListEvents(r.Context(), userID, workspaceID, filter, page)
+	if err != nil {
+		writeOrganizationError(w, err, "get audit events")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, events)
+}
+
+var auditCSVHeader = []string{"id", "occurred_at", "actor_id", "actor_email", "api_key_id", "workspace_id",
+	"action", "target_type", "target_id", "ip", "user_agent", "request_id", "details"}
+
+// ExportAuditEvents streams every matching entry of the workspace's audit
+// log, oldest first; owners only. Takes the filters of GetAuditEvents:
+// GET /audit/export?format=csv|jsonl
+func (h *Handlers) ExportAuditEvents(w http.ResponseWriter, r *http.Request) {
+	if h.auditService == nil {
+		http.Error(w, "Audit service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		http.Error(w, "Unsupported export format. Use csv or jsonl", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Headers are only sent once access is checked, so a refusal can still
+	// be answered with an error status
+	started := false
+	encoder := json.NewEncoder(w)
+	writer := csv.NewWriter(w)
+	begin := func() {
+		started = true
+		fileName := fmt.Sprintf("audit-%s-%s.%s", workspaceID, time.Now().UTC().Format("20060102"), format)
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		w.Header().Set("Cache-Control", "no-store")
+		if format == "csv" {
+			writer.Write(auditCSVHeader)
+		}
+	}
+
+	exported := 0
+	err = h.auditService.ExportEvents(r.Context(), userID, workspaceID, filter, func(event *models.AuditEvent) error {
+		if !started {
+			begin()
+		}
+		exported++
+		if format == "jsonl" {
+			return encoder.Encode(event)
+		}
+		details, _ := json.Marshal(event.Details)
+		writer.Write(csvSafe([]string{event.ID, event.OccurredAt.UTC().Format(time.RFC3339Nano), derefString(event.ActorID),
+			derefString(event.ActorEmail), derefString(event.APIKeyID), derefString(event.WorkspaceID), event.Action,
+			event.TargetType, event.TargetID, event.IP, event.UserAgent, event.RequestID, string(details)}))
+		return writer.Error()
+	})
+	if err != nil && !started {
+		writeOrganizationError(w, err, "export audit events")
+		return
+	}
+	if !started {
+		begin()
+	}
+	writer.Flush()
+	if err != nil {
+		// Too late for an error status; the download is cut short instead
+		fmt.Printf("Failed to export audit events of workspace %s: %v\n", workspaceID, err)
+		return
+	}
+
+	h.auditIn(r, workspaceID, "audit.export", "workspace", workspaceID, map[string]string{
+		"format": format,
+		"events": fmt.Sprint(exported),
+	})
+}
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// csvSafe keeps spreadsheet programs from evaluating cells, such as a user
+// agent, that start like a formula
+func csvSafe(record []string) []string {
+	for i, cell := range record {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			record[i] = "'" + cell
+		}
+	}
+	return record
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+	"strategy-analyst/internal/services"
+)
+
+// parseCollectionScope reads ?folder_id=&include_subfolders=&tag=&tag=
+func parseCollectionScope(query url.Values) (models.CollectionScope, error) {
+	scope := models.CollectionScope{FolderID: query.Get("folder_id")}
+
+	if raw := query.Get("include_subfolders"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return scope, fmt.Errorf("invalid include_subfolders value")
+		}
+		scope.IncludeSubfolders = value
+	}
+
+	for _, tag := range query["tag"] {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			scope.Tags = append(scope.Tags, tag)
+		}
+	}
+
+	return scope, nil
+}
+
+// writeOrganizationError maps folder and tag errors to HTTP statuses
+func writeOrganizationError(w http.ResponseWriter, err error, action string) {
+	if writeQuotaError(w, err) {
+		return
+	}
+	message := err.Error()
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, message, http.StatusForbidden)
+	case strings.Contains(message, "not found"):
+		http.Error(w, strings.ToUpper(message[:1])+message[1:], http.StatusNotFound)
+	case strings.Contains(message, "already exists"), strings.Contains(message, "cannot be moved"):
+		http.Error(w, message, http.StatusConflict)
+	case strings.Contains(message, "required"), strings.Contains(message, "invalid"):
+		http.Error(w, message, http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to %s: %v", action, err), http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// GetFolders lists the folders of the workspace: GET /folders
+func (h *Handlers) GetFolders(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	folders, err := h.documentService.GetFolders(r.Context(), userID, workspaceID)
+	if err != nil {
+		writeOrganizationError(w, err, "get folders")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, folders)
+}
+
+// CreateFolder creates a folder: POST /folders {"name", "parent_id"}
+func (h *Handlers) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+
+	var req models.CreateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	folder, err := h.documentService.CreateFolder(r.Context(), userID, workspaceID, req.Name, req.ParentID)
+	if err != nil {
+		writeOrganizationError(w, err, "create folder")
+		return
+	}
+
+	h.audit(r, "folder.create", "folder", folder.ID, map[string]string{"name": folder.Name})
+
+	writeJSON(w, http.StatusCreated, folder)
+}
+
+// UpdateFolder renames and/or moves a folder: PATCH /folders/{id}
+// {"name", "parent_id"}; a null parent_id moves it to the top level
+func (h *Handlers) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateFolderRequest
+	if raw, ok := fields["name"]; ok {
+		if err := json.Unmarshal(raw, &req.Name); err != nil {
+			http.Error(w, "Invalid name", http.StatusBadRequest)
+			return
+		}
+	}
+	if raw, ok := fields["parent_id"]; ok {
+		req.Move = true
+		if err := json.Unmarshal(raw, &req.ParentID); err != nil {
+			http.Error(w, "Invalid parent_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	folder, err := h.documentService.UpdateFolder(r.Context(), mux.Vars(r)["id"], userID, req)
+	if err != nil {
+		writeOrganizationError(w, err, "update folder")
+		return
+	}
+
+	h.audit(r, "folder.update", "folder", folder.ID, map[string]string{"name": folder.Name})
+
+	writeJSON(w, http.StatusOK, folder)
+}
+
+// DeleteFolder deletes a folder and its subfolders; their documents move to
+// the top level: DELETE /folders/{id}
+func (h *Handlers) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	folder, err := h.documentService.DeleteFolder(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "delete folder")
+		return
+	}
+
+	h.auditIn(r, folder.WorkspaceID, "folder.delete", "folder", folder.ID, map[string]string{"name": folder.Name})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTags lists the tags of the workspace: GET /tags
+func (h *Handlers) GetTags(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	tags, err := h.documentService.GetTags(r.Context(), userID, workspaceID)
+	if err != nil {
+		writeOrganizationError(w, err, "get tags")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// CreateTag creates a tag: POST /tags {"name"}
+func (h *Handlers) CreateTag(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	tag, err := h.documentService.CreateTag(r.Context(), userID, workspaceID, req.Name)
+	if err != nil {
+		writeOrganizationError(w, err, "create tag")
+		return
+	}
+
+	h.audit(r, "tag.create", "tag", tag.ID, map[string]string{"name": tag.Name})
+
+	writeJSON(w, http.StatusCreated, tag)
+}
+
+// RenameTag renames a tag: PATCH /tags/{id} {"name"}
+func (h *Handlers) RenameTag(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.documentService.RenameTag(r.Context(), mux.Vars(r)["id"], userID, req.Name)
+	if err != nil {
+		writeOrganizationError(w, err, "rename tag")
+		return
+	}
+
+	h.audit(r, "tag.rename", "tag", tag.ID, map[string]string{"name": tag.Name})
+
+	writeJSON(w, http.StatusOK, tag)
+}
+
+// DeleteTag removes a tag from all documents: DELETE /tags/{id}
+func (h *Handlers) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	tag, err := h.documentService.DeleteTag(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "delete tag")
+		return
+	}
+
+	h.auditIn(r, tag.WorkspaceID, "tag.delete", "tag", tag.ID, map[string]string{"name": tag.Name})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetDocumentFolder files a document: PUT /documents/{id}/folder
+// {"folder_id"}; null takes it out of any folder
+func (h *Handlers) SetDocumentFolder(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetDocumentFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	document, err := h.documentService.SetDocumentFolder(r.Context(), mux.Vars(r)["id"], userID, req.FolderID)
+	if err != nil {
+		writeOrganizationError(w, err, "move document")
+		return
+	}
+
+	h.audit(r, "document.move", "document", document.ID, map[string]string{"folder_id": derefString(req.FolderID)})
+
+	writeJSON(w, http.StatusOK, document)
+}
+
+// SetDocumentTags replaces a document's tags: PUT /documents/{id}/tags
+// {"tags": ["name", ...]}; unknown tags are created
+func (h *Handlers) SetDocumentTags(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetDocumentTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	document, err := h.documentService.SetDocumentTags(r.Context(), mux.Vars(r)["id"], userID, req.Tags)
+	if err != nil {
+		writeOrganizationError(w, err, "tag document")
+		return
+	}
+
+	h.audit(r, "document.tag", "document", document.ID, map[string]string{"tags": strings.Join(req.Tags, ",")})
+
+	writeJSON(w, http.StatusOK, document)
+}
+
+// GetCollectionChatHistory returns the conversation with a collection:
+// GET /collections/chat?folder_id=&include_subfolders=&tag=
+func (h *Handlers) GetCollectionChatHistory(w http.ResponseWriter, r *http.Request) {
+	if h.chatService == nil {
+		http.Error(w, "Chat service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	scope, err := parseCollectionScope(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	messages, err := h.chatService.GetCollectionChatHistory(r.Context(), userID, workspaceID, scope)
+	if err != nil {
+		writeOrganizationError(w, err, "get chat history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messages)
+}
+
+// SendCollectionMessage asks a question across a folder or tag:
+// POST /collections/chat {"collection": {...}, "message"}
+func (h *Handlers) SendCollectionMessage(w http.ResponseWriter, r *http.Request) {
+	if h.chatService == nil {
+		http.Error(w, "Chat service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CollectionChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	response, err := h.chatService.SendCollectionMessage(r.Context(), userID, workspaceID, req.Collection, req.Message)
+	if err != nil {
+		message := err.Error()
+		switch {
+		case strings.Contains(message, "still being processed"):
+			http.Error(w, message, http.StatusAccepted)
+		case strings.Contains(message, "no documents"), strings.Contains(message, "at most"), strings.Contains(message, "cannot be empty"):
+			http.Error(w, message, http.StatusBadRequest)
+		default:
+			writeOrganizationError(w, err, "send message")
+		}
+		return
+	}
+
+	h.audit(r, "collection.chat", "workspace", workspaceID, map[string]string{
+		"folder_id": req.Collection.FolderID,
+		"tags":      strings.Join(req.Collection.Tags, ","),
+	})
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/services"
+)
+
+// DownloadDocument returns the original upload: GET /documents/{id}/download.
+// When signed URLs are enabled and the storage credentials can sign, the
+// client is redirected to a short-lived URL; ?mode=stream (or any signing
+// failure) streams the file through the server with Range support.
+func (h *Handlers) DownloadDocument(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	docID := mux.Vars(r)["id"]
+
+	if h.config.DownloadURLTTL > 0 && r.URL.Query().Get("mode") != "stream" {
+		signedURL, err := h.documentService.SignedDownloadURL(r.Context(), docID, userID, h.config.DownloadURLTTL)
+		if err == nil {
+			h.audit(r, "document.download", "document", docID, map[string]string{"mode": "signed_url"})
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, signedURL, http.StatusFound)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+			return
+		}
+		// Credentials without signing support fall back to streaming
+		fmt.Printf("Warning: signed download URL unavailable for document %s: %v\n", docID, err)
+	}
+
+	doc, reader, err := h.documentService.OpenDocumentFile(r.Context(), docID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrObjectNotFound) {
+			http.Error(w, "Document file not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to download document: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer reader.Close()
+
+	// Range requests resuming a download are not recorded again
+	if rangeHeader := r.Header.Get("Range"); rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-") {
+		h.audit(r, "document.download", "document", docID, map[string]string{"mode": "stream"})
+	}
+
+	w.Header().Set("Content-Type", services.DocumentContentType(doc))
+	w.Header().Set("Content-Disposition", services.ContentDisposition("attachment", doc.FileName))
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	// Large files take longer to send than an ordinary request
+	extendDeadlines(w, reader.Size)
+
+	// ServeContent handles Range, If-Range and If-Modified-Since
+	http.ServeContent(w, r, doc.FileName, reader.Updated, reader)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+)
+
+// GetEntities lists extracted entities. Under /documents/{id}/entities it is
+// scoped to one document; under /entities it spans the documents of the workspace.
+// Filters: ?type=company|person|product|location&q=<name substring>
+func (h *Handlers) GetEntities(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.EntityFilter{
+		DocumentID: mux.Vars(r)["id"],
+		EntityType: query.Get("type"),
+		Query:      query.Get("q"),
+	}
+	if filter.DocumentID == "" {
+		filter.DocumentID = query.Get("document_id")
+	}
+
+	workspaceID, ok := h.factsWorkspace(w, r, filter.DocumentID, userID)
+	if !ok {
+		return
+	}
+
+	entities, err := h.documentService.GetEntities(r.Context(), userID, workspaceID, filter)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get entities: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entities)
+}
+
+// GetMetrics lists extracted metrics, scoped like GetEntities.
+// Filters: ?name=revenue&unit=USD&period=2023&min=<value>&max=<value>
+func (h *Handlers) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.MetricFilter{
+		DocumentID: mux.Vars(r)["id"],
+		Name:       query.Get("name"),
+		Unit:       query.Get("unit"),
+		Period:     query.Get("period"),
+	}
+	if filter.DocumentID == "" {
+		filter.DocumentID = query.Get("document_id")
+	}
+
+	for param, target := range map[string]**float64{"min": &filter.MinValue, "max": &filter.MaxValue} {
+		raw := query.Get(param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s value", param), http.StatusBadRequest)
+			return
+		}
+		*target = &value
+	}
+
+	workspaceID, ok := h.factsWorkspace(w, r, filter.DocumentID, userID)
+	if !ok {
+		return
+	}
+
+	metrics, err := h.documentService.GetMetrics(r.Context(), userID, workspaceID, filter)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
+// factsWorkspace returns the workspace to list entities or metrics from. A
+// given documentID must be visible to the user, so per-document listings 404
+// instead of returning an empty list, and selects the document's workspace.
+func (h *Handlers) factsWorkspace(w http.ResponseWriter, r *http.Request, documentID, userID string) (string, bool) {
+	if documentID == "" {
+		return h.requestWorkspace(w, r, userID)
+	}
+
+	document, err := h.documentService.GetDocument(r.Context(), documentID, userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get document: %v", err), http.StatusInternalServerError)
+		}
+		return "", false
+	}
+
+	return document.WorkspaceID, true
+}
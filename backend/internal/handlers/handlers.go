@@ -4,13 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"firebase.google.com/go/v4/auth"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 
 	"strategy-analyst/internal/middleware"
 	"strategy-analyst/internal/models"
@@ -18,18 +23,49 @@ import (
 )
 
 type Handlers struct {
-	db              *sql.DB
-	authClient      *auth.Client
-	documentService *services.DocumentService
-	chatService     *services.ChatService
+	db               *sql.DB
+	documentService  *services.DocumentService
+	chatService      *services.ChatService
+	analysisService  *services.AnalysisService
+	uploadService    *services.UploadService
+	workspaceService *services.WorkspaceService
+	apiKeyService    *services.APIKeyService
+	auditService     *services.AuditService
+	usageService     *services.UsageService
+	config           Config
 }
 
-func New(db *sql.DB, authClient *auth.Client, documentService *services.DocumentService, chatService *services.ChatService) *Handlers {
+// Config holds the request limits and behaviour switches of the handlers
+type Config struct {
+	// Lifetime of signed download URLs; zero streams downloads instead
+	DownloadURLTTL time.Duration
+	// Largest accepted upload in bytes; zero disables the limit
+	MaxUploadBytes int64
+	// Largest file accepted through a resumable upload session; zero
+	// disables the limit
+	MaxResumableUploadBytes int64
+	// Most document parts accepted in one upload request
+	MaxBatchFiles int
+	// Most file entries unpacked from one archive
+	MaxArchiveEntries int
+	// Largest archive, and largest total uncompressed content, in bytes
+	MaxArchiveBytes int64
+	// How long deleted documents stay in the trash before they are purged
+	TrashRetention time.Duration
+}
+
+func New(db *sql.DB, documentService *services.DocumentService, chatService *services.ChatService, analysisService *services.AnalysisService, uploadService *services.UploadService, workspaceService *services.WorkspaceService, apiKeyService *services.APIKeyService, auditService *services.AuditService, usageService *services.UsageService, config Config) *Handlers {
 	return &Handlers{
-		db:              db,
-		authClient:      authClient,
-		documentService: documentService,
-		chatService:     chatService,
+		db:               db,
+		documentService:  documentService,
+		chatService:      chatService,
+		analysisService:  analysisService,
+		uploadService:    uploadService,
+		workspaceService: workspaceService,
+		apiKeyService:    apiKeyService,
+		auditService:     auditService,
+		usageService:     usageService,
+		config:           config,
 	}
 }
 
@@ -49,7 +85,7 @@ func (h *Handlers) GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	user, err := h.getOrCreateUser(r.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to get or create user profile for %s: %v\n", userID, err)
-		http.Error(w, "Failed to get user profile", http.StatusInternalServerError)
+		writeUserError(w, err, "Failed to get user profile")
 		return
 	}
 
@@ -73,12 +109,44 @@ func (h *Handlers) GetDocuments(w http.ResponseWriter, r *http.Request) {
 	_, err := h.getOrCreateUser(r.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to ensure user exists before fetching documents for %s: %v\n", userID, err)
-		http.Error(w, "Failed to validate user", http.StatusInternalServerError)
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+
+	filter, err := parseDocumentFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	documents, err := h.documentService.GetDocuments(r.Context(), userID)
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	// Callers that do not page get the bare array of every document, as
+	// before paging was added
+	var documents interface{}
+	if page.Limit == 0 && page.Cursor == "" {
+		documents, err = h.documentService.ListAllDocuments(r.Context(), userID, workspaceID, filter, page)
+	} else {
+		documents, err = h.documentService.ListDocuments(r.Context(), userID, workspaceID, filter, page)
+	}
 	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Workspace not found", http.StatusNotFound)
+			return
+		}
+		if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		fmt.Printf("Failed to get documents for user %s: %v\n", userID, err)
 		http.Error(w, fmt.Sprintf("Failed to get documents: %v", err), http.StatusInternalServerError)
 		return
@@ -104,60 +172,98 @@ func (h *Handlers) UploadDocument(w http.ResponseWriter, r *http.Request) {
 	_, err := h.getOrCreateUser(r.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to ensure user exists before document upload for %s: %v\n", userID, err)
-		http.Error(w, "Failed to validate user", http.StatusInternalServerError)
+		writeUserError(w, err, "Failed to validate user")
 		return
 	}
 
-	// Parse multipart form
-	err = r.ParseMultipartForm(32 << 20) // 32MB max
-	if err != nil {
-		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
 		return
 	}
 
-	file, header, err := r.FormFile("document")
-	if err != nil {
-		http.Error(w, "No file provided", http.StatusBadRequest)
-		return
+	// Every part is capped individually; this bounds the request as a whole
+	maxPartBytes := max(h.config.MaxUploadBytes, h.config.MaxArchiveBytes)
+	bodyBytes := r.ContentLength
+	if maxPartBytes > 0 && h.config.MaxBatchFiles > 0 {
+		maxBodyBytes := maxPartBytes*int64(h.config.MaxBatchFiles) + multipartOverheadBytes
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		if bodyBytes < 0 || bodyBytes > maxBodyBytes {
+			bodyBytes = maxBodyBytes
+		}
 	}
-	defer file.Close()
+	// The files are streamed to storage while the request is read
+	extendDeadlines(w, bodyBytes)
 
-	// Validate file type
-	ext := strings.ToLower(filepath.Ext(header.Filename))
-	if ext != ".pdf" && ext != ".txt" {
-		http.Error(w, "Only PDF and TXT files are supported", http.StatusBadRequest)
+	// Stream the multipart body part by part instead of buffering the form
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
 
-	// Create document
-	document, err := h.documentService.CreateDocument(r.Context(), userID, header.Filename, file)
-	if err != nil {
-		fmt.Printf("Document upload failed for user %s, file %s: %v\n", userID, header.Filename, err)
+	reuse := wantsReuse(r)
+	var results []models.BatchUploadResult
+	var single *singleUpload
+	parts := 0
+
+	for {
+		part, err := nextFilePart(reader, "document")
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if isTooLarge(err) {
+				results = append(results, failedUpload("", err, h.config))
+			} else {
+				results = append(results, failedUpload("", fmt.Errorf("failed to parse form: %w", err), h.config))
+			}
+			break
+		}
+
+		parts++
+		if h.config.MaxBatchFiles > 0 && parts > h.config.MaxBatchFiles {
+			part.Close()
+			results = append(results, models.BatchUploadResult{
+				FileName: part.FileName(),
+				Status:   models.UploadStatusSkipped,
+				Error:    fmt.Sprintf("At most %d files can be uploaded at once", h.config.MaxBatchFiles),
+			})
+			continue
+		}
 
-		// Provide more specific error messages based on the error type
-		errorMsg := "Failed to upload document"
-		if strings.Contains(err.Error(), "storage service is not initialized") {
-			errorMsg = "File storage service is currently unavailable. Please try again later or contact support."
-		} else if strings.Contains(err.Error(), "failed to upload file to storage") {
-			errorMsg = "Failed to upload file to storage. Please check your file and try again."
-		} else if strings.Contains(err.Error(), "failed to create document record") {
-			errorMsg = "Failed to save document information. Please try again."
+		fileName := part.FileName()
+		if services.IsArchive(fileName) {
+			results = append(results, h.uploadArchive(r.Context(), userID, workspaceID, fileName, part, reuse)...)
+			part.Close()
+			continue
 		}
 
-		http.Error(w, errorMsg, http.StatusInternalServerError)
+		document, err := h.uploadFile(r.Context(), userID, workspaceID, fileName, part, reuse)
+		part.Close()
+		if parts == 1 {
+			single = &singleUpload{fileName: fileName, document: document, err: err}
+		}
+		results = append(results, uploadResult(fileName, document, err, h.config))
+	}
+
+	if len(results) == 0 {
+		http.Error(w, "No file provided", http.StatusBadRequest)
 		return
 	}
 
-	response := models.UploadResponse{
-		DocumentID: document.ID,
-		Message:    "Document uploaded successfully. Processing started.",
+	for _, result := range results {
+		if result.DocumentID != "" {
+			h.audit(r, "document.upload", "document", result.DocumentID, uploadAuditDetails(result))
+		}
 	}
 
-	fmt.Printf("Document uploaded successfully for user %s: %s (ID: %s)\n", userID, header.Filename, document.ID)
+	// A single plain file keeps the original response shape
+	if single != nil && len(results) == 1 {
+		h.writeSingleUpload(w, userID, single)
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	writeBatchUpload(w, results)
 }
 
 func (h *Handlers) GetDocument(w http.ResponseWriter, r *http.Request) {
@@ -185,10 +291,114 @@ func (h *Handlers) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Attach the generated summary if processing has produced one
+	summary, err := h.documentService.GetDocumentSummary(r.Context(), documentID)
+	if err != nil {
+		fmt.Printf("Failed to get summary for document %s: %v\n", documentID, err)
+	}
+	document.Summary = summary
+
+	h.audit(r, "document.view", "document", documentID, nil)
+
+	w.Header().Set("ETag", documentETag(document))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(document)
 }
 
+// UpdateDocument edits a document's display title, description, custom
+// metadata, folder and tags: PATCH /documents/{id}. The If-Match header must
+// carry the ETag of GET /documents/{id} (or "*"), and a stale one is refused
+// with 412 so that concurrent edits are not lost.
+func (h *Handlers) UpdateDocument(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		http.Error(w, "If-Match header with the document's ETag is required", http.StatusPreconditionRequired)
+		return
+	}
+	version, err := parseIfMatch(ifMatch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// A null display_title or description clears it like an empty string
+	var req models.UpdateDocumentRequest
+	for name, target := range map[string]interface{}{
+		"display_title":   &req.DisplayTitle,
+		"description":     &req.Description,
+		"custom_metadata": &req.CustomMetadata,
+		"folder_id":       &req.FolderID,
+		"tags":            &req.Tags,
+	} {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			http.Error(w, "Invalid "+name, http.StatusBadRequest)
+			return
+		}
+	}
+	empty := ""
+	if _, ok := fields["display_title"]; ok && req.DisplayTitle == nil {
+		req.DisplayTitle = &empty
+	}
+	if _, ok := fields["description"]; ok && req.Description == nil {
+		req.Description = &empty
+	}
+	_, req.MoveFolder = fields["folder_id"]
+
+	document, err := h.documentService.UpdateDocument(r.Context(), mux.Vars(r)["id"], userID, version, req)
+	if err != nil {
+		if errors.Is(err, services.ErrVersionMismatch) {
+			http.Error(w, "Document has been modified; reload it and retry", http.StatusPreconditionFailed)
+			return
+		}
+		writeOrganizationError(w, err, "update document")
+		return
+	}
+
+	h.audit(r, "document.update", "document", document.ID, map[string]string{"fields": strings.Join(slices.Sorted(maps.Keys(fields)), ",")})
+
+	w.Header().Set("ETag", documentETag(document))
+	writeJSON(w, http.StatusOK, document)
+}
+
+func documentETag(doc *models.Document) string {
+	return fmt.Sprintf(`"v%d"`, doc.Version)
+}
+
+// parseIfMatch returns the document version named by an If-Match header, or
+// 0 for "*"
+func parseIfMatch(header string) (int, error) {
+	if header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.Atoi(strings.TrimPrefix(tag, "v"))
+	if err != nil || version <= 0 || !strings.HasPrefix(tag, "v") {
+		return 0, fmt.Errorf("If-Match header is not a document ETag")
+	}
+	return version, nil
+}
+
 func (h *Handlers) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 	// Check if document service is available
 	if h.documentService == nil {
@@ -206,6 +416,9 @@ func (h *Handlers) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 
 	err := h.documentService.DeleteDocument(r.Context(), documentID, userID)
 	if err != nil {
+		if writeForbidden(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Document not found", http.StatusNotFound)
 		} else {
@@ -214,6 +427,8 @@ func (h *Handlers) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.audit(r, "document.delete", "document", documentID, nil)
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -234,6 +449,9 @@ func (h *Handlers) ReprocessDocument(w http.ResponseWriter, r *http.Request) {
 
 	err := h.documentService.ReprocessDocument(r.Context(), documentID, userID)
 	if err != nil {
+		if writeForbidden(w, err) || writeQuotaError(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Document not found", http.StatusNotFound)
 		} else {
@@ -242,6 +460,8 @@ func (h *Handlers) ReprocessDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.audit(r, "document.reprocess", "document", documentID, nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Document reprocessing started"})
 }
@@ -262,14 +482,14 @@ func (h *Handlers) GetDocumentStatus(w http.ResponseWriter, r *http.Request) {
 	_, err := h.getOrCreateUser(r.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to ensure user exists for document status check %s: %v\n", userID, err)
-		http.Error(w, "Failed to validate user", http.StatusInternalServerError)
+		writeUserError(w, err, "Failed to validate user")
 		return
 	}
 
 	vars := mux.Vars(r)
 	documentID := vars["id"]
 
-	// Verify the user owns this document first
+	// Verify the user may view this document first
 	_, err = h.documentService.GetDocument(r.Context(), documentID, userID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
@@ -292,10 +512,16 @@ func (h *Handlers) GetDocumentStatus(w http.ResponseWriter, r *http.Request) {
 		status = "ready"
 	}
 
+	summary, err := h.documentService.GetDocumentSummary(r.Context(), documentID)
+	if err != nil {
+		fmt.Printf("Failed to get summary for document %s: %v\n", documentID, err)
+	}
+
 	response := map[string]interface{}{
 		"status":         status,
 		"chunks_count":   len(chunks),
 		"ready_for_chat": len(chunks) > 0,
+		"summary_ready":  summary != nil,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -318,24 +544,40 @@ func (h *Handlers) GetChatHistory(w http.ResponseWriter, r *http.Request) {
 	_, err := h.getOrCreateUser(r.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to ensure user exists for chat history %s: %v\n", userID, err)
-		http.Error(w, "Failed to validate user", http.StatusInternalServerError)
+		writeUserError(w, err, "Failed to validate user")
 		return
 	}
 
 	vars := mux.Vars(r)
 	documentID := vars["id"]
 
-	messages, err := h.chatService.GetChatHistory(r.Context(), documentID, userID)
+	page, err := parsePageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Like the document list, callers that do not page get a bare array
+	var messages interface{}
+	if page.Limit == 0 && page.Cursor == "" {
+		messages, err = h.chatService.GetAllChatHistory(r.Context(), documentID, userID, page)
+	} else {
+		messages, err = h.chatService.GetChatHistory(r.Context(), documentID, userID, page)
+	}
 	if err != nil {
 		fmt.Printf("Failed to get chat history for user %s, document %s: %v\n", userID, documentID, err)
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Document not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to get chat history: %v", err), http.StatusInternalServerError)
 		}
 		return
 	}
 
+	h.audit(r, "document.chat_history", "document", documentID, nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(messages)
 }
@@ -368,6 +610,9 @@ func (h *Handlers) SendMessage(w http.ResponseWriter, r *http.Request) {
 
 	response, err := h.chatService.SendMessage(r.Context(), documentID, userID, req.Message)
 	if err != nil {
+		if writeForbidden(w, err) || writeQuotaError(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Document not found", http.StatusNotFound)
 		} else if strings.Contains(err.Error(), "still being processed") {
@@ -378,6 +623,8 @@ func (h *Handlers) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.audit(r, "document.chat", "document", documentID, nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -404,6 +651,26 @@ func (h *Handlers) CompareDocuments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A collection stands in for an explicit list of documents
+	if len(req.DocumentIDs) == 0 && req.Collection != nil {
+		workspaceID, ok := h.requestWorkspace(w, r, userID)
+		if !ok {
+			return
+		}
+		documents, err := h.documentService.GetCollectionDocuments(r.Context(), userID, workspaceID, *req.Collection)
+		if err != nil {
+			writeOrganizationError(w, err, "get collection")
+			return
+		}
+		if len(documents) > 5 {
+			http.Error(w, fmt.Sprintf("Collection has %d documents; maximum 5 documents can be compared at once", len(documents)), http.StatusBadRequest)
+			return
+		}
+		for _, doc := range documents {
+			req.DocumentIDs = append(req.DocumentIDs, doc.ID)
+		}
+	}
+
 	// Validate request
 	if len(req.DocumentIDs) < 2 {
 		http.Error(w, "At least 2 documents are required for comparison", http.StatusBadRequest)
@@ -423,8 +690,13 @@ func (h *Handlers) CompareDocuments(w http.ResponseWriter, r *http.Request) {
 	// Get documents and their content
 	documents, documentsChunks, err := h.documentService.CompareDocuments(r.Context(), req.DocumentIDs, userID)
 	if err != nil {
+		if writeForbidden(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "One or more documents not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "invalid") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to prepare documents for comparison: %v", err), http.StatusInternalServerError)
 		}
@@ -432,12 +704,24 @@ func (h *Handlers) CompareDocuments(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate AI comparison
-	comparison, err := h.chatService.CompareDocuments(r.Context(), documents, documentsChunks, req.CompareType)
+	comparison, err := h.chatService.CompareDocuments(r.Context(), userID, documents, documentsChunks, req.CompareType)
 	if err != nil {
+		if writeQuotaError(w, err) {
+			return
+		}
 		http.Error(w, fmt.Sprintf("Failed to generate comparison: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// One event per document, so each shows up in its own audit trail
+	for _, documentID := range req.DocumentIDs {
+		others := slices.DeleteFunc(slices.Clone(req.DocumentIDs), func(id string) bool { return id == documentID })
+		h.audit(r, "document.compare", "document", documentID, map[string]string{
+			"compare_type":  req.CompareType,
+			"compared_with": strings.Join(others, ","),
+		})
+	}
+
 	response := models.CompareDocumentsResponse{
 		Comparison: *comparison,
 		Message:    "Document comparison completed successfully",
@@ -447,6 +731,99 @@ func (h *Handlers) CompareDocuments(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// parseDocumentFilter reads the metadata filters of GET /api/documents:
+// title, author, min_pages, max_pages, encrypted, image_only, created_after
+// and created_before (RFC 3339 or YYYY-MM-DD)
+func parseDocumentFilter(r *http.Request) (models.DocumentFilter, error) {
+	query := r.URL.Query()
+	filter := models.DocumentFilter{
+		Title:  query.Get("title"),
+		Author: query.Get("author"),
+	}
+
+	for param, target := range map[string]**int{"min_pages": &filter.MinPages, "max_pages": &filter.MaxPages} {
+		if raw := query.Get(param); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value", param)
+			}
+			*target = &value
+		}
+	}
+
+	for param, target := range map[string]**bool{"encrypted": &filter.Encrypted, "image_only": &filter.ImageOnly} {
+		if raw := query.Get(param); raw != "" {
+			value, err := strconv.ParseBool(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value", param)
+			}
+			*target = &value
+		}
+	}
+
+	for param, target := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if raw := query.Get(param); raw != "" {
+			value, err := parseDateParam(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value", param)
+			}
+			*target = &value
+		}
+	}
+
+	filter.Status = query.Get("status")
+	if filter.Status != "" && filter.Status != "ready" && filter.Status != "processing" {
+		return filter, fmt.Errorf("invalid status value")
+	}
+	filter.FileType = strings.TrimPrefix(query.Get("file_type"), ".")
+	filter.Name = query.Get("name")
+
+	for param, target := range map[string]**time.Time{"uploaded_after": &filter.UploadedAfter, "uploaded_before": &filter.UploadedBefore} {
+		if raw := query.Get(param); raw != "" {
+			value, err := parseDateParam(raw)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s value", param)
+			}
+			*target = &value
+		}
+	}
+
+	scope, err := parseCollectionScope(query)
+	if err != nil {
+		return filter, err
+	}
+	filter.Collection = scope
+
+	return filter, nil
+}
+
+// parsePageRequest reads ?limit=&cursor=&sort=&order=
+func parsePageRequest(r *http.Request) (models.PageRequest, error) {
+	query := r.URL.Query()
+	page := models.PageRequest{
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Order:  query.Get("order"),
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return page, fmt.Errorf("invalid limit value")
+		}
+		page.Limit = limit
+	}
+
+	return page, nil
+}
+
+func parseDateParam(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
+
 // ensureAuthenticated checks authentication and ensures user exists in database
 func (h *Handlers) ensureAuthenticated(w http.ResponseWriter, r *http.Request) (string, bool) {
 	userID := middleware.GetUserID(r.Context())
@@ -458,17 +835,25 @@ func (h *Handlers) ensureAuthenticated(w http.ResponseWriter, r *http.Request) (
 	return userID, true
 }
 
+// errEmailInUse is returned by getOrCreateUser when another account, such as
+// one from a different sign-in provider, already has the caller's email
+var errEmailInUse = errors.New("this email address already belongs to another account; sign in with that account instead")
+
+// writeUserError answers a request whose user could not be loaded or created
+func writeUserError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, errEmailInUse) {
+		http.Error(w, errEmailInUse.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
 func (h *Handlers) getOrCreateUser(ctx context.Context, userID string) (*models.User, error) {
 	// Check if database is available
 	if h.db == nil {
 		return nil, fmt.Errorf("database is not available")
 	}
 
-	// Check if auth client is available
-	if h.authClient == nil {
-		return nil, fmt.Errorf("authentication service is not available")
-	}
-
 	// Validate userID to prevent SQL injection or empty queries
 	if strings.TrimSpace(userID) == "" {
 		return nil, fmt.Errorf("userID cannot be empty")
@@ -508,30 +893,27 @@ func (h *Handlers) getOrCreateUser(ctx context.Context, userID string) (*models.
 		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
 
-	// User doesn't exist, get email from Firebase and create
+	// User doesn't exist, create it with the email from the token's claims
 	fmt.Printf("User %s not found in database, creating new user\n", userID)
-	userRecord, err := h.authClient.GetUser(ctx, userID)
-	if err != nil {
-		fmt.Printf("Failed to get user %s from Firebase: %v\n", userID, err)
-		return nil, fmt.Errorf("failed to get user from Firebase: %w", err)
-	}
 
-	// Sanitize email - ensure it's valid
-	email := userRecord.Email
+	// users.email is unique, so callers without a usable email get a
+	// placeholder of their own under the reserved .invalid domain
+	placeholder := userID + "@users.invalid"
+	email := middleware.GetUserEmail(ctx)
 	if email == "" {
-		email = "unknown@example.com"
+		email = placeholder
 	}
 
 	// Check for suspicious content that might cause SQL parsing issues
 	if strings.Contains(email, ".pdf") || strings.Contains(email, "Resume") {
 		fmt.Printf("WARNING: Email contains suspicious content, sanitizing: '%s'\n", email)
-		email = "sanitized@example.com"
+		email = placeholder
 	}
 
 	// Additional validation: ensure email doesn't contain special characters that could cause SQL issues
 	if strings.Contains(email, "'") || strings.Contains(email, "\"") || strings.Contains(email, ";") {
 		fmt.Printf("WARNING: Email contains potentially harmful characters, sanitizing: '%s'\n", email)
-		email = "sanitized@example.com"
+		email = placeholder
 	}
 
 	fmt.Printf("Creating user with ID: %s, Email: %s\n", userID, email)
@@ -547,6 +929,11 @@ func (h *Handlers) getOrCreateUser(ctx context.Context, userID string) (*models.
 	row = h.db.QueryRowContext(ctx, upsertQuery, userID, email)
 	newUser := &models.User{}
 	err = row.Scan(&newUser.ID, &newUser.Email, &newUser.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
+		fmt.Printf("User %s signed in with the email of another account\n", userID)
+		return nil, errEmailInUse
+	}
 	if err != nil {
 		fmt.Printf("Failed to upsert user %s in database: %v\n", userID, err)
 		return nil, fmt.Errorf("failed to create or update user: %w", err)
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GetPageImage serves a rendered PDF page as PNG: GET /documents/{id}/pages/{n}/image?width=
+func (h *Handlers) GetPageImage(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil || page < 1 {
+		http.Error(w, "Invalid page number", http.StatusBadRequest)
+		return
+	}
+
+	width := 0
+	if raw := r.URL.Query().Get("width"); raw != "" {
+		width, err = strconv.Atoi(raw)
+		if err != nil || width < 1 {
+			http.Error(w, "Invalid width", http.StatusBadRequest)
+			return
+		}
+	}
+
+	image, err := h.documentService.GetPageImage(r.Context(), vars["id"], userID, page, width)
+	if err != nil {
+		if strings.Contains(err.Error(), "page") && strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Page not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "only available for PDF") {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "not available") {
+			http.Error(w, "Page rendering is currently unavailable", http.StatusServiceUnavailable)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to render page: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.audit(r, "document.page_image", "document", vars["id"], map[string]string{"page": vars["page"]})
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(image)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+)
+
+// GetDocumentShares lists the users a document is shared with:
+// GET /documents/{id}/shares
+func (h *Handlers) GetDocumentShares(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := h.documentService.GetDocumentShares(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get shares")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, shares)
+}
+
+// ShareDocument shares a document with a user by email:
+// POST /documents/{id}/shares {"email", "permission"}
+func (h *Handlers) ShareDocument(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.ShareDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	share, err := h.documentService.ShareDocument(r.Context(), mux.Vars(r)["id"], userID, req)
+	if err != nil {
+		writeOrganizationError(w, err, "share document")
+		return
+	}
+
+	h.audit(r, "document.share", "document", share.DocumentID, map[string]string{
+		"user_id":    share.UserID,
+		"permission": string(share.Permission),
+	})
+
+	writeJSON(w, http.StatusOK, share)
+}
+
+// RevokeDocumentShare removes a user's access to a document, or lets the user
+// give up a document shared with them: DELETE /documents/{id}/shares/{userId}
+func (h *Handlers) RevokeDocumentShare(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := h.documentService.RevokeDocumentShare(r.Context(), vars["id"], userID, vars["userId"]); err != nil {
+		writeOrganizationError(w, err, "revoke share")
+		return
+	}
+
+	h.audit(r, "document.unshare", "document", vars["id"], map[string]string{"user_id": vars["userId"]})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedDocuments lists the documents other users shared with the user:
+// GET /shared
+func (h *Handlers) GetSharedDocuments(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	documents, err := h.documentService.GetSharedDocuments(r.Context(), userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get shared documents")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, documents)
+}
+
+// GetShareLinks lists a document's share links:
+// GET /documents/{id}/share-links
+func (h *Handlers) GetShareLinks(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := h.documentService.GetShareLinks(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get share links")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, links)
+}
+
+// CreateShareLink creates a public read-only link to a document; the
+// response is the only time its token is shown:
+// POST /documents/{id}/share-links {"expires_in_hours", "message_ids"}
+func (h *Handlers) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateShareLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.documentService.CreateShareLink(r.Context(), mux.Vars(r)["id"], userID, req)
+	if err != nil {
+		writeOrganizationError(w, err, "create share link")
+		return
+	}
+
+	h.audit(r, "share_link.create", "share_link", link.ID, map[string]string{
+		"document_id": mux.Vars(r)["id"],
+		"expires_at":  link.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// RevokeShareLink disables a share link:
+// DELETE /documents/{id}/share-links/{linkId}
+func (h *Handlers) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := h.documentService.RevokeShareLink(r.Context(), vars["id"], vars["linkId"], userID); err != nil {
+		writeOrganizationError(w, err, "revoke share link")
+		return
+	}
+
+	h.audit(r, "share_link.revoke", "share_link", vars["linkId"], map[string]string{"document_id": vars["id"]})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPublicShare shows a document's summary and shared messages to anyone
+// holding a valid share link. It is served without authentication:
+// GET /api/public/shares/{token}
+func (h *Handlers) GetPublicShare(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	share, err := h.documentService.GetPublicShare(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		writeOrganizationError(w, err, "get shared document")
+		return
+	}
+
+	// Viewers of a link are anonymous; the event names the link instead
+	h.audit(r, "share_link.view", "share_link", share.LinkID, map[string]string{"document_id": share.DocumentID})
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	writeJSON(w, http.StatusOK, share)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func (h *Handlers) GetDocumentTables(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tables, err := h.documentService.GetDocumentTables(r.Context(), vars["id"], userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Document not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get tables: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tables)
+}
+
+// DownloadTableCSV streams a detected table as a CSV file
+func (h *Handlers) DownloadTableCSV(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	table, err := h.documentService.GetDocumentTable(r.Context(), vars["id"], vars["tableId"], userID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.Error(w, "Table not found", http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Failed to get table: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.audit(r, "document.table_download", "document", vars["id"], map[string]string{"table_id": table.ID})
+
+	fileName := fmt.Sprintf("table-%d-page-%d.csv", table.TableIndex+1, table.PageNumber)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+
+	writer := csv.NewWriter(w)
+	writer.Write(table.Columns)
+	writer.WriteAll(table.Rows)
+	if err := writer.Error(); err != nil {
+		fmt.Printf("Failed to write CSV for table %s: %v\n", table.ID, err)
+	}
+}
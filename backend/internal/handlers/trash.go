@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetTrash lists the deleted documents of the workspace with the time each
+// will be purged: GET /trash
+func (h *Handlers) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	documents, err := h.documentService.ListTrash(r.Context(), userID, workspaceID)
+	if err != nil {
+		writeOrganizationError(w, err, "list trash")
+		return
+	}
+
+	for _, doc := range documents {
+		if doc.DeletedAt != nil {
+			purgeAt := doc.DeletedAt.Add(h.config.TrashRetention)
+			doc.PurgeAt = &purgeAt
+		}
+	}
+
+	writeJSON(w, http.StatusOK, documents)
+}
+
+// RestoreDocument moves a document out of the trash:
+// POST /trash/{id}/restore
+func (h *Handlers) RestoreDocument(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	document, err := h.documentService.RestoreDocument(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "restore document")
+		return
+	}
+
+	h.audit(r, "document.restore", "document", document.ID, nil)
+
+	w.Header().Set("ETag", documentETag(document))
+	writeJSON(w, http.StatusOK, document)
+}
+
+// PurgeDocument permanently deletes a document from the trash without
+// waiting for the retention period: DELETE /trash/{id}
+func (h *Handlers) PurgeDocument(w http.ResponseWriter, r *http.Request) {
+	if h.documentService == nil {
+		http.Error(w, "Document service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	document, err := h.documentService.PurgeDocument(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "purge document")
+		return
+	}
+
+	h.auditIn(r, document.WorkspaceID, "document.purge", "document", document.ID, map[string]string{"file_name": document.FileName})
+
+	w.WriteHeader(http.StatusNoContent)
+}
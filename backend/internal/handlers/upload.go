@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"strategy-analyst/internal/models"
+	"strategy-analyst/internal/services"
+)
+
+// errUnsupportedType marks files that are neither documents nor archives
+var errUnsupportedType = errors.New("only PDF and TXT files are supported")
+
+func isSupportedDocument(fileName string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return ext == ".pdf" || ext == ".txt"
+}
+
+// uploadFile validates the type of a single file and creates a document
+func (h *Handlers) uploadFile(ctx context.Context, userID, workspaceID, fileName string, content io.Reader, reuse bool) (*models.Document, error) {
+	if !isSupportedDocument(fileName) {
+		return nil, errUnsupportedType
+	}
+	return h.documentService.CreateDocument(ctx, userID, workspaceID, fileName, services.LimitUpload(content, h.config.MaxUploadBytes), reuse)
+}
+
+// uploadArchive creates one document per supported entry of a ZIP or tar.gz
+// archive. Failing entries are reported without stopping the others.
+func (h *Handlers) uploadArchive(ctx context.Context, userID, workspaceID, archiveName string, content io.Reader, reuse bool) []models.BatchUploadResult {
+	var results []models.BatchUploadResult
+
+	limits := services.ArchiveLimits{
+		MaxEntries:    h.config.MaxArchiveEntries,
+		MaxEntryBytes: h.config.MaxUploadBytes,
+		MaxTotalBytes: h.config.MaxArchiveBytes,
+	}
+
+	err := services.WalkArchive(archiveName, services.LimitUpload(content, h.config.MaxArchiveBytes), limits, func(entry services.ArchiveEntry) {
+		// Documents are named after the file; the folder path is kept in the result
+		fileName := path.Base(entry.Name)
+
+		var result models.BatchUploadResult
+		switch {
+		case entry.Err != nil:
+			result = failedUpload(fileName, entry.Err, h.config)
+		case !isSupportedDocument(fileName):
+			result = uploadResult(fileName, nil, errUnsupportedType, h.config)
+		default:
+			document, err := h.documentService.CreateDocument(ctx, userID, workspaceID, fileName, entry.Content, reuse)
+			if err != nil {
+				fmt.Printf("Document upload failed for user %s, file %s in %s: %v\n", userID, entry.Name, archiveName, err)
+			}
+			result = uploadResult(fileName, document, err, h.config)
+		}
+
+		result.Archive = archiveName
+		result.Path = entry.Name
+		results = append(results, result)
+	})
+	if err != nil {
+		result := failedUpload(archiveName, err, h.config)
+		if errors.Is(err, services.ErrArchiveLimit) {
+			result.Error = fmt.Sprintf("Archive extraction stopped: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// uploadResult turns the outcome of one file into its batch result
+func uploadResult(fileName string, document *models.Document, err error, config Config) models.BatchUploadResult {
+	if errors.Is(err, errUnsupportedType) {
+		return models.BatchUploadResult{
+			FileName: fileName,
+			Status:   models.UploadStatusSkipped,
+			Error:    "Only PDF and TXT files are supported",
+		}
+	}
+	if err != nil {
+		return failedUpload(fileName, err, config)
+	}
+
+	response := newUploadResponse(document)
+	return models.BatchUploadResult{
+		FileName:    fileName,
+		Status:      models.UploadStatusCreated,
+		DocumentID:  document.ID,
+		DuplicateOf: response.DuplicateOf,
+		Reused:      response.Reused,
+	}
+}
+
+func failedUpload(fileName string, err error, config Config) models.BatchUploadResult {
+	_, message := uploadErrorResponse(err, config)
+	return models.BatchUploadResult{
+		FileName: fileName,
+		Status:   models.UploadStatusFailed,
+		Error:    message,
+	}
+}
+
+// uploadErrorResponse maps a document creation error to a status and a
+// message that is safe to show to the user
+func uploadErrorResponse(err error, config Config) (int, string) {
+	if isTooLarge(err) {
+		return http.StatusRequestEntityTooLarge, uploadTooLargeMessage(config.MaxUploadBytes)
+	}
+	if errors.Is(err, errUnsupportedType) {
+		return http.StatusBadRequest, "Only PDF and TXT files are supported"
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		return http.StatusForbidden, err.Error()
+	}
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaStatus(quotaErr), quotaErr.Error()
+	}
+	if err.Error() == "workspace not found" {
+		return http.StatusNotFound, "Workspace not found"
+	}
+
+	// Provide more specific error messages based on the error type
+	errorMsg := "Failed to upload document"
+	if strings.Contains(err.Error(), "storage service is not initialized") {
+		errorMsg = "File storage service is currently unavailable. Please try again later or contact support."
+	} else if strings.Contains(err.Error(), "failed to upload file to storage") {
+		errorMsg = "Failed to upload file to storage. Please check your file and try again."
+	} else if strings.Contains(err.Error(), "failed to create document record") {
+		errorMsg = "Failed to save document information. Please try again."
+	} else if errors.Is(err, services.ErrInvalidArchive) {
+		return http.StatusBadRequest, "The file is not a valid ZIP or tar.gz archive"
+	} else if errors.Is(err, services.ErrUnsafeEntryPath) || errors.Is(err, services.ErrCompressionRatio) ||
+		errors.Is(err, services.ErrArchiveLimit) {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	return http.StatusInternalServerError, errorMsg
+}
+
+// singleUpload is a request that carried exactly one plain file
+type singleUpload struct {
+	fileName string
+	document *models.Document
+	err      error
+}
+
+func (h *Handlers) writeSingleUpload(w http.ResponseWriter, userID string, upload *singleUpload) {
+	if upload.err != nil {
+		fmt.Printf("Document upload failed for user %s, file %s: %v\n", userID, upload.fileName, upload.err)
+		if writeQuotaError(w, upload.err) {
+			return
+		}
+		status, message := uploadErrorResponse(upload.err, h.config)
+		http.Error(w, message, status)
+		return
+	}
+
+	fmt.Printf("Document uploaded successfully for user %s: %s (ID: %s)\n", userID, upload.fileName, upload.document.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newUploadResponse(upload.document))
+}
+
+// writeBatchUpload reports every file. The status is 201 when all files were
+// created, 207 when only some were, and 400 when none were.
+func writeBatchUpload(w http.ResponseWriter, results []models.BatchUploadResult) {
+	response := models.BatchUploadResponse{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case models.UploadStatusCreated:
+			response.Created++
+		case models.UploadStatusFailed:
+			response.Failed++
+		case models.UploadStatusSkipped:
+			response.Skipped++
+		}
+	}
+
+	status := http.StatusCreated
+	if response.Created == 0 {
+		status = http.StatusBadRequest
+	} else if response.Failed > 0 || response.Skipped > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// Room for multipart boundaries, part headers and small form fields on top of
+// the file itself when capping the request body
+const multipartOverheadBytes = 1 << 20
+
+// RequestTimeout is how long the server gives a request to be read and
+// answered. Handlers that move files extend it with extendDeadlines.
+const RequestTimeout = 30 * time.Second
+
+// The slowest transfer, in bytes per second, that extendDeadlines allows for
+const minTransferRate = 256 << 10
+
+// extendDeadlines gives a request that moves size bytes through the server
+// RequestTimeout plus the time they take at minTransferRate to be read and
+// answered. A negative size, for bodies of unknown and unlimited length,
+// removes the deadlines.
+func extendDeadlines(w http.ResponseWriter, size int64) {
+	var deadline time.Time
+	if size >= 0 {
+		deadline = time.Now().Add(RequestTimeout + time.Duration(size/minTransferRate)*time.Second)
+	}
+	controller := http.NewResponseController(w)
+	for _, err := range []error{controller.SetReadDeadline(deadline), controller.SetWriteDeadline(deadline)} {
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			fmt.Printf("Failed to extend request deadline: %v\n", err)
+		}
+	}
+}
+
+// nextFilePart advances the multipart reader to the first file part sent
+// under fieldName, skipping any other fields
+func nextFilePart(reader *multipart.Reader, fieldName string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == fieldName && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// isTooLarge reports whether an upload failed because it exceeded either the
+// file limit or the request body limit
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.Is(err, services.ErrFileTooLarge) || errors.As(err, &maxBytesErr)
+}
+
+// wantsReuse reports whether the client accepts reusing the processed data of
+// an identical document it uploaded before (?reuse=true)
+func wantsReuse(r *http.Request) bool {
+	reuse, _ := strconv.ParseBool(r.URL.Query().Get("reuse"))
+	return reuse
+}
+
+func newUploadResponse(document *models.Document) models.UploadResponse {
+	response := models.UploadResponse{
+		DocumentID:  document.ID,
+		Message:     "Document uploaded successfully. Processing started.",
+		DuplicateOf: document.DuplicateOf,
+		Reused:      document.ReusedProcessing,
+	}
+	if document.ReusedProcessing {
+		response.Message = "Document uploaded successfully. Reusing the processed content of an identical document."
+	} else if document.DuplicateOf != nil {
+		response.Message = "Document uploaded successfully. Processing started. An identical document was already processed; upload with ?reuse=true to reuse it."
+	}
+	return response
+}
+
+func uploadTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("File is too large. The maximum upload size is %d MB.", limit>>20)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+	"strategy-analyst/internal/services"
+)
+
+// CreateUploadSession starts a resumable upload: POST /uploads
+func (h *Handlers) CreateUploadSession(w http.ResponseWriter, r *http.Request) {
+	if h.uploadService == nil {
+		http.Error(w, "Upload service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		fmt.Printf("Failed to ensure user exists before upload session for %s: %v\n", userID, err)
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+
+	var req models.CreateUploadSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	session, err := h.uploadService.CreateSession(r.Context(), userID, workspaceID, req.FileName, req.Size)
+	if err != nil {
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+
+	h.auditIn(r, session.WorkspaceID, "upload_session.create", "upload_session", session.ID, map[string]string{
+		"file_name": session.FileName,
+		"size":      strconv.FormatInt(session.Size, 10),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// GetUploadSession reports the byte ranges received so far, which is what a
+// client resumes from: GET /uploads/{id}
+func (h *Handlers) GetUploadSession(w http.ResponseWriter, r *http.Request) {
+	if h.uploadService == nil {
+		http.Error(w, "Upload service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := h.uploadService.GetSession(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// UploadPart stores the request body as the part starting at the given byte
+// offset: PUT /uploads/{id}/parts/{offset}
+func (h *Handlers) UploadPart(w http.ResponseWriter, r *http.Request) {
+	if h.uploadService == nil {
+		http.Error(w, "Upload service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	offset, err := strconv.ParseInt(vars["offset"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	partBytes := int64(services.MaxUploadPartBytes)
+	if r.ContentLength >= 0 {
+		partBytes = min(r.ContentLength, partBytes)
+	}
+	extendDeadlines(w, partBytes)
+
+	session, err := h.uploadService.AppendPart(r.Context(), vars["id"], userID, offset, r.Body)
+	if err != nil {
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// CompleteUploadSession assembles the parts and creates the document:
+// POST /uploads/{id}/complete?reuse=true
+func (h *Handlers) CompleteUploadSession(w http.ResponseWriter, r *http.Request) {
+	if h.uploadService == nil {
+		http.Error(w, "Upload service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	session, err := h.uploadService.GetSession(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+	// Every part is read back from storage and stored again as the document
+	extendDeadlines(w, session.Size)
+
+	document, err := h.uploadService.CompleteSession(r.Context(), session.ID, userID, wantsReuse(r))
+	if err != nil {
+		fmt.Printf("Completing upload session failed for user %s: %v\n", userID, err)
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+
+	h.audit(r, "document.upload", "document", document.ID, map[string]string{
+		"file_name":      document.FileName,
+		"upload_session": mux.Vars(r)["id"],
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newUploadResponse(document))
+}
+
+// AbortUploadSession discards an upload: DELETE /uploads/{id}
+func (h *Handlers) AbortUploadSession(w http.ResponseWriter, r *http.Request) {
+	if h.uploadService == nil {
+		http.Error(w, "Upload service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	// Read first: the session's workspace is gone from the database afterwards
+	session, err := h.uploadService.GetSession(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+	if err := h.uploadService.AbortSession(r.Context(), session.ID, userID); err != nil {
+		writeUploadError(w, err, h.config.MaxResumableUploadBytes)
+		return
+	}
+
+	h.auditIn(r, session.WorkspaceID, "upload_session.abort", "upload_session", session.ID, map[string]string{
+		"file_name": session.FileName,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeUploadError(w http.ResponseWriter, err error, maxUploadBytes int64) {
+	if writeQuotaError(w, err) {
+		return
+	}
+	message := err.Error()
+	switch {
+	case isTooLarge(err):
+		http.Error(w, uploadTooLargeMessage(maxUploadBytes), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, message, http.StatusForbidden)
+	case message == "workspace not found":
+		http.Error(w, "Workspace not found", http.StatusNotFound)
+	case strings.Contains(message, "not found"):
+		http.Error(w, "Upload session not found", http.StatusNotFound)
+	case strings.Contains(message, "overlaps"), strings.Contains(message, "incomplete"), strings.Contains(message, "being completed"):
+		http.Error(w, message, http.StatusConflict)
+	case strings.Contains(message, "outside the upload"), strings.Contains(message, "is empty"),
+		strings.Contains(message, "supported"), strings.Contains(message, "required"), strings.Contains(message, "must be positive"):
+		http.Error(w, message, http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("Upload failed: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"strategy-analyst/internal/services"
+)
+
+// quotaStatus is the status for a quota error: 429 for monthly quotas, which
+// reset on their own, and 402 for storage and documents, which only free up
+// when documents are purged
+func quotaStatus(quotaErr *services.QuotaError) int {
+	if quotaErr.ResetsAt != nil {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusPaymentRequired
+}
+
+// writeQuotaError answers with the quota a request ran into, telling clients
+// of monthly quotas when to retry. It reports whether err was a quota error.
+func writeQuotaError(w http.ResponseWriter, err error) bool {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	if quotaErr.ResetsAt != nil {
+		seconds := int64(math.Ceil(time.Until(*quotaErr.ResetsAt).Seconds()))
+		w.Header().Set("Retry-After", fmt.Sprint(max(seconds, 1)))
+	}
+	http.Error(w, quotaErr.Error(), quotaStatus(quotaErr))
+	return true
+}
+
+// GetUsage reports the user's consumption this month against their quotas;
+// a limit of null means unlimited: GET /usage
+func (h *Handlers) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if h.usageService == nil {
+		http.Error(w, "Usage service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := h.usageService.GetUsage(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get usage: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// GetLLMUsageReport totals the workspace's LLM calls, their tokens, latency
+// and cost by user, document or day; members other than owners only see
+// their own calls: GET /usage/llm?group_by=user|document|day&since=&until=
+func (h *Handlers) GetLLMUsageReport(w http.ResponseWriter, r *http.Request) {
+	if h.usageService == nil {
+		http.Error(w, "Usage service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var since, until *time.Time
+	for param, target := range map[string]**time.Time{"since": &since, "until": &until} {
+		if raw := query.Get(param); raw != "" {
+			value, err := parseDateParam(raw)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s value", param), http.StatusBadRequest)
+				return
+			}
+			*target = &value
+		}
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	report, err := h.usageService.GetLLMUsageReport(r.Context(), userID, workspaceID, query.Get("group_by"), since, until)
+	if err != nil {
+		writeOrganizationError(w, err, "get LLM usage")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// GetLLMCalls lists the LLM calls behind one chat message or comparison:
+// GET /usage/llm/calls?chat_message_id=|comparison_id=
+func (h *Handlers) GetLLMCalls(w http.ResponseWriter, r *http.Request) {
+	if h.usageService == nil {
+		http.Error(w, "Usage service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	workspaceID, ok := h.requestWorkspace(w, r, userID)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	calls, err := h.usageService.ListLLMCalls(r.Context(), userID, workspaceID, query.Get("chat_message_id"), query.Get("comparison_id"))
+	if err != nil {
+		writeOrganizationError(w, err, "get LLM calls")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, calls)
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"strategy-analyst/internal/models"
+	"strategy-analyst/internal/services"
+)
+
+// requestWorkspace returns the workspace a request operates on: the
+// X-Workspace-ID header or workspace_id query parameter, or else the user's
+// personal workspace. Membership is checked by the services.
+func (h *Handlers) requestWorkspace(w http.ResponseWriter, r *http.Request, userID string) (string, bool) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return "", false
+	}
+
+	workspaceID := strings.TrimSpace(r.Header.Get("X-Workspace-ID"))
+	if workspaceID == "" {
+		workspaceID = strings.TrimSpace(r.URL.Query().Get("workspace_id"))
+	}
+	if workspaceID != "" {
+		return workspaceID, true
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		fmt.Printf("Failed to ensure user exists for %s: %v\n", userID, err)
+		writeUserError(w, err, "Failed to validate user")
+		return "", false
+	}
+	workspaceID, err := h.workspaceService.PersonalWorkspace(r.Context(), userID)
+	if err != nil {
+		fmt.Printf("Failed to get personal workspace for %s: %v\n", userID, err)
+		http.Error(w, "Failed to get workspace", http.StatusInternalServerError)
+		return "", false
+	}
+	return workspaceID, true
+}
+
+// writeForbidden responds 403 if err is a role that does not allow the
+// action and reports whether it did
+func writeForbidden(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, services.ErrForbidden) {
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusForbidden)
+	return true
+}
+
+// GetWorkspaces lists the user's workspaces with their role in each:
+// GET /workspaces
+func (h *Handlers) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+	// Make sure the personal workspace exists before listing
+	if _, err := h.workspaceService.PersonalWorkspace(r.Context(), userID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get workspaces: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	workspaces, err := h.workspaceService.ListWorkspaces(r.Context(), userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get workspaces")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+// CreateWorkspace creates a shared workspace owned by the user:
+// POST /workspaces {"name"}
+func (h *Handlers) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.getOrCreateUser(r.Context(), userID); err != nil {
+		writeUserError(w, err, "Failed to validate user")
+		return
+	}
+
+	var req models.WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(r.Context(), userID, req.Name)
+	if err != nil {
+		writeOrganizationError(w, err, "create workspace")
+		return
+	}
+
+	h.audit(r, "workspace.create", "workspace", workspace.ID, map[string]string{"name": workspace.Name})
+
+	writeJSON(w, http.StatusCreated, workspace)
+}
+
+// GetWorkspace returns one workspace: GET /workspaces/{id}
+func (h *Handlers) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	workspace, err := h.workspaceService.GetWorkspace(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get workspace")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspace)
+}
+
+// RenameWorkspace renames a workspace: PATCH /workspaces/{id} {"name"}
+func (h *Handlers) RenameWorkspace(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.WorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := h.workspaceService.RenameWorkspace(r.Context(), mux.Vars(r)["id"], userID, req.Name)
+	if err != nil {
+		writeOrganizationError(w, err, "rename workspace")
+		return
+	}
+
+	h.audit(r, "workspace.rename", "workspace", workspace.ID, map[string]string{"name": workspace.Name})
+
+	writeJSON(w, http.StatusOK, workspace)
+}
+
+// DeleteWorkspace deletes an empty shared workspace: DELETE /workspaces/{id}
+func (h *Handlers) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	workspaceID := mux.Vars(r)["id"]
+	if err := h.workspaceService.DeleteWorkspace(r.Context(), workspaceID, userID); err != nil {
+		writeOrganizationError(w, err, "delete workspace")
+		return
+	}
+
+	h.audit(r, "workspace.delete", "workspace", workspaceID, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWorkspaceMembers lists the members of a workspace:
+// GET /workspaces/{id}/members
+func (h *Handlers) GetWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.workspaceService.GetMembers(r.Context(), mux.Vars(r)["id"], userID)
+	if err != nil {
+		writeOrganizationError(w, err, "get members")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, members)
+}
+
+// AddWorkspaceMember adds a user by email:
+// POST /workspaces/{id}/members {"email", "role"}
+func (h *Handlers) AddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AddMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.workspaceService.AddMember(r.Context(), mux.Vars(r)["id"], userID, req)
+	if err != nil {
+		writeOrganizationError(w, err, "add member")
+		return
+	}
+
+	h.audit(r, "workspace.member_add", "workspace", mux.Vars(r)["id"], map[string]string{
+		"user_id": member.UserID,
+		"role":    string(member.Role),
+	})
+
+	writeJSON(w, http.StatusCreated, member)
+}
+
+// UpdateWorkspaceMember changes a member's role:
+// PATCH /workspaces/{id}/members/{userId} {"role"}
+func (h *Handlers) UpdateWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := h.workspaceService.UpdateMemberRole(r.Context(), vars["id"], userID, vars["userId"], req.Role); err != nil {
+		writeOrganizationError(w, err, "update member")
+		return
+	}
+
+	h.audit(r, "workspace.member_update", "workspace", vars["id"], map[string]string{
+		"user_id": vars["userId"],
+		"role":    string(req.Role),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveWorkspaceMember removes a member, or lets the user leave:
+// DELETE /workspaces/{id}/members/{userId}
+func (h *Handlers) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	if h.workspaceService == nil {
+		http.Error(w, "Workspace service is currently unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := h.ensureAuthenticated(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := h.workspaceService.RemoveMember(r.Context(), vars["id"], userID, vars["userId"]); err != nil {
+		writeOrganizationError(w, err, "remove member")
+		return
+	}
+
+	h.audit(r, "workspace.member_remove", "workspace", vars["id"], map[string]string{"user_id": vars["userId"]})
+
+	w.WriteHeader(http.StatusNoContent)
+}
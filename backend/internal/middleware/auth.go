@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/MicahParks/keyfunc"
+	"github.com/golang-jwt/jwt/v4"
+
+	"strategy-analyst/internal/models"
+	"strategy-analyst/internal/services"
+)
+
+const (
+	UserEmailKey contextKey = "userEmail"
+	APIKeyIDKey  contextKey = "apiKeyID"
+)
+
+// Identity is the caller a verified token belongs to
+type Identity struct {
+	UserID string
+	// Empty if the token carries no email claim
+	Email string
+}
+
+// TokenVerifier checks a bearer token and returns who it was issued to
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (*Identity, error)
+}
+
+// FirebaseVerifier accepts Firebase ID tokens
+type FirebaseVerifier struct {
+	client *auth.Client
+}
+
+func NewFirebaseVerifier(client *auth.Client) *FirebaseVerifier {
+	return &FirebaseVerifier{client: client}
+}
+
+func (v *FirebaseVerifier) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	claims, err := v.client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	email, _ := claims.Claims["email"].(string)
+	// As with JWTVerifier, shares and invites are resolved by email, so only
+	// an address Firebase has verified is trusted
+	if verified, _ := claims.Claims["email_verified"].(bool); !verified {
+		email = ""
+	}
+	return &Identity{UserID: claims.UID, Email: email}, nil
+}
+
+// JWTConfig configures a JWTVerifier. Exactly one of JWKSURL and JWKSFile
+// must be set.
+type JWTConfig struct {
+	// Expected "iss" and "aud" claims. Both are required with JWKSURL, whose
+	// keys sign tokens for every client of the provider; with JWKSFile an
+	// empty one skips its check.
+	Issuer   string
+	Audience string
+	// Remote key set, refreshed hourly and whenever an unknown key ID is seen
+	JWKSURL string
+	// Local key set, read once at startup
+	JWKSFile string
+	// Claims holding the user ID and email; default "sub" and "email"
+	UserIDClaim string
+	EmailClaim  string
+}
+
+// JWTVerifier accepts JWTs signed with a key from a JWKS, such as the ID or
+// access tokens of an OIDC provider
+type JWTVerifier struct {
+	config JWTConfig
+	jwks   *keyfunc.JWKS
+}
+
+// Only asymmetric algorithms; the key set must not be usable to forge tokens
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if config.UserIDClaim == "" {
+		config.UserIDClaim = "sub"
+	}
+	if config.EmailClaim == "" {
+		config.EmailClaim = "email"
+	}
+
+	var jwks *keyfunc.JWKS
+	var err error
+	switch {
+	case config.JWKSURL != "" && config.JWKSFile != "":
+		return nil, fmt.Errorf("set either a JWKS URL or a JWKS file, not both")
+	case config.JWKSURL != "":
+		if config.Issuer == "" || config.Audience == "" {
+			return nil, fmt.Errorf("an issuer and an audience are required with a JWKS URL")
+		}
+		jwks, err = keyfunc.Get(config.JWKSURL, keyfunc.Options{
+			RefreshInterval:   time.Hour,
+			RefreshRateLimit:  5 * time.Minute,
+			RefreshTimeout:    10 * time.Second,
+			RefreshUnknownKID: true,
+			RefreshErrorHandler: func(err error) {
+				fmt.Printf("Failed to refresh JWKS from %s: %v\n", config.JWKSURL, err)
+			},
+		})
+	case config.JWKSFile != "":
+		var data []byte
+		data, err = os.ReadFile(config.JWKSFile)
+		if err == nil {
+			jwks, err = keyfunc.NewJSON(json.RawMessage(data))
+		}
+	default:
+		return nil, fmt.Errorf("a JWKS URL or JWKS file is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWKS: %w", err)
+	}
+
+	return &JWTVerifier{config: config, jwks: jwks}, nil
+}
+
+func (v *JWTVerifier) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, v.jwks.Keyfunc, jwt.WithValidMethods(jwtSigningMethods))
+	if err != nil {
+		return nil, err
+	}
+	if !parsed.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return nil, errors.New("token has no expiry or has expired")
+	}
+	if v.config.Issuer != "" && !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if v.config.Audience != "" && !claims.VerifyAudience(v.config.Audience, true) {
+		return nil, errors.New("unexpected token audience")
+	}
+
+	userID, _ := claims[v.config.UserIDClaim].(string)
+	if userID == "" {
+		return nil, fmt.Errorf("token has no %s claim", v.config.UserIDClaim)
+	}
+	email, _ := claims[v.config.EmailClaim].(string)
+	// Shares are resolved by email, so an address the provider has not
+	// verified is not trusted. Some providers, such as Cognito, send the
+	// claim as a string.
+	if verified, ok := claims["email_verified"]; ok && verified != true && verified != "true" {
+		email = ""
+	}
+	return &Identity{UserID: userID, Email: email}, nil
+}
+
+// StaticTokenVerifier accepts one fixed token as one fixed user. It is meant
+// for local development and tests only.
+type StaticTokenVerifier struct {
+	token    string
+	identity Identity
+}
+
+func NewStaticTokenVerifier(token, userID, email string) (*StaticTokenVerifier, error) {
+	if token == "" || userID == "" {
+		return nil, fmt.Errorf("a static token and user ID are required")
+	}
+	return &StaticTokenVerifier{token: token, identity: Identity{UserID: userID, Email: email}}, nil
+}
+
+func (v *StaticTokenVerifier) VerifyToken(ctx context.Context, token string) (*Identity, error) {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(v.token)) != 1 {
+		return nil, errors.New("invalid token")
+	}
+	identity := v.identity
+	return &identity, nil
+}
+
+// APIKeyVerifier checks a personal API key and returns it with its user
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error)
+}
+
+// AuthMiddleware authenticates requests with "Authorization: Bearer <token>",
+// checked by verifier, or "Authorization: ApiKey <key>", checked by apiKeys,
+// and adds the caller's user ID and email to the request context. Requests
+// with an API key also carry its ID and scope. Either verifier may be nil,
+// and the requests it would check are answered 503.
+func AuthMiddleware(verifier TokenVerifier, apiKeys APIKeyVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				return
+			}
+
+			// Extract the credential from "Bearer <token>" or "ApiKey <key>"
+			tokenParts := strings.Split(authHeader, " ")
+			if len(tokenParts) != 2 || (tokenParts[0] != "Bearer" && tokenParts[0] != "ApiKey") {
+				http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+				return
+			}
+
+			ctx := r.Context()
+			if tokenParts[0] == "ApiKey" {
+				if apiKeys == nil {
+					http.Error(w, "API keys are currently unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				key, user, err := apiKeys.VerifyAPIKey(ctx, tokenParts[1])
+				if err != nil {
+					if strings.Contains(err.Error(), "invalid API key") {
+						http.Error(w, "Invalid API key", http.StatusUnauthorized)
+					} else {
+						http.Error(w, "Failed to verify API key", http.StatusInternalServerError)
+					}
+					return
+				}
+				ctx = context.WithValue(ctx, UserIDKey, user.ID)
+				ctx = context.WithValue(ctx, UserEmailKey, user.Email)
+				ctx = context.WithValue(ctx, APIKeyIDKey, key.ID)
+				ctx = services.WithAPIKeyScope(ctx, key.Scope)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			if verifier == nil {
+				http.Error(w, "Authentication is currently unavailable", http.StatusServiceUnavailable)
+				return
+			}
+
+			// Verify the token
+			identity, err := verifier.VerifyToken(ctx, tokenParts[1])
+			if err != nil {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			// Add the caller to the request context
+			ctx = context.WithValue(ctx, UserIDKey, identity.UserID)
+			ctx = context.WithValue(ctx, UserEmailKey, identity.Email)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetUserEmail returns the email from the caller's token, or ""
+func GetUserEmail(ctx context.Context) string {
+	if email, ok := ctx.Value(UserEmailKey).(string); ok {
+		return email
+	}
+	return ""
+}
+
+// GetAPIKeyID returns the ID of the API key the request was authenticated
+// with, or "" if it used a token
+func GetAPIKeyID(ctx context.Context) string {
+	if keyID, ok := ctx.Value(APIKeyIDKey).(string); ok {
+		return keyID
+	}
+	return ""
+}
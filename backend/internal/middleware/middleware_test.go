@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.0.2.1 ,,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	if len(proxies) != 3 {
+		t.Fatalf("ParseTrustedProxies() = %v, want 3 networks", proxies)
+	}
+	for ip, want := range map[string]bool{"10.1.2.3": true, "192.0.2.1": true, "192.0.2.2": false, "2001:db8::1": true, "11.0.0.1": false} {
+		if got := isTrustedProxy(ip, proxies); got != want {
+			t.Errorf("isTrustedProxy(%q) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if proxies, err := ParseTrustedProxies(""); err != nil || len(proxies) != 0 {
+		t.Errorf("ParseTrustedProxies(\"\") = %v, %v, want no networks", proxies, err)
+	}
+	for _, spec := range []string{"proxy.internal", "10.0.0.0/33", "10.0.0.1,x"} {
+		if _, err := ParseTrustedProxies(spec); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{name: "direct request", remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "forged header from an untrusted caller", remoteAddr: "192.0.2.1:1234", forwarded: []string{"198.51.100.7"}, want: "192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "client entries before the proxy's are ignored", remoteAddr: "10.0.0.1:1234", forwarded: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "chained trusted proxies", remoteAddr: "10.0.0.1:1234", forwarded: []string{"198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{name: "repeated headers", remoteAddr: "10.0.0.1:1234", forwarded: []string{"203.0.113.9", "198.51.100.7"}, want: "198.51.100.7"},
+		{name: "trusted proxy without the header", remoteAddr: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "malformed entry", remoteAddr: "10.0.0.1:1234", forwarded: []string{"garbage"}, want: "10.0.0.1"},
+		{name: "IPv6 caller", remoteAddr: "[2001:db8::1]:1234", forwarded: []string{"198.51.100.7"}, want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ClientIPMiddleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/documents", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/documents", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if got := ClientIP(req); got != "192.0.2.1" {
+		t.Errorf("ClientIP() = %q, want %q", got, "192.0.2.1")
+	}
+}
@@ -0,0 +1,262 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RateLimit is a token bucket: it holds up to Burst requests and refills at
+// Rate requests per second. A zero Rate means unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits are the limits of the routes, keyed by method and path
+// template such as "POST /api/documents/{id}/chat". Routes not listed share
+// one Default bucket per caller.
+type RateLimits struct {
+	Default RateLimit
+	Routes  map[string]RateLimit
+}
+
+// ParseRateLimit reads "<requests>/<period>[:<burst>]", such as "20/1m" or
+// "20/1m:40"; the burst defaults to the number of requests. "" and "0"
+// mean unlimited.
+func ParseRateLimit(spec string) (RateLimit, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "0" {
+		return RateLimit{}, nil
+	}
+
+	rate, burstSpec, hasBurst := strings.Cut(spec, ":")
+	countSpec, periodSpec, ok := strings.Cut(rate, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: use <requests>/<period>[:<burst>]", spec)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countSpec))
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: requests must be a positive integer", spec)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(periodSpec))
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration such as 1m", spec)
+	}
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(strings.TrimSpace(burstSpec))
+		if err != nil || burst <= 0 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", spec)
+		}
+	}
+
+	return RateLimit{Rate: float64(count) / period.Seconds(), Burst: burst}, nil
+}
+
+// ParseRateLimits reads the default limit and the route limits, given as
+// "<method> <path template>=<limit>" entries separated by semicolons
+func ParseRateLimits(defaultSpec, routeSpecs string) (RateLimits, error) {
+	limits := RateLimits{Routes: make(map[string]RateLimit)}
+
+	var err error
+	if limits.Default, err = ParseRateLimit(defaultSpec); err != nil {
+		return limits, err
+	}
+
+	for _, entry := range strings.Split(routeSpecs, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, spec, ok := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !hasPath {
+			return limits, fmt.Errorf("invalid route rate limit %q: use <method> <path>=<limit>", entry)
+		}
+		limit, err := ParseRateLimit(spec)
+		if err != nil {
+			return limits, err
+		}
+		limits.Routes[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = limit
+	}
+
+	return limits, nil
+}
+
+// RateLimitStore takes a request from the bucket under key. When the bucket
+// is empty it reports how long until the next request is allowed.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitMiddleware limits each caller to the limits of the matched route.
+// Callers are identified by their API key, their user ID or, on public
+// routes, their ClientIP. Rejected requests get 429 with a Retry-After
+// header; if the store fails, requests are let through.
+func RateLimitMiddleware(store RateLimitStore, limits RateLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			route := "*"
+			limit := limits.Default
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					if routeLimit, ok := limits.Routes[r.Method+" "+template]; ok {
+						route, limit = r.Method+" "+template, routeLimit
+					}
+				}
+			}
+			if limit.Rate <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			caller := "ip:" + ClientIP(r)
+			if keyID := GetAPIKeyID(r.Context()); keyID != "" {
+				caller = "key:" + keyID
+			} else if userID := GetUserID(r.Context()); userID != "" {
+				caller = "user:" + userID
+			}
+
+			allowed, retryAfter, err := store.Take(r.Context(), caller+" "+route, limit)
+			if err != nil {
+				fmt.Printf("Rate limiting %s failed, allowing the request: %v\n", caller, err)
+			} else if !allowed {
+				seconds := max(int64(math.Ceil(retryAfter.Seconds())), 1)
+				w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+				http.Error(w, fmt.Sprintf("Rate limit exceeded, retry in %d seconds", seconds), http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	// When the bucket is full again and can be forgotten
+	fullAt time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in memory, so its limits only hold for
+// a single instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*memoryBucket), lastSweep: time.Now(), now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	burst := float64(limit.Burst)
+	if now.Sub(s.lastSweep) > time.Minute {
+		// Full buckets behave like missing ones, so they can be dropped
+		for bucketKey, bucket := range s.buckets {
+			if !now.Before(bucket.fullAt) {
+				delete(s.buckets, bucketKey)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: burst, updated: now}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*limit.Rate)
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.fullAt = now.Add(secondsDuration((burst - bucket.tokens) / limit.Rate))
+	if !allowed {
+		return false, secondsDuration((1 - bucket.tokens) / limit.Rate), nil
+	}
+	return true, 0, nil
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// PostgresRateLimitStore keeps buckets in the rate_limit_buckets table, so
+// every instance sharing the database enforces the same limits
+type PostgresRateLimitStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRateLimitStore(db *sql.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db}
+}
+
+// The bucket's tokens after refilling them for the time since its last use
+const refilledTokens = `LEAST(EXCLUDED.burst, b.tokens + GREATEST(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - b.updated_at), 0) * EXCLUDED.rate)`
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	// The row is locked by the upsert, so concurrent requests from several
+	// instances cannot take the same token
+	query := `INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, rate, burst, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, $3, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN ` + refilledTokens + ` >= 1 THEN ` + refilledTokens + ` - 1 ELSE ` + refilledTokens + ` END,
+			allowed = ` + refilledTokens + ` >= 1,
+			rate = EXCLUDED.rate,
+			burst = EXCLUDED.burst,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING tokens, allowed`
+	var tokens float64
+	var allowed bool
+	err := s.db.QueryRowContext(ctx, query, key, float64(limit.Burst), limit.Rate).Scan(&tokens, &allowed)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take from rate limit bucket: %w", err)
+	}
+	if !allowed {
+		return false, secondsDuration((1 - tokens) / limit.Rate), nil
+	}
+	return true, 0, nil
+}
+
+// RunJanitor periodically deletes buckets that have refilled completely,
+// which behave the same as missing ones, until ctx is cancelled
+func (s *PostgresRateLimitStore) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			query := `DELETE FROM rate_limit_buckets
+				WHERE updated_at + make_interval(secs => (burst - tokens) / rate) < CURRENT_TIMESTAMP`
+			if _, err := s.db.ExecContext(ctx, query); err != nil {
+				fmt.Printf("Rate limit bucket cleanup failed: %v\n", err)
+			}
+		}
+	}
+}
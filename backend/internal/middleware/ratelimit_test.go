@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    RateLimit
+		wantErr bool
+	}{
+		{spec: "", want: RateLimit{}},
+		{spec: "0", want: RateLimit{}},
+		{spec: "20/1m", want: RateLimit{Rate: 20.0 / 60, Burst: 20}},
+		{spec: "20/1m:40", want: RateLimit{Rate: 20.0 / 60, Burst: 40}},
+		{spec: "5/1s:1", want: RateLimit{Rate: 5, Burst: 1}},
+		{spec: " 10 / 500ms : 3 ", want: RateLimit{Rate: 20, Burst: 3}},
+		{spec: "20", wantErr: true},
+		{spec: "20:40", wantErr: true},
+		{spec: "/1m", wantErr: true},
+		{spec: "x/1m", wantErr: true},
+		{spec: "0/1m", wantErr: true},
+		{spec: "-5/1m", wantErr: true},
+		{spec: "1.5/1m", wantErr: true},
+		{spec: "20/", wantErr: true},
+		{spec: "20/1", wantErr: true},
+		{spec: "20/minute", wantErr: true},
+		{spec: "20/0s", wantErr: true},
+		{spec: "20/-1m", wantErr: true},
+		{spec: "20/1m:", wantErr: true},
+		{spec: "20/1m:0", wantErr: true},
+		{spec: "20/1m:-1", wantErr: true},
+		{spec: "20/1m:x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRateLimit(%q) = %+v, want an error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRateLimit(%q) error = %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRateLimit(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits("300/1m", " post /api/documents/{id}/chat=20/1m ; GET /api/public/shares/{token}=60/1m:10;")
+	if err != nil {
+		t.Fatalf("ParseRateLimits() error = %v", err)
+	}
+	if want := (RateLimit{Rate: 5, Burst: 300}); limits.Default != want {
+		t.Errorf("Default = %+v, want %+v", limits.Default, want)
+	}
+	want := map[string]RateLimit{
+		"POST /api/documents/{id}/chat":  {Rate: 20.0 / 60, Burst: 20},
+		"GET /api/public/shares/{token}": {Rate: 1, Burst: 10},
+	}
+	if len(limits.Routes) != len(want) {
+		t.Fatalf("Routes = %+v, want %+v", limits.Routes, want)
+	}
+	for route, limit := range want {
+		if limits.Routes[route] != limit {
+			t.Errorf("Routes[%q] = %+v, want %+v", route, limits.Routes[route], limit)
+		}
+	}
+
+	for _, routes := range []string{"POST=20/1m", "/api/documents=20/1m", "POST /api/documents", "POST /api/documents=20"} {
+		if _, err := ParseRateLimits("", routes); err == nil {
+			t.Errorf("ParseRateLimits(%q) succeeded, want an error", routes)
+		}
+	}
+	if _, err := ParseRateLimits("300", ""); err == nil {
+		t.Error("ParseRateLimits with a malformed default succeeded, want an error")
+	}
+}
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := RateLimit{Rate: 2, Burst: 3}
+
+	steps := []struct {
+		name           string
+		at             time.Duration
+		key            string
+		wantAllowed    bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "a new bucket starts full", at: 0, key: "a", wantAllowed: true},
+		{name: "burst second", at: 0, key: "a", wantAllowed: true},
+		{name: "burst third", at: 0, key: "a", wantAllowed: true},
+		{name: "burst exhausted", at: 0, key: "a", wantRetryAfter: 500 * time.Millisecond},
+		{name: "other keys have their own bucket", at: 0, key: "b", wantAllowed: true},
+		{name: "partly refilled", at: 250 * time.Millisecond, key: "a", wantRetryAfter: 250 * time.Millisecond},
+		{name: "refilled one token", at: 500 * time.Millisecond, key: "a", wantAllowed: true},
+		{name: "empty again", at: 500 * time.Millisecond, key: "a", wantRetryAfter: 500 * time.Millisecond},
+		{name: "refill is capped at the burst", at: time.Minute, key: "a", wantAllowed: true},
+		{name: "capped second", at: time.Minute, key: "a", wantAllowed: true},
+		{name: "capped third", at: time.Minute, key: "a", wantAllowed: true},
+		{name: "capped burst exhausted", at: time.Minute, key: "a", wantRetryAfter: 500 * time.Millisecond},
+	}
+
+	for _, step := range steps {
+		now = start.Add(step.at)
+		allowed, retryAfter, err := store.Take(context.Background(), step.key, limit)
+		if err != nil {
+			t.Fatalf("%s: Take() error = %v", step.name, err)
+		}
+		if allowed != step.wantAllowed {
+			t.Errorf("%s: allowed = %v, want %v", step.name, allowed, step.wantAllowed)
+		}
+		// Allow for floating point error in the refill
+		if diff := retryAfter - step.wantRetryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%s: retryAfter = %v, want %v", step.name, retryAfter, step.wantRetryAfter)
+		}
+	}
+}
+
+// stubRateLimitStore answers every Take the same way and records the keys
+type stubRateLimitStore struct {
+	allowed    bool
+	retryAfter time.Duration
+	err        error
+	keys       []string
+}
+
+func (s *stubRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	s.keys = append(s.keys, key)
+	return s.allowed, s.retryAfter, s.err
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limits := RateLimits{
+		Default: RateLimit{Rate: 1, Burst: 1},
+		Routes: map[string]RateLimit{
+			"POST /api/documents/{id}/chat": {Rate: 1, Burst: 5},
+			"GET /api/unlimited":            {},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		store          *stubRateLimitStore
+		wantStatus     int
+		wantRetryAfter string
+		wantKey        string
+	}{
+		{
+			name:       "allowed",
+			method:     http.MethodGet,
+			path:       "/api/documents",
+			store:      &stubRateLimitStore{allowed: true},
+			wantStatus: http.StatusOK,
+			wantKey:    "ip:192.0.2.1 *",
+		},
+		{
+			name:       "route limit",
+			method:     http.MethodPost,
+			path:       "/api/documents/42/chat",
+			store:      &stubRateLimitStore{allowed: true},
+			wantStatus: http.StatusOK,
+			wantKey:    "ip:192.0.2.1 POST /api/documents/{id}/chat",
+		},
+		{
+			name:           "retry after rounds up",
+			method:         http.MethodGet,
+			path:           "/api/documents",
+			store:          &stubRateLimitStore{retryAfter: 1500 * time.Millisecond},
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "2",
+			wantKey:        "ip:192.0.2.1 *",
+		},
+		{
+			name:           "whole seconds are kept",
+			method:         http.MethodGet,
+			path:           "/api/documents",
+			store:          &stubRateLimitStore{retryAfter: 3 * time.Second},
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "3",
+			wantKey:        "ip:192.0.2.1 *",
+		},
+		{
+			name:           "retry after is at least one second",
+			method:         http.MethodGet,
+			path:           "/api/documents",
+			store:          &stubRateLimitStore{retryAfter: 10 * time.Millisecond},
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "1",
+			wantKey:        "ip:192.0.2.1 *",
+		},
+		{
+			name:       "store failures let requests through",
+			method:     http.MethodGet,
+			path:       "/api/documents",
+			store:      &stubRateLimitStore{err: errors.New("database is down")},
+			wantStatus: http.StatusOK,
+			wantKey:    "ip:192.0.2.1 *",
+		},
+		{
+			name:       "unlimited routes skip the store",
+			method:     http.MethodGet,
+			path:       "/api/unlimited",
+			store:      &stubRateLimitStore{},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "preflight requests skip the store",
+			method:     http.MethodOptions,
+			path:       "/api/documents",
+			store:      &stubRateLimitStore{},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+			router.HandleFunc("/api/documents", ok).Methods(http.MethodGet, http.MethodOptions)
+			router.HandleFunc("/api/documents/{id}/chat", ok).Methods(http.MethodPost)
+			router.HandleFunc("/api/unlimited", ok).Methods(http.MethodGet)
+			router.Use(RateLimitMiddleware(tt.store, limits))
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			switch {
+			case tt.wantKey == "" && len(tt.store.keys) != 0:
+				t.Errorf("store was asked for %q, want no call", tt.store.keys)
+			case tt.wantKey != "" && (len(tt.store.keys) != 1 || tt.store.keys[0] != tt.wantKey):
+				t.Errorf("store keys = %q, want [%q]", tt.store.keys, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareIdentifiesCallers(t *testing.T) {
+	store := &stubRateLimitStore{allowed: true}
+	handler := RateLimitMiddleware(store, RateLimits{Default: RateLimit{Rate: 1, Burst: 1}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	contexts := []context.Context{
+		context.WithValue(context.Background(), UserIDKey, "user-1"),
+		context.WithValue(context.WithValue(context.Background(), UserIDKey, "user-1"), APIKeyIDKey, "key-1"),
+	}
+	for _, ctx := range contexts {
+		req := httptest.NewRequest(http.MethodGet, "/api/documents", nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := []string{"user:user-1 *", "key:key-1 *"}
+	if len(store.keys) != len(want) || store.keys[0] != want[0] || store.keys[1] != want[1] {
+		t.Errorf("store keys = %q, want %q", store.keys, want)
+	}
+}
@@ -10,12 +10,353 @@ type User struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// APIKeyScope limits what a request authenticated with an API key may do
+type APIKeyScope string
+
+const (
+	// View documents, conversations, analyses and facts
+	APIKeyScopeReadOnly APIKeyScope = "read_only"
+	// Also ask questions, run analyses and compare documents
+	APIKeyScopeChat APIKeyScope = "chat"
+	// Everything the user can do, except managing API keys
+	APIKeyScopeFull APIKeyScope = "full"
+)
+
+// APIKey is a personal key for scripts and pipelines. Key is only set on
+// creation; only its hash is stored, and Prefix identifies it in listings.
+type APIKey struct {
+	ID         string      `json:"id" db:"id"`
+	Name       string      `json:"name" db:"name"`
+	Prefix     string      `json:"prefix" db:"prefix"`
+	Key        string      `json:"key,omitempty" db:"-"`
+	Scope      APIKeyScope `json:"scope" db:"scope"`
+	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time  `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time  `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name  string      `json:"name"`
+	Scope APIKeyScope `json:"scope"`
+}
+
+// Role is a member's role in a workspace
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// Workspace is a shared space of documents. Every user has a personal
+// workspace that cannot be shared or deleted.
+type Workspace struct {
+	ID          string    `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Personal    bool      `json:"personal" db:"-"`
+	Role        Role      `json:"role" db:"-"`
+	MemberCount int       `json:"member_count" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// WorkspaceMember is a user's membership of a workspace
+type WorkspaceMember struct {
+	UserID    string    `json:"user_id" db:"user_id"`
+	Email     string    `json:"email" db:"email"`
+	Role      Role      `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type WorkspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// AddMemberRequest adds a user, who must have signed in before, by email
+type AddMemberRequest struct {
+	Email string `json:"email"`
+	Role  Role   `json:"role"`
+}
+
+type UpdateMemberRequest struct {
+	Role Role `json:"role"`
+}
+
+// SharePermission is what a user a single document is shared with may do
+type SharePermission string
+
+const (
+	SharePermissionView SharePermission = "view"
+	SharePermissionChat SharePermission = "chat"
+)
+
+// DocumentShare grants a user outside the document's workspace access to it
+type DocumentShare struct {
+	DocumentID string          `json:"document_id" db:"document_id"`
+	UserID     string          `json:"user_id" db:"user_id"`
+	Email      string          `json:"email" db:"email"`
+	Permission SharePermission `json:"permission" db:"permission"`
+	SharedBy   string          `json:"shared_by" db:"shared_by"`
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// ShareDocumentRequest shares a document with a user, who must have signed
+// in before, by email. Sharing again changes the permission.
+type ShareDocumentRequest struct {
+	Email      string          `json:"email"`
+	Permission SharePermission `json:"permission"`
+}
+
+// SharedDocument is a document shared with the user and their permission
+type SharedDocument struct {
+	*Document
+	Permission SharePermission `json:"permission"`
+	SharedBy   string          `json:"shared_by"`
+	SharedAt   time.Time       `json:"shared_at"`
+}
+
+// ShareLink is an expiring read-only link to a document's summary and the
+// chat messages chosen when it was created. Token is only set on creation;
+// only its hash is stored.
+type ShareLink struct {
+	ID         string     `json:"id" db:"id"`
+	DocumentID string     `json:"document_id" db:"document_id"`
+	Token      string     `json:"token,omitempty" db:"-"`
+	MessageIDs []string   `json:"message_ids" db:"message_ids"`
+	CreatedBy  string     `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// CreateShareLinkRequest creates a share link. MessageIDs are messages of the
+// document's chat to include; ExpiresInHours defaults to a week.
+type CreateShareLinkRequest struct {
+	ExpiresInHours int      `json:"expires_in_hours"`
+	MessageIDs     []string `json:"message_ids"`
+}
+
+// PublicShare is what a share link shows to anyone who has it
+type PublicShare struct {
+	// The link and its document, for the audit log; never sent to the viewer
+	LinkID      string           `json:"-"`
+	DocumentID  string           `json:"-"`
+	Title       string           `json:"title"`
+	FileName    string           `json:"file_name"`
+	Description *string          `json:"description"`
+	Summary     *DocumentSummary `json:"summary"`
+	Messages    []*SharedMessage `json:"messages"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+}
+
+// SharedMessage is a chat message shown on a share link, without its author
+type SharedMessage struct {
+	MessageType    string    `json:"message_type"`
+	MessageContent string    `json:"message_content"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
 type Document struct {
 	ID          string     `json:"id" db:"id"`
 	UserID      string     `json:"user_id" db:"user_id"`
+	WorkspaceID string     `json:"workspace_id" db:"workspace_id"`
 	FileName    string     `json:"file_name" db:"file_name"`
 	StoragePath *string    `json:"storage_path" db:"storage_path"`
 	UploadedAt  *time.Time `json:"uploaded_at" db:"uploaded_at"`
+	SHA256      *string    `json:"sha256,omitempty" db:"sha256"`
+	SizeBytes   *int64     `json:"size_bytes,omitempty" db:"size_bytes"`
+	FolderID    *string    `json:"folder_id" db:"folder_id"`
+	Tags        []string   `json:"tags" db:"-"`
+
+	// User-editable details. FileName stays the uploaded name because its
+	// extension decides how the file is processed.
+	DisplayTitle   *string           `json:"display_title" db:"display_title"`
+	Description    *string           `json:"description" db:"description"`
+	CustomMetadata map[string]string `json:"custom_metadata" db:"custom_metadata"`
+	// Incremented on every edit and exposed as the ETag
+	Version int `json:"version" db:"version"`
+
+	// Set while the document is in the trash, with the time it will be purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty" db:"-"`
+
+	// Set by storage reconciliation when the uploaded file is not in the bucket
+	StorageMissing bool `json:"storage_missing,omitempty" db:"storage_missing"`
+
+	// Set once a first-page thumbnail has been rendered at ingest
+	ThumbnailURL *string `json:"thumbnail_url,omitempty" db:"-"`
+
+	Metadata *DocumentMetadata `json:"metadata,omitempty" db:"-"`
+	Summary  *DocumentSummary  `json:"summary,omitempty" db:"-"`
+
+	// Set on creation when the workspace already has a processed document with
+	// identical content, and whether its processed data was reused
+	DuplicateOf      *string `json:"duplicate_of,omitempty" db:"-"`
+	ReusedProcessing bool    `json:"-" db:"-"`
+}
+
+// DisplayName is the display title if one is set, otherwise the file name
+func (d *Document) DisplayName() string {
+	if d.DisplayTitle != nil && *d.DisplayTitle != "" {
+		return *d.DisplayTitle
+	}
+	return d.FileName
+}
+
+// UpdateDocumentRequest edits a document's details; nil fields are left
+// unchanged. An empty display title or description clears it, an empty value
+// in CustomMetadata removes that key, and MoveFolder is set when the body
+// contains folder_id so that null moves the document to the top level.
+type UpdateDocumentRequest struct {
+	DisplayTitle   *string           `json:"display_title"`
+	Description    *string           `json:"description"`
+	CustomMetadata map[string]string `json:"custom_metadata"`
+	FolderID       *string           `json:"folder_id"`
+	MoveFolder     bool              `json:"-"`
+	Tags           *[]string         `json:"tags"`
+}
+
+// DocumentMetadata holds the properties read from a PDF during ingestion
+type DocumentMetadata struct {
+	Title      string         `json:"title" db:"title"`
+	Author     string         `json:"author" db:"author"`
+	CreatedAt  *time.Time     `json:"created_at,omitempty" db:"pdf_created_at"`
+	ModifiedAt *time.Time     `json:"modified_at,omitempty" db:"pdf_modified_at"`
+	PageCount  int            `json:"page_count" db:"page_count"`
+	Outline    []OutlineEntry `json:"outline" db:"outline"`
+	Encrypted  bool           `json:"encrypted" db:"is_encrypted"`
+	ImageOnly  bool           `json:"image_only" db:"is_image_only"`
+}
+
+// OutlineEntry is a bookmark of the PDF outline, pointing at a 1-based page
+type OutlineEntry struct {
+	Title    string         `json:"title"`
+	Page     int            `json:"page"`
+	Children []OutlineEntry `json:"children,omitempty"`
+}
+
+// DocumentFilter narrows the document list by the extracted PDF metadata
+type DocumentFilter struct {
+	Title         string
+	Author        string
+	MinPages      *int
+	MaxPages      *int
+	Encrypted     *bool
+	ImageOnly     *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Collection    CollectionScope
+
+	// Processing status: "processing" or "ready"
+	Status string
+	// File extension without the dot, e.g. "pdf"
+	FileType       string
+	UploadedAfter  *time.Time
+	UploadedBefore *time.Time
+	// Substring of the file name or display title
+	Name string
+}
+
+// PageRequest asks for one page of a cursor-paginated list. Cursor is the
+// next_cursor of the previous page and must be used with the same Sort.
+type PageRequest struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Order  string
+}
+
+// DocumentPage is one page of the document list
+type DocumentPage struct {
+	Documents  []*Document `json:"documents"`
+	NextCursor *string     `json:"next_cursor"`
+	Total      int         `json:"total"`
+}
+
+// ChatHistoryPage is one page of a document's chat history
+type ChatHistoryPage struct {
+	Messages   []*ChatMessage `json:"messages"`
+	NextCursor *string        `json:"next_cursor"`
+	Total      int            `json:"total"`
+}
+
+// CollectionScope narrows documents to a folder and/or tags. A folder ID of
+// RootFolderID selects documents that are not in any folder.
+type CollectionScope struct {
+	FolderID          string   `json:"folder_id,omitempty"`
+	IncludeSubfolders bool     `json:"include_subfolders,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+}
+
+const RootFolderID = "root"
+
+// IsEmpty reports whether the scope selects every document
+func (s CollectionScope) IsEmpty() bool {
+	return s.FolderID == "" && len(s.Tags) == 0
+}
+
+// Folder is a node of a workspace's folder hierarchy
+type Folder struct {
+	ID            string    `json:"id" db:"id"`
+	WorkspaceID   string    `json:"workspace_id" db:"workspace_id"`
+	ParentID      *string   `json:"parent_id" db:"parent_id"`
+	Name          string    `json:"name" db:"name"`
+	DocumentCount int       `json:"document_count" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type CreateFolderRequest struct {
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+}
+
+// UpdateFolderRequest renames and/or moves a folder. Move is set when the
+// body contains parent_id, so that null moves the folder to the top level.
+type UpdateFolderRequest struct {
+	Name     *string `json:"name"`
+	ParentID *string `json:"parent_id"`
+	Move     bool    `json:"-"`
+}
+
+// Tag is a free-form label on documents
+type Tag struct {
+	ID            string    `json:"id" db:"id"`
+	WorkspaceID   string    `json:"workspace_id" db:"workspace_id"`
+	Name          string    `json:"name" db:"name"`
+	DocumentCount int       `json:"document_count" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type SetDocumentFolderRequest struct {
+	FolderID *string `json:"folder_id"`
+}
+
+type SetDocumentTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// DocumentSummary holds the executive summary and key facts generated for a
+// document once its chunks have been stored.
+type DocumentSummary struct {
+	DocumentID         string      `json:"document_id" db:"document_id"`
+	ExecutiveSummary   string      `json:"executive_summary" db:"executive_summary"`
+	Description        string      `json:"description" db:"description"`
+	KeyEntities        []string    `json:"key_entities" db:"key_entities"`
+	KeyFigures         []KeyFigure `json:"key_figures" db:"key_figures"`
+	SuggestedQuestions []string    `json:"suggested_questions" db:"suggested_questions"`
+	GeneratedAt        time.Time   `json:"generated_at" db:"generated_at"`
+}
+
+type KeyFigure struct {
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+	Context string `json:"context,omitempty"`
 }
 
 type DocumentChunk struct {
@@ -40,7 +381,23 @@ type ChatRequest struct {
 	Message string `json:"message"`
 }
 
+// CollectionChatMessage is a message of a conversation with a collection
+type CollectionChatMessage struct {
+	ID             string          `json:"id" db:"id"`
+	Collection     CollectionScope `json:"collection" db:"scope"`
+	MessageType    string          `json:"message_type" db:"message_type"`
+	MessageContent string          `json:"message_content" db:"message_content"`
+	Timestamp      time.Time       `json:"timestamp" db:"timestamp"`
+}
+
+type CollectionChatRequest struct {
+	Collection CollectionScope `json:"collection"`
+	Message    string          `json:"message"`
+}
+
 type ChatResponse struct {
+	// ID of the stored AI message, which its LLM calls link to
+	ID        string    `json:"id,omitempty"`
 	Message   string    `json:"message"`
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -48,6 +405,10 @@ type ChatResponse struct {
 type UploadResponse struct {
 	DocumentID string `json:"document_id"`
 	Message    string `json:"message"`
+	// ID of an already processed document with identical content
+	DuplicateOf *string `json:"duplicate_of,omitempty"`
+	// Whether that document's processed data was copied instead of re-extracted
+	Reused bool `json:"reused"`
 }
 
 type ErrorResponse struct {
@@ -57,6 +418,8 @@ type ErrorResponse struct {
 type CompareDocumentsRequest struct {
 	DocumentIDs []string `json:"document_ids"`
 	CompareType string   `json:"compare_type"` // "summary", "detailed", "themes", "differences"
+	// Compares the documents of a collection when no IDs are given
+	Collection *CollectionScope `json:"collection,omitempty"`
 }
 
 type CompareDocumentsResponse struct {
@@ -65,6 +428,8 @@ type CompareDocumentsResponse struct {
 }
 
 type DocumentComparison struct {
+	// Identifies the comparison's LLM calls; comparisons are not stored
+	ID           string     `json:"id"`
 	Documents    []Document `json:"documents"`
 	Summary      string     `json:"summary"`
 	Similarities []string   `json:"similarities"`
@@ -73,3 +438,239 @@ type DocumentComparison struct {
 	Insights     []string   `json:"insights"`
 	ComparedAt   time.Time  `json:"compared_at"`
 }
+
+// AnalysisTemplate describes a named strategic analysis (SWOT, PESTLE, ...)
+// and the typed sections its structured output is made of
+type AnalysisTemplate struct {
+	Name         string            `json:"name"`
+	Title        string            `json:"title"`
+	Description  string            `json:"description"`
+	Instructions string            `json:"instructions"`
+	Sections     []AnalysisSection `json:"sections"`
+}
+
+// AnalysisSection is one typed field of an analysis result. Type is "text"
+// (a string), "list" (an array of strings) or "table" (an array of objects
+// with the string columns listed in Fields).
+type AnalysisSection struct {
+	Key         string   `json:"key"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Fields      []string `json:"fields,omitempty"`
+}
+
+type DocumentAnalysis struct {
+	ID         string                 `json:"id" db:"id"`
+	DocumentID string                 `json:"document_id" db:"document_id"`
+	UserID     string                 `json:"user_id" db:"user_id"`
+	Template   AnalysisTemplate       `json:"template" db:"template_definition"`
+	Result     map[string]interface{} `json:"result" db:"result"`
+	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+}
+
+type CreateAnalysisRequest struct {
+	Template string `json:"template"`
+}
+
+// DocumentEntity is a named entity extracted from a document during ingestion
+type DocumentEntity struct {
+	ID           string    `json:"id" db:"id"`
+	DocumentID   string    `json:"document_id" db:"document_id"`
+	DocumentName string    `json:"document_name,omitempty" db:"-"`
+	ChunkID      *string   `json:"chunk_id,omitempty" db:"chunk_id"`
+	Name         string    `json:"name" db:"name"`
+	EntityType   string    `json:"entity_type" db:"entity_type"` // "company", "person", "product", "location"
+	Mentions     int       `json:"mentions" db:"mentions"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// DocumentMetric is a numeric figure extracted from a document during ingestion
+type DocumentMetric struct {
+	ID           string    `json:"id" db:"id"`
+	DocumentID   string    `json:"document_id" db:"document_id"`
+	DocumentName string    `json:"document_name,omitempty" db:"-"`
+	ChunkID      *string   `json:"chunk_id,omitempty" db:"chunk_id"`
+	Name         string    `json:"name" db:"name"`
+	Value        float64   `json:"value" db:"value"`
+	ValueText    string    `json:"value_text" db:"value_text"`
+	Unit         string    `json:"unit" db:"unit"`
+	Period       string    `json:"period" db:"period"`
+	Context      string    `json:"context" db:"context"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+type EntityFilter struct {
+	DocumentID string
+	EntityType string
+	Query      string
+}
+
+type MetricFilter struct {
+	DocumentID string
+	Name       string
+	Unit       string
+	Period     string
+	MinValue   *float64
+	MaxValue   *float64
+}
+
+// DocumentTable is a table detected in a PDF, stored as rows of cells. The
+// first row holds the column headers.
+type DocumentTable struct {
+	ID         string     `json:"id" db:"id"`
+	DocumentID string     `json:"document_id" db:"document_id"`
+	ChunkID    *string    `json:"chunk_id,omitempty" db:"chunk_id"`
+	PageNumber int        `json:"page_number" db:"page_number"`
+	TableIndex int        `json:"table_index" db:"table_index"`
+	Columns    []string   `json:"columns" db:"-"`
+	Rows       [][]string `json:"rows" db:"rows"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+const (
+	UploadStatusCreated = "created"
+	UploadStatusFailed  = "failed"
+	UploadStatusSkipped = "skipped"
+)
+
+// BatchUploadResult is the outcome for one file of a multi-file or archive upload
+type BatchUploadResult struct {
+	FileName string `json:"file_name"`
+	// Archive the file came from and its path inside it
+	Archive     string  `json:"archive,omitempty"`
+	Path        string  `json:"path,omitempty"`
+	Status      string  `json:"status"`
+	DocumentID  string  `json:"document_id,omitempty"`
+	DuplicateOf *string `json:"duplicate_of,omitempty"`
+	Reused      bool    `json:"reused,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type BatchUploadResponse struct {
+	Results []BatchUploadResult `json:"results"`
+	Created int                 `json:"created"`
+	Failed  int                 `json:"failed"`
+	Skipped int                 `json:"skipped"`
+}
+
+// UploadSession is a resumable upload in progress
+type UploadSession struct {
+	ID            string      `json:"id" db:"id"`
+	WorkspaceID   string      `json:"workspace_id" db:"workspace_id"`
+	FileName      string      `json:"file_name" db:"file_name"`
+	Size          int64       `json:"size" db:"total_size"`
+	ReceivedBytes int64       `json:"received_bytes" db:"-"`
+	Ranges        []ByteRange `json:"ranges" db:"-"`
+	CreatedAt     time.Time   `json:"created_at" db:"created_at"`
+	ExpiresAt     time.Time   `json:"expires_at" db:"expires_at"`
+}
+
+// ByteRange is a half-open range [Start, End) of received bytes
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+type CreateUploadSessionRequest struct {
+	FileName string `json:"file_name"`
+	Size     int64  `json:"size"`
+}
+
+// AuditEvent is one entry of the append-only audit log. Actor fields are
+// empty for anonymous access through a share link.
+type AuditEvent struct {
+	ID          string    `json:"id"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	ActorID     *string   `json:"actor_id"`
+	ActorEmail  *string   `json:"actor_email"`
+	APIKeyID    *string   `json:"api_key_id,omitempty"`
+	WorkspaceID *string   `json:"workspace_id"`
+	// e.g. "document.upload"; see the README for the full list
+	Action     string            `json:"action"`
+	TargetType string            `json:"target_type"`
+	TargetID   string            `json:"target_id"`
+	IP         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	RequestID  string            `json:"request_id"`
+	Details    map[string]string `json:"details,omitempty"`
+}
+
+// AuditFilter narrows the audit log; empty fields match everything. Action
+// matches exactly or, when it ends in ".*", by prefix.
+type AuditFilter struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+// AuditEventPage is one page of the audit log, newest first by default
+type AuditEventPage struct {
+	Events     []*AuditEvent `json:"events"`
+	NextCursor *string       `json:"next_cursor"`
+}
+
+// UsageMetric is the consumption of one metered resource against its quota
+type UsageMetric struct {
+	Used int64 `json:"used"`
+	// Nil when the resource is unlimited
+	Limit *int64 `json:"limit"`
+}
+
+// Usage is a user's consumption for the current month. Storage and
+// documents cover every document the user uploaded that has not been purged.
+type Usage struct {
+	PeriodStart     time.Time   `json:"period_start"`
+	PeriodEnd       time.Time   `json:"period_end"`
+	StorageBytes    UsageMetric `json:"storage_bytes"`
+	Documents       UsageMetric `json:"documents"`
+	PagesProcessed  UsageMetric `json:"pages_processed"`
+	LLMInputTokens  int64       `json:"llm_input_tokens"`
+	LLMOutputTokens int64       `json:"llm_output_tokens"`
+	// Input and output tokens together, which the quota applies to
+	LLMTokens   UsageMetric `json:"llm_tokens"`
+	Comparisons UsageMetric `json:"comparisons"`
+}
+
+// LLMCall is one request to the language model with the tokens it used and
+// what it cost. Cost is nil for models missing from the pricing table.
+type LLMCall struct {
+	ID               string    `json:"id"`
+	UserID           *string   `json:"user_id"`
+	WorkspaceID      *string   `json:"workspace_id"`
+	DocumentIDs      []string  `json:"document_ids"`
+	ChatMessageID    *string   `json:"chat_message_id,omitempty"`
+	ComparisonID     *string   `json:"comparison_id,omitempty"`
+	Operation        string    `json:"operation"`
+	Model            string    `json:"model"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	LatencyMs        int64     `json:"latency_ms"`
+	CostUSD          *float64  `json:"cost_usd"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// LLMUsageRow totals the LLM calls of one user, document or day
+type LLMUsageRow struct {
+	Key              string  `json:"key"`
+	Calls            int64   `json:"calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	AvgLatencyMs     int64   `json:"avg_latency_ms"`
+	CostUSD          float64 `json:"cost_usd"`
+	// Calls left out of cost_usd because their model has no price
+	UnpricedCalls int64 `json:"unpriced_calls"`
+}
+
+// LLMUsageReport groups a workspace's LLM calls by user, document or day.
+// Calls about several documents count in full towards each of them.
+type LLMUsageReport struct {
+	GroupBy string         `json:"group_by"`
+	Rows    []*LLMUsageRow `json:"rows"`
+	Total   LLMUsageRow    `json:"total"`
+}
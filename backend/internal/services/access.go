@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"strategy-analyst/internal/models"
+)
+
+// Documents, folders, tags and collection chats belong to a workspace, and
+// what a user may do with them follows from their role in that workspace. A
+// single document can also be shared with users outside its workspace.
+// AccessPolicy is the one place that decides this; services call it before
+// touching workspace data instead of filtering on the user ID.
+
+// Action is something a user does with the data of a workspace
+type Action string
+
+const (
+	// Read documents, summaries, conversations and analyses
+	ActionView Action = "view"
+	// Ask questions, run analyses and compare documents
+	ActionChat Action = "chat"
+	// Upload, edit, organize, delete and restore documents
+	ActionEdit Action = "edit"
+	// Share documents with other users and create public share links
+	ActionShare Action = "share"
+	// Rename or delete the workspace, manage members and empty the trash
+	ActionManage Action = "manage"
+)
+
+var roleActions = map[models.Role][]Action{
+	models.RoleViewer: {ActionView},
+	models.RoleEditor: {ActionView, ActionChat, ActionEdit, ActionShare},
+	models.RoleOwner:  {ActionView, ActionChat, ActionEdit, ActionShare, ActionManage},
+}
+
+var shareActions = map[models.SharePermission][]Action{
+	models.SharePermissionView: {ActionView},
+	models.SharePermissionChat: {ActionView, ActionChat},
+}
+
+// Requests authenticated with an API key are further limited to the actions
+// of the key's scope
+var scopeActions = map[models.APIKeyScope][]Action{
+	models.APIKeyScopeReadOnly: {ActionView},
+	models.APIKeyScopeChat:     {ActionView, ActionChat},
+	models.APIKeyScopeFull:     {ActionView, ActionChat, ActionEdit, ActionShare, ActionManage},
+}
+
+type apiKeyScopeKey struct{}
+
+// WithAPIKeyScope marks ctx as belonging to a request authenticated with an
+// API key of the given scope
+func WithAPIKeyScope(ctx context.Context, scope models.APIKeyScope) context.Context {
+	return context.WithValue(ctx, apiKeyScopeKey{}, scope)
+}
+
+// APIKeyScopeFrom returns the scope of the API key a request was
+// authenticated with, if it was
+func APIKeyScopeFrom(ctx context.Context) (models.APIKeyScope, bool) {
+	scope, ok := ctx.Value(apiKeyScopeKey{}).(models.APIKeyScope)
+	return scope, ok
+}
+
+// CheckScope fails with ErrForbidden if the request was authenticated with
+// an API key whose scope does not allow action
+func CheckScope(ctx context.Context, action Action) error {
+	scope, ok := APIKeyScopeFrom(ctx)
+	if !ok || slices.Contains(scopeActions[scope], action) {
+		return nil
+	}
+	return fmt.Errorf("%w: an API key with %s scope cannot %s", ErrForbidden, scope, action)
+}
+
+// ErrForbidden is returned (wrapped) when a workspace member's role does not
+// allow an action. Users outside the workspace get "not found" instead, so
+// that IDs of other workspaces' data are not confirmed.
+var ErrForbidden = errors.New("forbidden")
+
+// RoleAllows reports whether role grants action
+func RoleAllows(role models.Role, action Action) bool {
+	return slices.Contains(roleActions[role], action)
+}
+
+// ShareAllows reports whether a document share with permission grants action
+func ShareAllows(permission models.SharePermission, action Action) bool {
+	return slices.Contains(shareActions[permission], action)
+}
+
+type AccessPolicy struct {
+	db *sql.DB
+}
+
+func NewAccessPolicy(db *sql.DB) *AccessPolicy {
+	return &AccessPolicy{db: db}
+}
+
+// Role returns the user's role in a workspace, or "" if they are not a member
+func (p *AccessPolicy) Role(ctx context.Context, userID, workspaceID string) (models.Role, error) {
+	var role models.Role
+	query := `SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`
+	err := p.db.QueryRowContext(ctx, query, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspace role: %w", err)
+	}
+	return role, nil
+}
+
+// Authorize checks that the user may perform action in a workspace
+func (p *AccessPolicy) Authorize(ctx context.Context, userID, workspaceID string, action Action) (models.Role, error) {
+	return p.authorize(ctx, userID, workspaceID, action, "workspace")
+}
+
+// AuthorizeResource checks that the user may perform action on a folder or
+// tag of a workspace. Non-members are told the resource does not
+// exist.
+func (p *AccessPolicy) AuthorizeResource(ctx context.Context, userID, workspaceID string, action Action, resource string) error {
+	_, err := p.authorize(ctx, userID, workspaceID, action, resource)
+	return err
+}
+
+// SharePermission returns the permission a document is shared with the user
+// with, or "" if it is not shared with them
+func (p *AccessPolicy) SharePermission(ctx context.Context, userID, documentID string) (models.SharePermission, error) {
+	var permission models.SharePermission
+	query := `SELECT permission FROM document_shares WHERE document_id = $1 AND user_id = $2`
+	err := p.db.QueryRowContext(ctx, query, documentID, userID).Scan(&permission)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get document share: %w", err)
+	}
+	return permission, nil
+}
+
+// AuthorizeDocument checks that the user may perform action on a document,
+// through their role in its workspace or a share of the document itself.
+// Users with neither are told the document does not exist.
+func (p *AccessPolicy) AuthorizeDocument(ctx context.Context, userID, workspaceID, documentID string, action Action) error {
+	role, err := p.Role(ctx, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if RoleAllows(role, action) {
+		return CheckScope(ctx, action)
+	}
+
+	permission, err := p.SharePermission(ctx, userID, documentID)
+	if err != nil {
+		return err
+	}
+	if ShareAllows(permission, action) {
+		return CheckScope(ctx, action)
+	}
+
+	switch {
+	case role != "":
+		return fmt.Errorf("%w: the %s role cannot %s in this workspace", ErrForbidden, role, action)
+	case permission != "":
+		return fmt.Errorf("%w: this document is shared with you for %s only", ErrForbidden, permission)
+	}
+	return fmt.Errorf("document not found")
+}
+
+func (p *AccessPolicy) authorize(ctx context.Context, userID, workspaceID string, action Action, resource string) (models.Role, error) {
+	role, err := p.Role(ctx, userID, workspaceID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", fmt.Errorf("%s not found", resource)
+	}
+	if !RoleAllows(role, action) {
+		return role, fmt.Errorf("%w: the %s role cannot %s in this workspace", ErrForbidden, role, action)
+	}
+	return role, CheckScope(ctx, action)
+}
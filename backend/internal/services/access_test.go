@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"strategy-analyst/internal/models"
+)
+
+var allActions = []Action{ActionView, ActionChat, ActionEdit, ActionShare, ActionManage}
+
+func TestRoleAllows(t *testing.T) {
+	// The actions each role is granted, in the order of allActions
+	tests := []struct {
+		role models.Role
+		want []bool
+	}{
+		{role: models.RoleViewer, want: []bool{true, false, false, false, false}},
+		{role: models.RoleEditor, want: []bool{true, true, true, true, false}},
+		{role: models.RoleOwner, want: []bool{true, true, true, true, true}},
+		{role: "", want: []bool{false, false, false, false, false}},
+		{role: "admin", want: []bool{false, false, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		for i, action := range allActions {
+			if got := RoleAllows(tt.role, action); got != tt.want[i] {
+				t.Errorf("RoleAllows(%q, %q) = %v, want %v", tt.role, action, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestShareAllows(t *testing.T) {
+	tests := []struct {
+		permission models.SharePermission
+		want       []bool
+	}{
+		{permission: models.SharePermissionView, want: []bool{true, false, false, false, false}},
+		{permission: models.SharePermissionChat, want: []bool{true, true, false, false, false}},
+		{permission: "", want: []bool{false, false, false, false, false}},
+		{permission: "edit", want: []bool{false, false, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		for i, action := range allActions {
+			if got := ShareAllows(tt.permission, action); got != tt.want[i] {
+				t.Errorf("ShareAllows(%q, %q) = %v, want %v", tt.permission, action, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckScope(t *testing.T) {
+	// The actions each scope allows, in the order of allActions
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []bool
+	}{
+		{name: "no API key", ctx: context.Background(), want: []bool{true, true, true, true, true}},
+		{name: "read_only", ctx: WithAPIKeyScope(context.Background(), models.APIKeyScopeReadOnly), want: []bool{true, false, false, false, false}},
+		{name: "chat", ctx: WithAPIKeyScope(context.Background(), models.APIKeyScopeChat), want: []bool{true, true, false, false, false}},
+		{name: "full", ctx: WithAPIKeyScope(context.Background(), models.APIKeyScopeFull), want: []bool{true, true, true, true, true}},
+		{name: "unknown scope", ctx: WithAPIKeyScope(context.Background(), "admin"), want: []bool{false, false, false, false, false}},
+	}
+
+	for _, tt := range tests {
+		for i, action := range allActions {
+			err := CheckScope(tt.ctx, action)
+			if tt.want[i] && err != nil {
+				t.Errorf("%s: CheckScope(%q) = %v, want nil", tt.name, action, err)
+			}
+			if !tt.want[i] && !errors.Is(err, ErrForbidden) {
+				t.Errorf("%s: CheckScope(%q) = %v, want ErrForbidden", tt.name, action, err)
+			}
+		}
+	}
+}
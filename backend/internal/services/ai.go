@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt" // Formatted I/O operations
 	"strategy-analyst/internal/models"
 	"strings"
@@ -13,20 +14,41 @@ import (
 
 type AIService struct {
 	client *genai.Client
+	// Meters tokens to the user set with WithUsageOwner; may be nil
+	usage *UsageService
 }
 
-func NewAIService(apiKey string) *AIService {
+func NewAIService(apiKey string, usage *UsageService) *AIService {
 	if apiKey == "" {
-		return &AIService{client: nil}
+		return &AIService{client: nil, usage: usage}
 	}
 
 	client, err := genai.NewClient(context.Background(), option.WithAPIKey(apiKey))
 	if err != nil {
 		fmt.Printf("Error creating Gemini client: %v\n", err)
-		return &AIService{client: nil}
+		return &AIService{client: nil, usage: usage}
 	}
 
-	return &AIService{client: client}
+	return &AIService{client: client, usage: usage}
+}
+
+// Every call goes to this model
+const geminiModel = "gemini-2.0-flash-exp"
+
+// generate sends a prompt to the model and records the call, its tokens and
+// its latency under operation
+func (ai *AIService) generate(ctx context.Context, operation string, model *genai.GenerativeModel, prompt string) (*genai.GenerateContentResponse, error) {
+	started := time.Now()
+	response, err := model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return nil, err
+	}
+	if ai.usage != nil && response.UsageMetadata != nil {
+		metadata := response.UsageMetadata
+		ai.usage.RecordLLMCall(ctx, operation, geminiModel, int64(metadata.PromptTokenCount),
+			int64(metadata.CandidatesTokenCount), int64(metadata.TotalTokenCount), time.Since(started))
+	}
+	return response, nil
 }
 
 func (ai *AIService) GenerateInsight(ctx context.Context, query string, documentChunks []string, documentName string) (string, error) {
@@ -34,8 +56,7 @@ func (ai *AIService) GenerateInsight(ctx context.Context, query string, document
 		return "", fmt.Errorf("AI client not initialized")
 	}
 
-	// Use Gemini 2.0 Flash model
-	model := ai.client.GenerativeModel("gemini-2.0-flash-exp")
+	model := ai.client.GenerativeModel(geminiModel)
 
 	// Configure the model for better strategic analysis
 	model.SetTemperature(0.3)
@@ -47,7 +68,7 @@ func (ai *AIService) GenerateInsight(ctx context.Context, query string, document
 	prompt := ai.buildPrompt(query, documentChunks, documentName)
 
 	// Generate response
-	response, err := model.GenerateContent(ctx, genai.Text(prompt))
+	response, err := ai.generate(ctx, "chat", model, prompt)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate content: %w", err)
 	}
@@ -95,6 +116,332 @@ func (ai *AIService) buildPrompt(query string, documentChunks []string, document
 	return prompt.String()
 }
 
+// GenerateDocumentSummary produces the executive summary and key facts that are
+// stored alongside a document after ingestion
+func (ai *AIService) GenerateDocumentSummary(ctx context.Context, documentChunks []string, documentName string) (*models.DocumentSummary, error) {
+	if ai.client == nil {
+		return nil, fmt.Errorf("AI client not initialized")
+	}
+
+	model := ai.client.GenerativeModel(geminiModel)
+
+	// Low temperature and JSON output so the result can be stored as-is
+	model.SetTemperature(0.2)
+	model.SetTopK(40)
+	model.SetTopP(0.95)
+	model.SetMaxOutputTokens(2048)
+	model.ResponseMIMEType = "application/json"
+
+	prompt := ai.buildSummaryPrompt(documentChunks, documentName)
+
+	response, err := ai.generate(ctx, "summary", model, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate summary: %w", err)
+	}
+
+	text, err := extractResponseText(response)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.DocumentSummary{}
+	if err := json.Unmarshal([]byte(text), summary); err != nil {
+		return nil, fmt.Errorf("failed to parse summary response: %w", err)
+	}
+
+	if strings.TrimSpace(summary.ExecutiveSummary) == "" {
+		return nil, fmt.Errorf("summary response did not contain an executive summary")
+	}
+
+	// Never hand nil slices to the JSONB columns
+	if summary.KeyEntities == nil {
+		summary.KeyEntities = []string{}
+	}
+	if summary.KeyFigures == nil {
+		summary.KeyFigures = []models.KeyFigure{}
+	}
+	if summary.SuggestedQuestions == nil {
+		summary.SuggestedQuestions = []string{}
+	}
+
+	return summary, nil
+}
+
+func (ai *AIService) buildSummaryPrompt(documentChunks []string, documentName string) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("You are a Strategic Insight Analyst. Read the business document below and produce a briefing for an executive who has not read it.\n\n")
+
+	prompt.WriteString("INSTRUCTIONS:\n")
+	prompt.WriteString("1. Base everything ONLY on the provided document content\n")
+	prompt.WriteString("2. executive_summary: 3-5 short paragraphs covering purpose, key findings and implications\n")
+	prompt.WriteString("3. description: a single sentence describing what the document is\n")
+	prompt.WriteString("4. key_entities: up to 15 important companies, people, products or places\n")
+	prompt.WriteString("5. key_figures: up to 10 important numbers, each with a label, the value as written, and a short context\n")
+	prompt.WriteString("6. suggested_questions: 5 questions a strategist would ask about this document\n\n")
+
+	prompt.WriteString("Respond with a JSON object of the form:\n")
+	prompt.WriteString(`{"executive_summary": "", "description": "", "key_entities": [""], "key_figures": [{"label": "", "value": "", "context": ""}], "suggested_questions": [""]}`)
+	prompt.WriteString("\n\n")
+
+	prompt.WriteString(fmt.Sprintf("DOCUMENT: %s\n\n", documentName))
+
+	prompt.WriteString("DOCUMENT CONTENT:\n")
+	for i, chunk := range documentChunks {
+		prompt.WriteString(fmt.Sprintf("--- Chunk %d ---\n%s\n\n", i+1, chunk))
+	}
+
+	return prompt.String()
+}
+
+// GenerateAnalysis runs a strategic analysis template against the document and
+// returns output shaped by the template's sections
+func (ai *AIService) GenerateAnalysis(ctx context.Context, template *models.AnalysisTemplate, documentChunks []string, documentName string) (map[string]interface{}, error) {
+	if ai.client == nil {
+		return nil, fmt.Errorf("AI client not initialized")
+	}
+
+	model := ai.client.GenerativeModel(geminiModel)
+
+	model.SetTemperature(0.3)
+	model.SetTopK(40)
+	model.SetTopP(0.95)
+	model.SetMaxOutputTokens(4096)
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = analysisSchema(template)
+
+	var prompt strings.Builder
+	prompt.WriteString("You are a Strategic Insight Analyst. Produce a structured analysis of the business document below.\n\n")
+	prompt.WriteString(fmt.Sprintf("ANALYSIS: %s\n", template.Title))
+	if template.Instructions != "" {
+		prompt.WriteString(fmt.Sprintf("TASK: %s\n", template.Instructions))
+	}
+	prompt.WriteString("\nINSTRUCTIONS:\n")
+	prompt.WriteString("1. Base your analysis ONLY on the provided document content\n")
+	prompt.WriteString("2. Leave a section empty rather than inventing content the document does not support\n")
+	prompt.WriteString("3. Keep each item concise and specific\n\n")
+	prompt.WriteString("SECTIONS:\n")
+	for _, section := range template.Sections {
+		prompt.WriteString(fmt.Sprintf("- %s: %s\n", section.Key, section.Description))
+	}
+	prompt.WriteString(fmt.Sprintf("\nDOCUMENT: %s\n\n", documentName))
+	prompt.WriteString("DOCUMENT CONTENT:\n")
+	for i, chunk := range documentChunks {
+		prompt.WriteString(fmt.Sprintf("--- Chunk %d ---\n%s\n\n", i+1, chunk))
+	}
+
+	response, err := ai.generate(ctx, "analysis", model, prompt.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate analysis: %w", err)
+	}
+
+	text, err := extractResponseText(response)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse analysis response: %w", err)
+	}
+
+	return result, nil
+}
+
+// analysisSchema translates template sections into a response schema so the
+// model's output is typed the same way as the template
+func analysisSchema(template *models.AnalysisTemplate) *genai.Schema {
+	schema := &genai.Schema{
+		Type:       genai.TypeObject,
+		Properties: make(map[string]*genai.Schema),
+	}
+
+	for _, section := range template.Sections {
+		var property *genai.Schema
+		switch section.Type {
+		case "list":
+			property = &genai.Schema{
+				Type:  genai.TypeArray,
+				Items: &genai.Schema{Type: genai.TypeString},
+			}
+		case "table":
+			row := &genai.Schema{
+				Type:       genai.TypeObject,
+				Properties: make(map[string]*genai.Schema),
+				Required:   section.Fields,
+			}
+			for _, field := range section.Fields {
+				row.Properties[field] = &genai.Schema{Type: genai.TypeString}
+			}
+			property = &genai.Schema{Type: genai.TypeArray, Items: row}
+		default:
+			property = &genai.Schema{Type: genai.TypeString}
+		}
+		property.Description = section.Description
+
+		schema.Properties[section.Key] = property
+		schema.Required = append(schema.Required, section.Key)
+	}
+
+	return schema
+}
+
+// ExtractedFacts is the raw entity and metric extraction for a group of chunks.
+// Chunk refers to the 1-based chunk label used in the prompt.
+type ExtractedFacts struct {
+	Entities []struct {
+		Name  string `json:"name"`
+		Type  string `json:"type"`
+		Chunk int    `json:"chunk"`
+	} `json:"entities"`
+	Metrics []struct {
+		Name      string  `json:"name"`
+		Value     float64 `json:"value"`
+		ValueText string  `json:"value_text"`
+		Unit      string  `json:"unit"`
+		Period    string  `json:"period"`
+		Context   string  `json:"context"`
+		Chunk     int     `json:"chunk"`
+	} `json:"metrics"`
+}
+
+// ExtractFacts pulls named entities and numeric metrics out of a group of chunks
+func (ai *AIService) ExtractFacts(ctx context.Context, documentChunks []string, documentName string) (*ExtractedFacts, error) {
+	if ai.client == nil {
+		return nil, fmt.Errorf("AI client not initialized")
+	}
+
+	model := ai.client.GenerativeModel(geminiModel)
+
+	model.SetTemperature(0.1)
+	model.SetTopK(40)
+	model.SetTopP(0.95)
+	model.SetMaxOutputTokens(8192)
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"entities": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"name":  {Type: genai.TypeString},
+						"type":  {Type: genai.TypeString, Enum: []string{"company", "person", "product", "location"}},
+						"chunk": {Type: genai.TypeInteger},
+					},
+					Required: []string{"name", "type", "chunk"},
+				},
+			},
+			"metrics": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"name":       {Type: genai.TypeString},
+						"value":      {Type: genai.TypeNumber},
+						"value_text": {Type: genai.TypeString},
+						"unit":       {Type: genai.TypeString},
+						"period":     {Type: genai.TypeString},
+						"context":    {Type: genai.TypeString},
+						"chunk":      {Type: genai.TypeInteger},
+					},
+					Required: []string{"name", "value", "value_text", "unit", "period", "chunk"},
+				},
+			},
+		},
+		Required: []string{"entities", "metrics"},
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("You extract structured facts from business documents.\n\n")
+	prompt.WriteString("INSTRUCTIONS:\n")
+	prompt.WriteString("1. entities: every company, person, product and location that is named. Use the most complete form of the name\n")
+	prompt.WriteString("2. metrics: every numeric business figure (revenue, profit, margin, headcount, market share, growth, ...)\n")
+	prompt.WriteString("3. name: a short lowercase metric name such as \"revenue\" or \"operating margin\"\n")
+	prompt.WriteString("4. value: the number expanded to full units (\"$1.2 billion\" becomes 1200000000, \"12%\" becomes 12)\n")
+	prompt.WriteString("5. value_text: the figure exactly as written; unit: currency code or unit such as USD, %, employees\n")
+	prompt.WriteString("6. period: the period the figure refers to such as FY2023, Q2 2024 or 2023; empty if not stated\n")
+	prompt.WriteString("7. context: a short phrase saying what the figure measures\n")
+	prompt.WriteString("8. chunk: the number of the chunk the fact was found in\n")
+	prompt.WriteString("9. Only extract facts that are present in the content\n\n")
+	prompt.WriteString(fmt.Sprintf("DOCUMENT: %s\n\n", documentName))
+	prompt.WriteString("DOCUMENT CONTENT:\n")
+	for i, chunk := range documentChunks {
+		prompt.WriteString(fmt.Sprintf("--- Chunk %d ---\n%s\n\n", i+1, chunk))
+	}
+
+	response, err := ai.generate(ctx, "fact_extraction", model, prompt.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract facts: %w", err)
+	}
+
+	text, err := extractResponseText(response)
+	if err != nil {
+		return nil, err
+	}
+
+	facts := &ExtractedFacts{}
+	if err := json.Unmarshal([]byte(text), facts); err != nil {
+		return nil, fmt.Errorf("failed to parse extraction response: %w", err)
+	}
+
+	return facts, nil
+}
+
+// SummarizeSection condenses a group of chunks (or of lower-level summaries)
+// into a single dense summary. It is the map and reduce step of hierarchical
+// summarization for documents that do not fit in one prompt.
+func (ai *AIService) SummarizeSection(ctx context.Context, sections []string, documentName string) (string, error) {
+	if ai.client == nil {
+		return "", fmt.Errorf("AI client not initialized")
+	}
+
+	model := ai.client.GenerativeModel(geminiModel)
+
+	model.SetTemperature(0.1)
+	model.SetTopK(40)
+	model.SetTopP(0.95)
+	model.SetMaxOutputTokens(2048)
+
+	var prompt strings.Builder
+	prompt.WriteString("You are condensing part of a long business document so it can be analysed later without the original text.\n\n")
+	prompt.WriteString("INSTRUCTIONS:\n")
+	prompt.WriteString("1. Write a dense, factual summary of the content below\n")
+	prompt.WriteString("2. Preserve every figure, date, name, commitment and risk that is mentioned\n")
+	prompt.WriteString("3. Keep the order in which topics appear\n")
+	prompt.WriteString("4. Do not add information that is not in the content\n\n")
+	prompt.WriteString(fmt.Sprintf("DOCUMENT: %s\n\n", documentName))
+	prompt.WriteString("CONTENT:\n")
+	for i, section := range sections {
+		prompt.WriteString(fmt.Sprintf("--- Part %d ---\n%s\n\n", i+1, section))
+	}
+	prompt.WriteString("SUMMARY:\n")
+
+	response, err := ai.generate(ctx, "section_summary", model, prompt.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize section: %w", err)
+	}
+
+	return extractResponseText(response)
+}
+
+// extractResponseText concatenates the text parts of the first candidate
+func extractResponseText(response *genai.GenerateContentResponse) (string, error) {
+	if len(response.Candidates) == 0 || response.Candidates[0].Content == nil || len(response.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no response generated")
+	}
+
+	var result strings.Builder
+	for _, part := range response.Candidates[0].Content.Parts {
+		if textPart, ok := part.(genai.Text); ok {
+			result.WriteString(string(textPart))
+		}
+	}
+
+	return result.String(), nil
+}
+
 func (ai *AIService) Close() {
 	if ai.client != nil {
 		ai.client.Close()
@@ -107,8 +454,7 @@ func (ai *AIService) CompareDocuments(ctx context.Context, documents []*models.D
 		return nil, fmt.Errorf("AI client not initialized")
 	}
 
-	// Use Gemini 2.0 Flash model
-	model := ai.client.GenerativeModel("gemini-2.0-flash-exp")
+	model := ai.client.GenerativeModel(geminiModel)
 
 	// Configure the model for document comparison
 	model.SetTemperature(0.4)
@@ -120,7 +466,7 @@ func (ai *AIService) CompareDocuments(ctx context.Context, documents []*models.D
 	prompt := ai.buildComparisonPrompt(documents, documentsChunks, compareType)
 
 	// Generate response
-	response, err := model.GenerateContent(ctx, genai.Text(prompt))
+	response, err := ai.generate(ctx, "comparison", model, prompt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate comparison: %w", err)
 	}
@@ -172,12 +518,10 @@ func (ai *AIService) buildComparisonPrompt(documents []*models.Document, documen
 	prompt.WriteString("\nDOCUMENTS TO COMPARE:\n")
 
 	for i, doc := range documents {
-		prompt.WriteString(fmt.Sprintf("\n--- DOCUMENT %d: %s ---\n", i+1, doc.FileName))
-		chunks := documentsChunks[i]
-		for j, chunk := range chunks {
-			if j < 10 { // Limit chunks to prevent token overflow
-				prompt.WriteString(fmt.Sprintf("Content Part %d: %s\n\n", j+1, chunk))
-			}
+		prompt.WriteString(fmt.Sprintf("\n--- DOCUMENT %d: %s ---\n", i+1, doc.DisplayName()))
+		// Chunks have already been fitted to the context budget by the caller
+		for j, chunk := range documentsChunks[i] {
+			prompt.WriteString(fmt.Sprintf("Content Part %d: %s\n\n", j+1, chunk))
 		}
 	}
 
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+type AnalysisService struct {
+	db              *sql.DB
+	documentService *DocumentService
+	aiService       *AIService
+	summarizer      *SummarizationService
+	templates       map[string]*models.AnalysisTemplate
+}
+
+func NewAnalysisService(db *sql.DB, documentService *DocumentService, aiService *AIService, summarizer *SummarizationService, templates map[string]*models.AnalysisTemplate) *AnalysisService {
+	return &AnalysisService{
+		db:              db,
+		documentService: documentService,
+		aiService:       aiService,
+		summarizer:      summarizer,
+		templates:       templates,
+	}
+}
+
+// Templates returns the available analysis templates ordered by name
+func (as *AnalysisService) Templates() []*models.AnalysisTemplate {
+	templates := make([]*models.AnalysisTemplate, 0, len(as.templates))
+	for _, template := range as.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+// CreateAnalysis runs the named template against a document and persists the result
+func (as *AnalysisService) CreateAnalysis(ctx context.Context, documentID, userID, templateName string) (*models.DocumentAnalysis, error) {
+	template, ok := as.templates[templateName]
+	if !ok {
+		return nil, fmt.Errorf("unknown analysis template: %s", templateName)
+	}
+
+	document, err := as.documentService.AuthorizeDocument(ctx, documentID, userID, ActionChat)
+	if err != nil {
+		return nil, err
+	}
+	if err := as.documentService.checkLLMQuota(ctx, userID, false); err != nil {
+		return nil, err
+	}
+	ctx = WithUsageOwner(ctx, userID)
+	ctx = WithLLMLink(ctx, LLMLink{WorkspaceID: document.WorkspaceID, DocumentIDs: []string{documentID}})
+
+	chunks, err := as.documentService.GetDocumentChunks(ctx, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("document is still being processed, please try again in a moment")
+	}
+
+	chunkTexts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		chunkTexts = append(chunkTexts, chunk.Content)
+	}
+
+	chunkTexts, err = as.summarizer.FitContext(ctx, document, chunkTexts, as.summarizer.ContextBudget())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare document context: %w", err)
+	}
+
+	result, err := as.aiService.GenerateAnalysis(ctx, template, chunkTexts, document.DisplayName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate analysis: %w", err)
+	}
+
+	analysis := &models.DocumentAnalysis{
+		ID:         uuid.New().String(),
+		DocumentID: documentID,
+		UserID:     userID,
+		Template:   *template,
+		Result:     result,
+	}
+
+	templateJSON, err := json.Marshal(analysis.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode analysis template: %w", err)
+	}
+	resultJSON, err := json.Marshal(analysis.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode analysis result: %w", err)
+	}
+
+	query := `INSERT INTO document_analyses (id, document_id, user_id, template_name, template_definition, result, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP) RETURNING created_at`
+	err = as.db.QueryRowContext(ctx, query, analysis.ID, documentID, userID, template.Name, templateJSON, resultJSON).Scan(&analysis.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store analysis: %w", err)
+	}
+
+	return analysis, nil
+}
+
+// GetAnalyses lists the analyses of a document, newest first. Analyses are
+// visible to everyone who can view the document.
+func (as *AnalysisService) GetAnalyses(ctx context.Context, documentID, userID string) ([]*models.DocumentAnalysis, error) {
+	if _, err := as.documentService.GetDocument(ctx, documentID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, document_id, user_id, template_definition, result, created_at FROM document_analyses WHERE document_id = $1 ORDER BY created_at DESC`
+	rows, err := as.db.QueryContext(ctx, query, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query analyses: %w", err)
+	}
+	defer rows.Close()
+
+	analyses := []*models.DocumentAnalysis{}
+	for rows.Next() {
+		analysis, err := scanAnalysis(rows)
+		if err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, analysis)
+	}
+
+	return analyses, rows.Err()
+}
+
+func (as *AnalysisService) GetAnalysis(ctx context.Context, documentID, analysisID, userID string) (*models.DocumentAnalysis, error) {
+	if _, err := as.documentService.GetDocument(ctx, documentID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, document_id, user_id, template_definition, result, created_at FROM document_analyses WHERE id = $1 AND document_id = $2`
+	analysis, err := scanAnalysis(as.db.QueryRowContext(ctx, query, analysisID, documentID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("analysis not found")
+		}
+		return nil, err
+	}
+
+	return analysis, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAnalysis(row rowScanner) (*models.DocumentAnalysis, error) {
+	analysis := &models.DocumentAnalysis{}
+	var templateJSON, resultJSON []byte
+	if err := row.Scan(&analysis.ID, &analysis.DocumentID, &analysis.UserID, &templateJSON, &resultJSON, &analysis.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan analysis: %w", err)
+	}
+
+	if err := json.Unmarshal(templateJSON, &analysis.Template); err != nil {
+		return nil, fmt.Errorf("failed to decode analysis template: %w", err)
+	}
+	if err := json.Unmarshal(resultJSON, &analysis.Result); err != nil {
+		return nil, fmt.Errorf("failed to decode analysis result: %w", err)
+	}
+
+	return analysis, nil
+}
+
+// RenderAnalysisMarkdown renders an analysis as a Markdown report, following
+// the section order of the template it was generated with
+func RenderAnalysisMarkdown(analysis *models.DocumentAnalysis, documentName string) string {
+	var md strings.Builder
+
+	md.WriteString(fmt.Sprintf("# %s: %s\n\n", analysis.Template.Title, documentName))
+	md.WriteString(fmt.Sprintf("_Generated %s_\n\n", analysis.CreatedAt.Format("2006-01-02 15:04 MST")))
+
+	for _, section := range analysis.Template.Sections {
+		md.WriteString(fmt.Sprintf("## %s\n\n", section.Title))
+		value := analysis.Result[section.Key]
+
+		switch section.Type {
+		case "list":
+			items, _ := value.([]interface{})
+			if len(items) == 0 {
+				md.WriteString("_None identified._\n\n")
+				continue
+			}
+			for _, item := range items {
+				md.WriteString(fmt.Sprintf("- %v\n", item))
+			}
+			md.WriteString("\n")
+		case "table":
+			rows, _ := value.([]interface{})
+			if len(rows) == 0 {
+				md.WriteString("_None identified._\n\n")
+				continue
+			}
+			md.WriteString("| " + strings.Join(section.Fields, " | ") + " |\n")
+			md.WriteString("|" + strings.Repeat(" --- |", len(section.Fields)) + "\n")
+			for _, row := range rows {
+				cells, _ := row.(map[string]interface{})
+				values := make([]string, len(section.Fields))
+				for i, field := range section.Fields {
+					values[i] = markdownCell(fmt.Sprint(cells[field]))
+					if cells[field] == nil {
+						values[i] = ""
+					}
+				}
+				md.WriteString("| " + strings.Join(values, " | ") + " |\n")
+			}
+			md.WriteString("\n")
+		default:
+			text, _ := value.(string)
+			if strings.TrimSpace(text) == "" {
+				text = "_Not available._"
+			}
+			md.WriteString(text + "\n\n")
+		}
+	}
+
+	return md.String()
+}
+
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"strategy-analyst/internal/models"
+)
+
+var templateKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// builtinAnalysisTemplates are always available. Templates loaded from the
+// configured file are added to these and replace them when names collide.
+var builtinAnalysisTemplates = []models.AnalysisTemplate{
+	{
+		Name:         "swot",
+		Title:        "SWOT Analysis",
+		Description:  "Strengths, weaknesses, opportunities and threats",
+		Instructions: "Identify the internal strengths and weaknesses and the external opportunities and threats of the organisation described in the document.",
+		Sections: []models.AnalysisSection{
+			{Key: "strengths", Title: "Strengths", Description: "Internal attributes that give an advantage", Type: "list"},
+			{Key: "weaknesses", Title: "Weaknesses", Description: "Internal attributes that put it at a disadvantage", Type: "list"},
+			{Key: "opportunities", Title: "Opportunities", Description: "External factors it could exploit", Type: "list"},
+			{Key: "threats", Title: "Threats", Description: "External factors that could cause trouble", Type: "list"},
+			{Key: "summary", Title: "Summary", Description: "Overall strategic position in one paragraph", Type: "text"},
+		},
+	},
+	{
+		Name:         "pestle",
+		Title:        "PESTLE Analysis",
+		Description:  "Political, economic, social, technological, legal and environmental factors",
+		Instructions: "Identify the macro-environmental factors that affect the organisation or market described in the document.",
+		Sections: []models.AnalysisSection{
+			{Key: "political", Title: "Political", Description: "Government policy, stability, trade and tax", Type: "list"},
+			{Key: "economic", Title: "Economic", Description: "Growth, inflation, interest and exchange rates", Type: "list"},
+			{Key: "social", Title: "Social", Description: "Demographics, culture and consumer attitudes", Type: "list"},
+			{Key: "technological", Title: "Technological", Description: "Innovation, automation and technology change", Type: "list"},
+			{Key: "legal", Title: "Legal", Description: "Regulation, compliance and litigation", Type: "list"},
+			{Key: "environmental", Title: "Environmental", Description: "Climate, sustainability and resources", Type: "list"},
+			{Key: "summary", Title: "Summary", Description: "Most significant factors in one paragraph", Type: "text"},
+		},
+	},
+	{
+		Name:         "five_forces",
+		Title:        "Porter's Five Forces",
+		Description:  "Competitive intensity of the industry",
+		Instructions: "Assess each of Porter's five competitive forces for the industry described in the document. Rate each force as low, medium or high.",
+		Sections: []models.AnalysisSection{
+			{Key: "competitive_rivalry", Title: "Competitive Rivalry", Description: "Intensity of competition among existing players", Type: "table", Fields: []string{"factor", "intensity", "evidence"}},
+			{Key: "threat_of_new_entrants", Title: "Threat of New Entrants", Description: "How easily new competitors can enter", Type: "table", Fields: []string{"factor", "intensity", "evidence"}},
+			{Key: "threat_of_substitutes", Title: "Threat of Substitutes", Description: "Availability of alternative products or services", Type: "table", Fields: []string{"factor", "intensity", "evidence"}},
+			{Key: "buyer_power", Title: "Bargaining Power of Buyers", Description: "Ability of customers to drive prices down", Type: "table", Fields: []string{"factor", "intensity", "evidence"}},
+			{Key: "supplier_power", Title: "Bargaining Power of Suppliers", Description: "Ability of suppliers to drive costs up", Type: "table", Fields: []string{"factor", "intensity", "evidence"}},
+			{Key: "overall_assessment", Title: "Overall Assessment", Description: "Overall attractiveness of the industry", Type: "text"},
+		},
+	},
+	{
+		Name:         "risk_register",
+		Title:        "Risk Register",
+		Description:  "Risks with likelihood, impact and mitigations",
+		Instructions: "Extract every risk mentioned or clearly implied by the document. Rate likelihood and impact as low, medium or high.",
+		Sections: []models.AnalysisSection{
+			{Key: "risks", Title: "Risks", Description: "Identified risks", Type: "table", Fields: []string{"risk", "category", "likelihood", "impact", "mitigation", "owner"}},
+			{Key: "summary", Title: "Summary", Description: "Overall risk profile in one paragraph", Type: "text"},
+		},
+	},
+	{
+		Name:         "okrs",
+		Title:        "OKR Extraction",
+		Description:  "Objectives and measurable key results",
+		Instructions: "Extract the objectives stated or implied by the document and the measurable key results attached to each. Use one row per key result.",
+		Sections: []models.AnalysisSection{
+			{Key: "key_results", Title: "Objectives and Key Results", Description: "One row per key result", Type: "table", Fields: []string{"objective", "key_result", "target", "timeframe"}},
+			{Key: "gaps", Title: "Gaps", Description: "Objectives that lack measurable key results", Type: "list"},
+		},
+	},
+}
+
+// LoadAnalysisTemplates returns the built-in templates merged with the ones
+// defined in the JSON file at path. An empty path loads only the built-ins.
+func LoadAnalysisTemplates(path string) (map[string]*models.AnalysisTemplate, error) {
+	templates := make(map[string]*models.AnalysisTemplate)
+	for i := range builtinAnalysisTemplates {
+		template := builtinAnalysisTemplates[i]
+		templates[template.Name] = &template
+	}
+
+	if path == "" {
+		return templates, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return templates, fmt.Errorf("failed to read analysis templates file: %w", err)
+	}
+
+	var custom []models.AnalysisTemplate
+	if err := json.Unmarshal(content, &custom); err != nil {
+		return templates, fmt.Errorf("failed to parse analysis templates file: %w", err)
+	}
+
+	for i := range custom {
+		template := custom[i]
+		if err := validateAnalysisTemplate(&template); err != nil {
+			return templates, fmt.Errorf("invalid analysis template %q: %w", template.Name, err)
+		}
+		templates[template.Name] = &template
+	}
+
+	return templates, nil
+}
+
+func validateAnalysisTemplate(template *models.AnalysisTemplate) error {
+	if !templateKeyPattern.MatchString(template.Name) {
+		return fmt.Errorf("name must be lowercase letters, digits and underscores")
+	}
+	if strings.TrimSpace(template.Title) == "" {
+		template.Title = template.Name
+	}
+	if len(template.Sections) == 0 {
+		return fmt.Errorf("at least one section is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, section := range template.Sections {
+		if !templateKeyPattern.MatchString(section.Key) {
+			return fmt.Errorf("section key %q must be lowercase letters, digits and underscores", section.Key)
+		}
+		if seen[section.Key] {
+			return fmt.Errorf("duplicate section key %q", section.Key)
+		}
+		seen[section.Key] = true
+
+		switch section.Type {
+		case "text", "list":
+		case "table":
+			if len(section.Fields) == 0 {
+				return fmt.Errorf("table section %q needs at least one field", section.Key)
+			}
+			for _, field := range section.Fields {
+				if !templateKeyPattern.MatchString(field) {
+					return fmt.Errorf("field %q of section %q must be lowercase letters, digits and underscores", field, section.Key)
+				}
+			}
+		default:
+			return fmt.Errorf("section %q has unknown type %q", section.Key, section.Type)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+const (
+	// Every key starts with this, so leaked keys are easy to search for
+	apiKeyPrefix = "sak_"
+	// Characters of a key, after apiKeyPrefix, shown in listings
+	apiKeyVisibleChars   = 8
+	maxAPIKeyNameLength  = 100
+	maxAPIKeysPerUser    = 25
+	apiKeyLastUsedWindow = "1 minute"
+)
+
+type APIKeyService struct {
+	db *sql.DB
+}
+
+func NewAPIKeyService(db *sql.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// hashAPIKey returns the stored form of an API key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// requireInteractive refuses requests that were themselves authenticated with
+// an API key, so a leaked key cannot be used to mint or revoke others
+func requireInteractive(ctx context.Context) error {
+	if _, ok := APIKeyScopeFrom(ctx); ok {
+		return fmt.Errorf("%w: API keys cannot manage API keys", ErrForbidden)
+	}
+	return nil
+}
+
+// CreateAPIKey creates a key for the user. The key is only returned here.
+func (ks *APIKeyService) CreateAPIKey(ctx context.Context, userID string, req models.CreateAPIKeyRequest) (*models.APIKey, error) {
+	if err := requireInteractive(ctx); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("key name is required")
+	}
+	if len(name) > maxAPIKeyNameLength {
+		return nil, fmt.Errorf("invalid key name")
+	}
+	if _, ok := scopeActions[req.Scope]; !ok {
+		return nil, fmt.Errorf("invalid scope %q: must be read_only, chat or full", req.Scope)
+	}
+
+	var active int
+	query := `SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`
+	if err := ks.db.QueryRowContext(ctx, query, userID).Scan(&active); err != nil {
+		return nil, fmt.Errorf("failed to count API keys: %w", err)
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, fmt.Errorf("invalid request: at most %d active API keys are allowed", maxAPIKeysPerUser)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := &models.APIKey{
+		ID:    uuid.New().String(),
+		Name:  name,
+		Key:   apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret),
+		Scope: req.Scope,
+	}
+	key.Prefix = key.Key[:len(apiKeyPrefix)+apiKeyVisibleChars]
+
+	query = `INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scope, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP) RETURNING created_at`
+	err := ks.db.QueryRowContext(ctx, query, key.ID, userID, key.Name, key.Prefix, hashAPIKey(key.Key), key.Scope).Scan(&key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the user's keys, revoked ones included, newest first
+func (ks *APIKeyService) ListAPIKeys(ctx context.Context, userID string) ([]*models.APIKey, error) {
+	query := `SELECT id, name, prefix, scope, created_at, last_used_at, revoked_at
+		FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := ks.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key := &models.APIKey{}
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Scope, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey disables one of the user's keys immediately
+func (ks *APIKeyService) RevokeAPIKey(ctx context.Context, keyID, userID string) error {
+	if err := requireInteractive(ctx); err != nil {
+		return err
+	}
+
+	query := `UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	result, err := ks.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("API key not found")
+	}
+	return nil
+}
+
+// VerifyAPIKey returns the key and the ID and email of its user if key is a
+// valid, unrevoked API key. The last-used time is recorded at most once a
+// minute per key.
+func (ks *APIKeyService) VerifyAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, nil, fmt.Errorf("invalid API key")
+	}
+
+	apiKey := &models.APIKey{}
+	user := &models.User{}
+	query := `SELECT k.id, k.name, k.prefix, k.scope, k.created_at, k.last_used_at, u.id, u.email
+		FROM api_keys k JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL`
+	err := ks.db.QueryRowContext(ctx, query, hashAPIKey(key)).
+		Scan(&apiKey.ID, &apiKey.Name, &apiKey.Prefix, &apiKey.Scope, &apiKey.CreatedAt, &apiKey.LastUsedAt, &user.ID, &user.Email)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("invalid API key")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify API key: %w", err)
+	}
+
+	query = `UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '` + apiKeyLastUsedWindow + `')`
+	if _, err := ks.db.ExecContext(ctx, query, apiKey.ID); err != nil {
+		fmt.Printf("Failed to record use of API key %s: %v\n", apiKey.ID, err)
+	}
+
+	return apiKey, user, nil
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Entries whose declared size is more than this many times their compressed
+// size are treated as zip bombs
+const maxCompressionRatio = 100
+
+// ErrArchiveLimit is returned (wrapped) when an archive has too many entries
+// or too much uncompressed content
+var ErrArchiveLimit = errors.New("archive exceeds the extraction limits")
+
+// ErrInvalidArchive is returned (wrapped) when a file is not a readable ZIP or
+// tar.gz archive
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Errors of rejected entries
+var (
+	ErrUnsafeEntryPath  = errors.New("unsafe path in archive")
+	ErrCompressionRatio = errors.New("entry compression ratio is suspiciously high")
+)
+
+// ArchiveLimits bound what WalkArchive will extract
+type ArchiveLimits struct {
+	// Maximum number of file entries
+	MaxEntries int
+	// Maximum uncompressed size of a single entry
+	MaxEntryBytes int64
+	// Maximum uncompressed size of all entries together
+	MaxTotalBytes int64
+}
+
+// ArchiveEntry is a regular file inside an archive. Err is set, and Content
+// is nil, when the entry was rejected before being read.
+type ArchiveEntry struct {
+	Name    string
+	Content io.Reader
+	Err     error
+}
+
+// IsArchive reports whether WalkArchive can unpack a file of this name
+func IsArchive(fileName string) bool {
+	name := strings.ToLower(fileName)
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// WalkArchive calls fn for every regular file in a ZIP or tar.gz archive.
+// Entry content is only valid during the call. Entry names are cleaned and
+// never used as file system paths; names that try to escape the archive root
+// are rejected anyway. Directories, links and OS metadata files are skipped.
+// Exceeding the entry count or total size stops the walk with ErrArchiveLimit.
+func WalkArchive(fileName string, content io.Reader, limits ArchiveLimits, fn func(entry ArchiveEntry)) error {
+	w := &archiveWalker{limits: limits, fn: fn}
+
+	if strings.HasSuffix(strings.ToLower(fileName), ".zip") {
+		return w.walkZip(content)
+	}
+	return w.walkTarGz(content)
+}
+
+type archiveWalker struct {
+	limits    ArchiveLimits
+	fn        func(entry ArchiveEntry)
+	entries   int
+	extracted int64
+}
+
+func (w *archiveWalker) walkZip(content io.Reader) error {
+	// The ZIP directory is at the end of the file, so it needs random access
+	spool, err := os.CreateTemp("", "upload-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, content)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	reader, err := zip.NewReader(spool, size)
+	if err != nil {
+		return fmt.Errorf("%w: ZIP: %w", ErrInvalidArchive, err)
+	}
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		name, ok := w.admit(file.Name)
+		if !ok {
+			continue
+		}
+		if err := w.countEntry(); err != nil {
+			return err
+		}
+
+		if name == "" {
+			w.fn(ArchiveEntry{Name: file.Name, Err: ErrUnsafeEntryPath})
+			continue
+		}
+		if w.limits.MaxEntryBytes > 0 && file.UncompressedSize64 > uint64(w.limits.MaxEntryBytes) {
+			w.fn(ArchiveEntry{Name: name, Err: fmt.Errorf("entry: %w", ErrFileTooLarge)})
+			continue
+		}
+		if file.CompressedSize64 > 0 && file.UncompressedSize64/file.CompressedSize64 > maxCompressionRatio {
+			w.fn(ArchiveEntry{Name: name, Err: ErrCompressionRatio})
+			continue
+		}
+
+		entryReader, err := file.Open()
+		if err != nil {
+			w.fn(ArchiveEntry{Name: name, Err: fmt.Errorf("failed to open entry: %w", err)})
+			continue
+		}
+		w.fn(ArchiveEntry{Name: name, Content: w.limit(entryReader)})
+		entryReader.Close()
+
+		if err := w.checkTotal(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *archiveWalker) walkTarGz(content io.Reader) error {
+	gz, err := gzip.NewReader(content)
+	if err != nil {
+		return fmt.Errorf("%w: gzip: %w", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: tar: %w", ErrInvalidArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, ok := w.admit(header.Name)
+		if !ok {
+			continue
+		}
+		if err := w.countEntry(); err != nil {
+			return err
+		}
+
+		if name == "" {
+			w.fn(ArchiveEntry{Name: header.Name, Err: ErrUnsafeEntryPath})
+			continue
+		}
+		if w.limits.MaxEntryBytes > 0 && header.Size > w.limits.MaxEntryBytes {
+			w.fn(ArchiveEntry{Name: name, Err: fmt.Errorf("entry: %w", ErrFileTooLarge)})
+			continue
+		}
+
+		w.fn(ArchiveEntry{Name: name, Content: w.limit(reader)})
+
+		if err := w.checkTotal(); err != nil {
+			return err
+		}
+	}
+}
+
+// admit cleans an entry name. It returns ok=false for entries that are
+// silently ignored and an empty name for entries that are unsafe.
+func (w *archiveWalker) admit(rawName string) (string, bool) {
+	name := strings.ReplaceAll(rawName, "\\", "/")
+	base := path.Base(name)
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(base, "._") || base == ".DS_Store" {
+		return "", false
+	}
+
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, ":") {
+		return "", true
+	}
+	return clean, true
+}
+
+func (w *archiveWalker) countEntry() error {
+	w.entries++
+	if w.limits.MaxEntries > 0 && w.entries > w.limits.MaxEntries {
+		return fmt.Errorf("more than %d entries: %w", w.limits.MaxEntries, ErrArchiveLimit)
+	}
+	return nil
+}
+
+func (w *archiveWalker) checkTotal() error {
+	if w.limits.MaxTotalBytes > 0 && w.extracted > w.limits.MaxTotalBytes {
+		return fmt.Errorf("more than %d bytes uncompressed: %w", w.limits.MaxTotalBytes, ErrArchiveLimit)
+	}
+	return nil
+}
+
+// limit caps an entry at the per-entry limit, whatever its header claims, and
+// counts what is actually read towards the total
+func (w *archiveWalker) limit(r io.Reader) io.Reader {
+	limit := w.limits.MaxEntryBytes
+	if w.limits.MaxTotalBytes > 0 {
+		remaining := w.limits.MaxTotalBytes - w.extracted
+		if limit <= 0 || remaining < limit {
+			limit = max(remaining, 1)
+		}
+	}
+	return &totalCounter{reader: LimitUpload(r, limit), total: &w.extracted}
+}
+
+type totalCounter struct {
+	reader io.Reader
+	total  *int64
+}
+
+func (t *totalCounter) Read(p []byte) (int, error) {
+	n, err := t.reader.Read(p)
+	*t.total += int64(n)
+	return n, err
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type archiveFile struct {
+	name    string
+	content string
+	// Compress the entry in ZIP archives instead of storing it
+	deflate bool
+}
+
+func buildZip(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, file := range files {
+		method := zip.Store
+		if file.deflate {
+			method = zip.Deflate
+		}
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: file.name, Method: method})
+		if err != nil {
+			t.Fatalf("failed to add %s to ZIP: %v", file.name, err)
+		}
+		if _, err := io.WriteString(entry, file.content); err != nil {
+			t.Fatalf("failed to write %s to ZIP: %v", file.name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close ZIP: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("failed to add %s to tar: %v", file.name, err)
+		}
+		if _, err := io.WriteString(writer, file.content); err != nil {
+			t.Fatalf("failed to write %s to tar: %v", file.name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWalkArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []archiveFile
+		limits  ArchiveLimits
+		zipOnly bool
+		// "<name>=<content>" for entries read in full, "<name>!<error>" for
+		// rejected entries and entries whose content failed to read
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "regular entries are cleaned and read",
+			files: []archiveFile{{name: "reports/./q1.txt", content: "first"}, {name: "q2.pdf", content: "second"}},
+			want:  []string{"reports/q1.txt=first", "q2.pdf=second"},
+		},
+		{
+			name:  "metadata files are skipped",
+			files: []archiveFile{{name: "__MACOSX/._a.txt", content: "x"}, {name: "._b.txt", content: "x"}, {name: "c.txt", content: "kept"}},
+			want:  []string{"c.txt=kept"},
+		},
+		{
+			name:  "traversal entry",
+			files: []archiveFile{{name: "../x.txt", content: "escape"}, {name: "docs/../../y.txt", content: "escape"}, {name: "ok.txt", content: "fine"}},
+			want:  []string{"../x.txt!unsafe path in archive", "docs/../../y.txt!unsafe path in archive", "ok.txt=fine"},
+		},
+		{
+			name:  "absolute path",
+			files: []archiveFile{{name: "/etc/passwd.txt", content: "root"}, {name: "C:/report.txt", content: "drive"}},
+			want:  []string{"/etc/passwd.txt!unsafe path in archive", "C:/report.txt!unsafe path in archive"},
+		},
+		{
+			name:    "over-ratio entry",
+			files:   []archiveFile{{name: "bomb.txt", content: strings.Repeat("0", 1<<20), deflate: true}, {name: "ok.txt", content: "fine"}},
+			zipOnly: true,
+			want:    []string{"bomb.txt!entry compression ratio is suspiciously high", "ok.txt=fine"},
+		},
+		{
+			name:   "entry over the size limit",
+			files:  []archiveFile{{name: "big.txt", content: strings.Repeat("a", 11)}, {name: "small.txt", content: strings.Repeat("b", 10)}},
+			limits: ArchiveLimits{MaxEntryBytes: 10},
+			want:   []string{"big.txt!entry: file exceeds the maximum upload size", "small.txt=" + strings.Repeat("b", 10)},
+		},
+		{
+			name:   "entry count at the limit",
+			files:  []archiveFile{{name: "a.txt", content: "a"}, {name: "b.txt", content: "b"}},
+			limits: ArchiveLimits{MaxEntries: 2},
+			want:   []string{"a.txt=a", "b.txt=b"},
+		},
+		{
+			name:    "entry count over the limit",
+			files:   []archiveFile{{name: "a.txt", content: "a"}, {name: "b.txt", content: "b"}, {name: "c.txt", content: "c"}},
+			limits:  ArchiveLimits{MaxEntries: 2},
+			want:    []string{"a.txt=a", "b.txt=b"},
+			wantErr: ErrArchiveLimit,
+		},
+		{
+			name:   "total bytes at the limit",
+			files:  []archiveFile{{name: "a.txt", content: strings.Repeat("a", 6)}, {name: "b.txt", content: strings.Repeat("b", 4)}},
+			limits: ArchiveLimits{MaxTotalBytes: 10},
+			want:   []string{"a.txt=aaaaaa", "b.txt=bbbb"},
+		},
+		{
+			name:    "total bytes over the limit",
+			files:   []archiveFile{{name: "a.txt", content: strings.Repeat("a", 6)}, {name: "b.txt", content: strings.Repeat("b", 6)}, {name: "c.txt", content: "c"}},
+			limits:  ArchiveLimits{MaxTotalBytes: 10},
+			want:    []string{"a.txt=aaaaaa", "b.txt!file exceeds the maximum upload size"},
+			wantErr: ErrArchiveLimit,
+		},
+	}
+
+	formats := []struct {
+		fileName string
+		build    func(*testing.T, []archiveFile) []byte
+	}{
+		{"upload.zip", buildZip},
+		{"upload.tar.gz", buildTarGz},
+	}
+
+	for _, tt := range tests {
+		for _, format := range formats {
+			if tt.zipOnly && format.fileName != "upload.zip" {
+				continue
+			}
+			t.Run(tt.name+"/"+format.fileName, func(t *testing.T) {
+				var got []string
+				err := WalkArchive(format.fileName, bytes.NewReader(format.build(t, tt.files)), tt.limits, func(entry ArchiveEntry) {
+					if entry.Err != nil {
+						got = append(got, entry.Name+"!"+entry.Err.Error())
+						return
+					}
+					content, err := io.ReadAll(entry.Content)
+					if err != nil {
+						got = append(got, entry.Name+"!"+err.Error())
+						return
+					}
+					got = append(got, entry.Name+"="+string(content))
+				})
+
+				if tt.wantErr == nil && err != nil {
+					t.Fatalf("WalkArchive() error = %v, want none", err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("WalkArchive() error = %v, want %v", err, tt.wantErr)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("WalkArchive() entries = %q, want %q", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkArchiveRejectsInvalidArchives(t *testing.T) {
+	// A valid gzip stream that does not hold a tar archive
+	var notTar bytes.Buffer
+	gz := gzip.NewWriter(&notTar)
+	io.WriteString(gz, strings.Repeat("not a tar header ", 64))
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip: %v", err)
+	}
+
+	tests := []struct {
+		fileName string
+		content  []byte
+	}{
+		{"upload.zip", []byte("not a zip file")},
+		{"upload.tar.gz", []byte("not a gzip stream")},
+		{"upload.tgz", notTar.Bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			err := WalkArchive(tt.fileName, bytes.NewReader(tt.content), ArchiveLimits{}, func(entry ArchiveEntry) {
+				t.Errorf("unexpected entry %q", entry.Name)
+			})
+			if !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("WalkArchive() error = %v, want ErrInvalidArchive", err)
+			}
+		})
+	}
+}
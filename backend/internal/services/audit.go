@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+// Longest user agent kept in the audit log
+const maxAuditUserAgentLength = 512
+
+type AuditService struct {
+	db     *sql.DB
+	access *AccessPolicy
+}
+
+func NewAuditService(db *sql.DB) *AuditService {
+	return &AuditService{db: db, access: NewAccessPolicy(db)}
+}
+
+// Record appends an event to the audit log. If the event has no workspace it
+// is taken from the target when that is a workspace, document, folder, tag or
+// share link. The actor's email is stored as it is now, so the log still
+// names them after their account is gone. Recording is not cancelled with
+// ctx, so an event is not lost when the client disconnects.
+func (as *AuditService) Record(ctx context.Context, event *models.AuditEvent) error {
+	ctx = context.WithoutCancel(ctx)
+
+	details := []byte("{}")
+	if len(event.Details) > 0 {
+		var err error
+		if details, err = json.Marshal(event.Details); err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+	}
+	userAgent := event.UserAgent
+	if len(userAgent) > maxAuditUserAgentLength {
+		userAgent = userAgent[:maxAuditUserAgentLength]
+	}
+
+	event.ID = uuid.New().String()
+	query := `INSERT INTO audit_events (id, occurred_at, actor_id, actor_email, api_key_id, workspace_id,
+			action, target_type, target_id, ip, user_agent, request_id, details)
+		VALUES ($1, CURRENT_TIMESTAMP, $2::text, (SELECT email FROM users WHERE id = $2::text), $3,
+			COALESCE($4::text,
+				CASE WHEN $6::text = 'workspace' THEN $7::text END,
+				(SELECT workspace_id FROM documents WHERE $6::text = 'document' AND id = $7::text),
+				(SELECT workspace_id FROM folders WHERE $6::text = 'folder' AND id = $7::text),
+				(SELECT workspace_id FROM tags WHERE $6::text = 'tag' AND id = $7::text),
+				(SELECT d.workspace_id FROM share_links l JOIN documents d ON d.id = l.document_id
+					WHERE $6::text = 'share_link' AND l.id = $7::text)),
+			$5, $6::text, $7::text, $8, $9, $10, $11)
+		RETURNING occurred_at, actor_email, workspace_id`
+	err := as.db.QueryRowContext(ctx, query, event.ID, event.ActorID, event.APIKeyID, event.WorkspaceID,
+		event.Action, event.TargetType, event.TargetID, event.IP, userAgent, event.RequestID, string(details)).
+		Scan(&event.OccurredAt, &event.ActorEmail, &event.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+const auditEventColumns = `id, occurred_at, actor_id, actor_email, api_key_id, workspace_id, action,
+	target_type, target_id, ip, user_agent, request_id, details`
+
+func scanAuditEvent(row rowScanner) (*models.AuditEvent, error) {
+	event := &models.AuditEvent{}
+	var details []byte
+	err := row.Scan(&event.ID, &event.OccurredAt, &event.ActorID, &event.ActorEmail, &event.APIKeyID, &event.WorkspaceID,
+		&event.Action, &event.TargetType, &event.TargetID, &event.IP, &event.UserAgent, &event.RequestID, &details)
+	if err != nil {
+		return nil, err
+	}
+	if len(details) > 0 {
+		if err := json.Unmarshal(details, &event.Details); err != nil {
+			return nil, fmt.Errorf("failed to decode audit details: %w", err)
+		}
+	}
+	return event, nil
+}
+
+// auditConditions builds the WHERE clause shared by ListEvents and
+// ExportEvents
+func auditConditions(workspaceID string, filter models.AuditFilter) ([]string, []interface{}) {
+	conditions := []string{"workspace_id = $1"}
+	args := []interface{}{workspaceID}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.ActorID != "" {
+		addCondition("actor_id = $%d", filter.ActorID)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, ".*"); ok {
+		addCondition("action LIKE $%d || '.%%'", prefix)
+	} else if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if filter.TargetType != "" {
+		addCondition("target_type = $%d", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		addCondition("target_id = $%d", filter.TargetID)
+	}
+	if filter.Since != nil {
+		addCondition("occurred_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		addCondition("occurred_at < $%d", *filter.Until)
+	}
+
+	return conditions, args
+}
+
+// ListEvents returns one page of a workspace's audit log. Only owners may
+// read it.
+func (as *AuditService) ListEvents(ctx context.Context, userID, workspaceID string, filter models.AuditFilter, page models.PageRequest) (*models.AuditEventPage, error) {
+	if _, err := as.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+		return nil, err
+	}
+
+	if page.Sort == "" {
+		page.Sort = "occurred_at"
+	}
+	if page.Sort != "occurred_at" {
+		return nil, fmt.Errorf("invalid sort %q", page.Sort)
+	}
+	page, err := normalizePage(page, "desc")
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(page.Cursor, page.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := auditConditions(workspaceID, filter)
+	where := strings.Join(conditions, " AND ")
+	if cursor != nil {
+		args = append(args, cursor.Value, cursor.ID)
+		where += " AND " + keysetCondition("occurred_at", "::timestamp", "id", page.Order, len(args)-1, len(args))
+	}
+	args = append(args, page.Limit+1)
+
+	query := `SELECT ` + auditEventColumns + `, occurred_at::text FROM audit_events WHERE ` + where +
+		fmt.Sprintf(` ORDER BY occurred_at %s, id %s LIMIT $%d`, page.Order, page.Order, len(args))
+	rows, err := as.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	result := &models.AuditEventPage{Events: []*models.AuditEvent{}}
+	var lastSortValue string
+	for rows.Next() {
+		var sortValue string
+		event, err := scanAuditEvent(rowWithExtra{row: rows, extra: []interface{}{&sortValue}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if len(result.Events) == page.Limit {
+			// One row past the limit means there is another page
+			last := result.Events[len(result.Events)-1]
+			next := encodeCursor(pageCursor{Sort: page.Sort, Value: lastSortValue, ID: last.ID})
+			result.NextCursor = &next
+			break
+		}
+		result.Events = append(result.Events, event)
+		lastSortValue = sortValue
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit events: %w", err)
+	}
+
+	return result, nil
+}
+
+// ExportEvents calls fn with every matching event of a workspace's audit log,
+// oldest first, without holding them all in memory. Only owners may export.
+func (as *AuditService) ExportEvents(ctx context.Context, userID, workspaceID string, filter models.AuditFilter, fn func(*models.AuditEvent) error) error {
+	if _, err := as.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+		return err
+	}
+
+	conditions, args := auditConditions(workspaceID, filter)
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY occurred_at, id`
+	rows, err := as.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+// Uploaded files are stored once per distinct content under their SHA-256
+// (see BlobObjectName). The blobs table counts the documents referencing each
+// object so it is only deleted when the last of them goes away.
+
+// acquireBlob records one more reference to an uploaded blob. A blob that was
+// unreferenced may have been deleted from storage by the purger after
+// UploadFile found it present, so its object is checked once any queued
+// deletion has been cancelled.
+func (ds *DocumentService) acquireBlob(ctx context.Context, tx *sql.Tx, uploaded *UploadedFile) error {
+	var refCount int
+	query := `INSERT INTO blobs (sha256, storage_path, size_bytes, ref_count, created_at)
+		VALUES ($1, $2, $3, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (sha256) DO UPDATE SET ref_count = blobs.ref_count + 1
+		RETURNING ref_count`
+	if err := tx.QueryRowContext(ctx, query, uploaded.SHA256, uploaded.Path, uploaded.Size).Scan(&refCount); err != nil {
+		return fmt.Errorf("failed to reference blob: %w", err)
+	}
+	if refCount > 1 {
+		return nil
+	}
+
+	// Waits for the purger if it is deleting the object right now
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pending_storage_deletions WHERE object_name = $1`, uploaded.Path); err != nil {
+		return fmt.Errorf("failed to cancel blob deletion: %w", err)
+	}
+	exists, err := ds.storageService.ObjectExists(ctx, uploaded.Path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("uploaded file was removed from storage concurrently, please retry")
+	}
+	return nil
+}
+
+// releaseBlob drops the reference a document stored at storagePath holds on
+// a blob and, once no document references it any more, queues the object for
+// deletion when tx commits. It reports false if the document's file is not a
+// counted blob, as for files stored under their own name before blobs were
+// introduced; the caller then owns the object alone.
+func releaseBlob(ctx context.Context, tx *sql.Tx, sha256Hex, storagePath string) (bool, error) {
+	var refCount int
+	query := `UPDATE blobs SET ref_count = ref_count - 1 WHERE sha256 = $1 AND storage_path = $2 RETURNING ref_count`
+	err := tx.QueryRowContext(ctx, query, sha256Hex, storagePath).Scan(&refCount)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to release blob %s: %w", sha256Hex, err)
+	}
+
+	if refCount > 0 {
+		return true, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM blobs WHERE sha256 = $1`, sha256Hex); err != nil {
+		return false, fmt.Errorf("failed to delete blob record: %w", err)
+	}
+	return true, queueStorageDeletion(ctx, tx, storagePath, false)
+}
+
+// discardUnreferencedBlob removes a freshly uploaded blob after the document
+// insert failed, unless another document already references the same content
+func (ds *DocumentService) discardUnreferencedBlob(ctx context.Context, uploaded *UploadedFile) {
+	var exists bool
+	err := ds.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM blobs WHERE sha256 = $1)`, uploaded.SHA256).Scan(&exists)
+	if err != nil || exists {
+		return
+	}
+
+	if err := ds.storageService.DeleteFile(ctx, uploaded.Path); err != nil {
+		fmt.Printf("Warning: failed to cleanup uploaded file: %v\n", err)
+	}
+}
+
+// findProcessedDuplicate returns another document of the same workspace with
+// the same content that already has chunks, or "" if there is none. Reuse is
+// limited to the workspace so it cannot reveal what others have uploaded.
+func (ds *DocumentService) findProcessedDuplicate(ctx context.Context, doc *models.Document) (string, error) {
+	if doc.SHA256 == nil {
+		return "", nil
+	}
+
+	var duplicateID string
+	query := `SELECT d.id FROM documents d
+		WHERE d.workspace_id = $1 AND d.sha256 = $2 AND d.id <> $3 AND d.deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM document_chunks c WHERE c.document_id = d.id)
+		ORDER BY d.uploaded_at LIMIT 1`
+	err := ds.db.QueryRowContext(ctx, query, doc.WorkspaceID, *doc.SHA256, doc.ID).Scan(&duplicateID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query duplicates: %w", err)
+	}
+	return duplicateID, nil
+}
+
+// reuseProcessedDocument is the ingestion path for a duplicate upload: it
+// copies the source document's extracted data and only runs the stages the
+// source has not finished. If copying fails the document is processed from
+// scratch instead.
+func (ds *DocumentService) reuseProcessedDocument(ctx context.Context, doc *models.Document, sourceID string) {
+	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
+
+	copied, err := ds.copyProcessedData(ctx, sourceID, doc.ID)
+	if err != nil {
+		log.Printf(logPrefix+"Reusing processed data of %s failed, processing from scratch: %v\n", sourceID, err)
+		ds.processDocument(ctx, doc)
+		return
+	}
+	log.Printf(logPrefix+"Reused processed data of identical document %s\n", sourceID)
+
+	// Page images are cached per document
+	ds.generateThumbnail(ctx, doc)
+
+	if !copied.summary {
+		ds.generateDocumentSummary(ctx, doc)
+	}
+	if !copied.facts {
+		ds.extractEntitiesAndMetrics(ctx, doc)
+	}
+}
+
+type copiedData struct {
+	summary bool
+	facts   bool
+}
+
+// copyProcessedData copies chunks, PDF metadata, tables, summaries, entities
+// and metrics from one document to another in a single transaction
+func (ds *DocumentService) copyProcessedData(ctx context.Context, sourceID, targetID string) (copied copiedData, err error) {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return copied, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE documents d SET title = s.title, author = s.author,
+			pdf_created_at = s.pdf_created_at, pdf_modified_at = s.pdf_modified_at, page_count = s.page_count,
+			outline = s.outline, is_encrypted = s.is_encrypted, is_image_only = s.is_image_only
+		FROM documents s WHERE d.id = $1 AND s.id = $2`, targetID, sourceID)
+	if err != nil {
+		return copied, fmt.Errorf("failed to copy metadata: %w", err)
+	}
+
+	chunkIDs, err := copyChunks(ctx, tx, sourceID, targetID)
+	if err != nil {
+		return copied, err
+	}
+
+	if _, err := copyRows(ctx, tx, "document_tables", []string{"page_number", "table_index", "rows"}, sourceID, targetID, chunkIDs); err != nil {
+		return copied, err
+	}
+	entities, err := copyRows(ctx, tx, "document_entities", []string{"name", "entity_type", "mentions"}, sourceID, targetID, chunkIDs)
+	if err != nil {
+		return copied, err
+	}
+	metrics, err := copyRows(ctx, tx, "document_metrics", []string{"name", "value", "value_text", "unit", "period", "context"}, sourceID, targetID, chunkIDs)
+	if err != nil {
+		return copied, err
+	}
+	copied.facts = entities+metrics > 0
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO document_summaries
+			(document_id, executive_summary, description, key_entities, key_figures, suggested_questions, generated_at)
+		SELECT $1, executive_summary, description, key_entities, key_figures, suggested_questions, generated_at
+		FROM document_summaries WHERE document_id = $2`, targetID, sourceID)
+	if err != nil {
+		return copied, fmt.Errorf("failed to copy summary: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil {
+		copied.summary = n > 0
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO document_summary_nodes (document_id, level, group_chars, group_index, source_hash, content, created_at)
+		SELECT $1, level, group_chars, group_index, source_hash, content, created_at
+		FROM document_summary_nodes WHERE document_id = $2`, targetID, sourceID)
+	if err != nil {
+		return copied, fmt.Errorf("failed to copy summary cache: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return copied, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return copied, nil
+}
+
+// copyChunks copies every chunk and returns the new chunk ID for each old one
+func copyChunks(ctx context.Context, tx *sql.Tx, sourceID, targetID string) (map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, chunk_index, content, embedding FROM document_chunks WHERE document_id = $1`, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+
+	type chunkRow struct {
+		id        string
+		index     int
+		content   string
+		embedding []byte
+	}
+	var chunks []chunkRow
+	for rows.Next() {
+		var c chunkRow
+		if err := rows.Scan(&c.id, &c.index, &c.content, &c.embedding); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("source document has no chunks")
+	}
+
+	chunkIDs := make(map[string]string, len(chunks))
+	for _, c := range chunks {
+		newID := uuid.New().String()
+		_, err := tx.ExecContext(ctx, `INSERT INTO document_chunks (id, document_id, chunk_index, content, embedding, created_at)
+			VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)`, newID, targetID, c.index, c.content, c.embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy chunk %d: %w", c.index, err)
+		}
+		chunkIDs[c.id] = newID
+	}
+
+	return chunkIDs, nil
+}
+
+// copyRows copies the rows of a per-document table that carries an id and a
+// nullable chunk_id, giving each copy a new id and remapping its chunk
+func copyRows(ctx context.Context, tx *sql.Tx, table string, columns []string, sourceID, targetID string, chunkIDs map[string]string) (int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT chunk_id, `+strings.Join(columns, ", ")+` FROM `+table+` WHERE document_id = $1`, sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+
+	var records [][]interface{}
+	for rows.Next() {
+		var chunkID sql.NullString
+		values := make([]interface{}, len(columns))
+		dest := []interface{}{&chunkID}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+
+		var newChunkID interface{}
+		if id, ok := chunkIDs[chunkID.String]; chunkID.Valid && ok {
+			newChunkID = id
+		}
+		records = append(records, append([]interface{}{uuid.New().String(), targetID, newChunkID}, values...))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+
+	placeholders := make([]string, len(columns)+3)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	insert := `INSERT INTO ` + table + ` (id, document_id, chunk_id, ` + strings.Join(columns, ", ") + `)
+		VALUES (` + strings.Join(placeholders, ", ") + `)`
+
+	for _, record := range records {
+		if _, err := tx.ExecContext(ctx, insert, record...); err != nil {
+			return 0, fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+	}
+
+	return len(records), nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -16,17 +17,24 @@ type ChatService struct {
 	db              *sql.DB
 	documentService *DocumentService
 	aiService       *AIService
+	summarizer      *SummarizationService
 }
 
-func NewChatService(db *sql.DB, documentService *DocumentService, aiService *AIService) *ChatService {
+func NewChatService(db *sql.DB, documentService *DocumentService, aiService *AIService, summarizer *SummarizationService) *ChatService {
 	return &ChatService{
 		db:              db,
 		documentService: documentService,
 		aiService:       aiService,
+		summarizer:      summarizer,
 	}
 }
 
-func (cs *ChatService) GetChatHistory(ctx context.Context, documentID, userID string) ([]*models.ChatMessage, error) {
+// GetChatHistory returns one page of a document's chat history, oldest first
+// unless page.Order is "desc". The conversation is shared by everyone who can
+// view the document and each message records its author; messages from before
+// conversations were shared are only visible to their author. Pages use the
+// same cursor conventions as DocumentService.ListDocuments.
+func (cs *ChatService) GetChatHistory(ctx context.Context, documentID, userID string, page models.PageRequest) (*models.ChatHistoryPage, error) {
 	// Validate inputs
 	if strings.TrimSpace(documentID) == "" {
 		return nil, fmt.Errorf("documentID cannot be empty")
@@ -35,31 +43,87 @@ func (cs *ChatService) GetChatHistory(ctx context.Context, documentID, userID st
 		return nil, fmt.Errorf("userID cannot be empty")
 	}
 
-	// First verify the user owns this document
-	_, err := cs.documentService.GetDocument(ctx, documentID, userID)
+	// First verify the user may view this document
+	_, err := cs.documentService.AuthorizeDocument(ctx, documentID, userID, ActionView)
 	if err != nil {
 		return nil, err
 	}
 
-	// Fixed SQL query formatting to prevent parameter mismatch issues
-	query := "SELECT id, document_id, user_id, message_type, message_content, timestamp FROM chat_history WHERE document_id = $1 AND user_id = $2 ORDER BY timestamp ASC"
-	rows, err := cs.db.QueryContext(ctx, query, documentID, userID)
+	// Chat history is always ordered by time
+	page.Sort = "timestamp"
+	page, err = normalizePage(page, "asc")
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(page.Cursor, page.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.ChatHistoryPage{Messages: []*models.ChatMessage{}}
+	where := "document_id = $1 AND (shared OR user_id = $2)"
+	args := []interface{}{documentID, userID}
+	countQuery := "SELECT COUNT(*) FROM chat_history WHERE " + where
+	if err := cs.db.QueryRowContext(ctx, countQuery, args...).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count chat history: %w", err)
+	}
+
+	if cursor != nil {
+		args = append(args, cursor.Value, cursor.ID)
+		where += " AND " + keysetCondition("timestamp", "::timestamp", "id", page.Order, len(args)-1, len(args))
+	}
+	args = append(args, page.Limit+1)
+
+	query := "SELECT id, document_id, user_id, message_type, message_content, timestamp, timestamp::text FROM chat_history WHERE " + where +
+		fmt.Sprintf(" ORDER BY timestamp %s, id %s LIMIT $%d", page.Order, page.Order, len(args))
+	rows, err := cs.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query chat history: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*models.ChatMessage
+	var lastSortValue string
 	for rows.Next() {
 		msg := &models.ChatMessage{}
-		err := rows.Scan(&msg.ID, &msg.DocumentID, &msg.UserID, &msg.MessageType, &msg.MessageContent, &msg.Timestamp)
+		var sortValue string
+		err := rows.Scan(&msg.ID, &msg.DocumentID, &msg.UserID, &msg.MessageType, &msg.MessageContent, &msg.Timestamp, &sortValue)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan chat message: %w", err)
 		}
-		messages = append(messages, msg)
+		if len(result.Messages) == page.Limit {
+			last := result.Messages[len(result.Messages)-1]
+			next := encodeCursor(pageCursor{Sort: page.Sort, Value: lastSortValue, ID: last.ID})
+			result.NextCursor = &next
+			break
+		}
+		result.Messages = append(result.Messages, msg)
+		lastSortValue = sortValue
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chat history: %w", err)
 	}
 
-	return messages, nil
+	return result, nil
+}
+
+// GetAllChatHistory returns every message GetChatHistory would page through,
+// for callers that do not page
+func (cs *ChatService) GetAllChatHistory(ctx context.Context, documentID, userID string, page models.PageRequest) ([]*models.ChatMessage, error) {
+	page.Limit = MaxPageLimit
+	page.Cursor = ""
+
+	messages := []*models.ChatMessage{}
+	for {
+		result, err := cs.GetChatHistory(ctx, documentID, userID, page)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, result.Messages...)
+		if result.NextCursor == nil {
+			return messages, nil
+		}
+		page.Cursor = *result.NextCursor
+	}
 }
 
 func (cs *ChatService) SendMessage(ctx context.Context, documentID, userID, message string) (*models.ChatResponse, error) {
@@ -74,15 +138,22 @@ func (cs *ChatService) SendMessage(ctx context.Context, documentID, userID, mess
 		return nil, fmt.Errorf("message cannot be empty")
 	}
 
-	// Verify the user owns this document
-	document, err := cs.documentService.GetDocument(ctx, documentID, userID)
+	// Verify the user may chat about this document
+	document, err := cs.documentService.AuthorizeDocument(ctx, documentID, userID, ActionChat)
 	if err != nil {
 		return nil, err
 	}
+	if err := cs.documentService.checkLLMQuota(ctx, userID, false); err != nil {
+		return nil, err
+	}
+	// The AI message's ID is chosen up front so its LLM calls can link to it
+	aiMsgID := uuid.New().String()
+	ctx = WithUsageOwner(ctx, userID)
+	ctx = WithLLMLink(ctx, LLMLink{WorkspaceID: document.WorkspaceID, DocumentIDs: []string{documentID}, ChatMessageID: aiMsgID})
 
 	// Store user message
 	userMsgID := uuid.New().String()
-	userQuery := `INSERT INTO chat_history (id, document_id, user_id, message_type, message_content, timestamp) VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)`
+	userQuery := `INSERT INTO chat_history (id, document_id, user_id, message_type, message_content, shared, timestamp) VALUES ($1, $2, $3, $4, $5, TRUE, CURRENT_TIMESTAMP)`
 	_, err = cs.db.ExecContext(ctx, userQuery, userMsgID, documentID, userID, "user", message)
 	if err != nil {
 		return nil, fmt.Errorf("failed to store user message: %w", err)
@@ -104,35 +175,47 @@ func (cs *ChatService) SendMessage(ctx context.Context, documentID, userID, mess
 		chunkTexts = append(chunkTexts, chunk.Content)
 	}
 
+	// Fall back to hierarchical summaries when the document does not fit
+	chunkTexts, err = cs.summarizer.FitContext(ctx, document, chunkTexts, cs.summarizer.ContextBudget())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare document context: %w", err)
+	}
+
 	// Generate AI response
-	aiResponse, err := cs.aiService.GenerateInsight(ctx, message, chunkTexts, document.FileName)
+	aiResponse, err := cs.aiService.GenerateInsight(ctx, message, chunkTexts, document.DisplayName())
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate AI response: %w", err)
 	}
 
 	// Store AI response
-	aiMsgID := uuid.New().String()
-	aiQuery := `INSERT INTO chat_history (id, document_id, user_id, message_type, message_content, timestamp) VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)`
+	aiQuery := `INSERT INTO chat_history (id, document_id, user_id, message_type, message_content, shared, timestamp) VALUES ($1, $2, $3, $4, $5, TRUE, CURRENT_TIMESTAMP)`
 	_, err = cs.db.ExecContext(ctx, aiQuery, aiMsgID, documentID, userID, "ai", aiResponse)
 	if err != nil {
 		return nil, fmt.Errorf("failed to store AI response: %w", err)
 	}
 
 	return &models.ChatResponse{
+		ID:        aiMsgID,
 		Message:   aiResponse,
 		Timestamp: time.Now(),
 	}, nil
 }
 
+// DeleteChatHistory deletes the user's own messages about a document and,
+// if they may edit it, the rest of the shared conversation. Other users'
+// private messages are kept.
 func (cs *ChatService) DeleteChatHistory(ctx context.Context, documentID, userID string) error {
-	// Verify the user owns this document
-	_, err := cs.documentService.GetDocument(ctx, documentID, userID)
+	_, err := cs.documentService.AuthorizeDocument(ctx, documentID, userID, ActionView)
 	if err != nil {
 		return err
 	}
+	_, err = cs.documentService.AuthorizeDocument(ctx, documentID, userID, ActionEdit)
+	if err != nil && !errors.Is(err, ErrForbidden) {
+		return err
+	}
 
-	query := `DELETE FROM chat_history WHERE document_id = $1 AND user_id = $2`
-	_, err = cs.db.ExecContext(ctx, query, documentID, userID)
+	query := `DELETE FROM chat_history WHERE document_id = $1 AND (user_id = $2 OR (shared AND $3))`
+	_, err = cs.db.ExecContext(ctx, query, documentID, userID, err == nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete chat history: %w", err)
 	}
@@ -141,7 +224,8 @@ func (cs *ChatService) DeleteChatHistory(ctx context.Context, documentID, userID
 }
 
 // CompareDocuments generates AI-powered comparison between multiple documents
-func (cs *ChatService) CompareDocuments(ctx context.Context, documents []*models.Document, documentsChunks [][]string, compareType string) (*models.DocumentComparison, error) {
+// and counts it against the user's comparison quota
+func (cs *ChatService) CompareDocuments(ctx context.Context, userID string, documents []*models.Document, documentsChunks [][]string, compareType string) (*models.DocumentComparison, error) {
 	// Validate inputs
 	if len(documents) < 2 {
 		return nil, fmt.Errorf("at least 2 documents are required for comparison")
@@ -150,12 +234,38 @@ func (cs *ChatService) CompareDocuments(ctx context.Context, documents []*models
 	if cs.aiService == nil {
 		return nil, fmt.Errorf("AI service not available")
 	}
+	if err := cs.documentService.checkLLMQuota(ctx, userID, true); err != nil {
+		return nil, err
+	}
+	comparisonID := uuid.New().String()
+	documentIDs := make([]string, len(documents))
+	for i, doc := range documents {
+		documentIDs[i] = doc.ID
+	}
+	ctx = WithUsageOwner(ctx, userID)
+	ctx = WithLLMLink(ctx, LLMLink{WorkspaceID: documents[0].WorkspaceID, DocumentIDs: documentIDs, ComparisonID: comparisonID})
+
+	// Split the context budget evenly so every document gets a fair share
+	budget := cs.summarizer.DocumentBudget(len(documents))
+	fittedChunks := make([][]string, len(documents))
+	for i, doc := range documents {
+		fitted, err := cs.summarizer.FitContext(ctx, doc, documentsChunks[i], budget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare context for document %s: %w", doc.ID, err)
+		}
+		fittedChunks[i] = fitted
+	}
+	documentsChunks = fittedChunks
 
 	// Generate comparison using AI service
 	comparison, err := cs.aiService.CompareDocuments(ctx, documents, documentsChunks, compareType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate document comparison: %w", err)
 	}
+	comparison.ID = comparisonID
+	if cs.documentService.usage != nil {
+		cs.documentService.usage.RecordComparison(ctx, userID)
+	}
 
 	return comparison, nil
 }
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+// Most documents a collection chat draws context from
+const maxCollectionChatDocuments = 25
+
+// GetCollectionDocuments returns the documents of a workspace in a folder
+// and/or with the given tags
+func (ds *DocumentService) GetCollectionDocuments(ctx context.Context, userID, workspaceID string, scope models.CollectionScope) ([]*models.Document, error) {
+	if scope.IsEmpty() {
+		return nil, fmt.Errorf("collection requires a folder or at least one tag")
+	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+	if scope.FolderID != "" && scope.FolderID != models.RootFolderID {
+		if err := ds.checkFolderInWorkspace(ctx, scope.FolderID, workspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	return ds.GetDocuments(ctx, userID, workspaceID, models.DocumentFilter{Collection: scope})
+}
+
+// collectionScopeKey identifies a scope regardless of tag order or case, so
+// the same collection always finds its chat history
+func collectionScopeKey(scope models.CollectionScope) string {
+	tags := make([]string, 0, len(scope.Tags))
+	for _, tag := range scope.Tags {
+		tags = append(tags, strings.ToLower(strings.TrimSpace(tag)))
+	}
+	sort.Strings(tags)
+
+	key := "folder:" + scope.FolderID
+	if scope.IncludeSubfolders {
+		key += "/*"
+	}
+	return key + "|tags:" + strings.Join(tags, ",")
+}
+
+// GetCollectionChatHistory returns the conversation the members of a
+// workspace held with a collection
+func (cs *ChatService) GetCollectionChatHistory(ctx context.Context, userID, workspaceID string, scope models.CollectionScope) ([]*models.CollectionChatMessage, error) {
+	if scope.IsEmpty() {
+		return nil, fmt.Errorf("collection requires a folder or at least one tag")
+	}
+	if _, err := cs.documentService.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, scope, message_type, message_content, timestamp FROM collection_chat_history
+		WHERE workspace_id = $1 AND scope_key = $2 ORDER BY timestamp ASC`
+	rows, err := cs.db.QueryContext(ctx, query, workspaceID, collectionScopeKey(scope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat history: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*models.CollectionChatMessage{}
+	for rows.Next() {
+		msg := &models.CollectionChatMessage{}
+		var scopeJSON []byte
+		if err := rows.Scan(&msg.ID, &scopeJSON, &msg.MessageType, &msg.MessageContent, &msg.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		if err := json.Unmarshal(scopeJSON, &msg.Collection); err != nil {
+			return nil, fmt.Errorf("failed to decode chat scope: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// SendCollectionMessage answers a question using every processed document of
+// a collection. The context budget is split evenly between the documents.
+func (cs *ChatService) SendCollectionMessage(ctx context.Context, userID, workspaceID string, scope models.CollectionScope, message string) (*models.ChatResponse, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+	if _, err := cs.documentService.access.Authorize(ctx, userID, workspaceID, ActionChat); err != nil {
+		return nil, err
+	}
+	if err := cs.documentService.checkLLMQuota(ctx, userID, false); err != nil {
+		return nil, err
+	}
+	ctx = WithUsageOwner(ctx, userID)
+
+	documents, err := cs.documentService.GetCollectionDocuments(ctx, userID, workspaceID, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("collection has no documents")
+	}
+	if len(documents) > maxCollectionChatDocuments {
+		return nil, fmt.Errorf("collection has %d documents; chat supports at most %d", len(documents), maxCollectionChatDocuments)
+	}
+
+	// Only documents that finished processing contribute
+	var ready []*models.Document
+	var readyChunks [][]string
+	for _, doc := range documents {
+		chunks, err := cs.documentService.GetDocumentChunks(ctx, doc.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chunks for document %s: %w", doc.ID, err)
+		}
+		if len(chunks) == 0 {
+			continue
+		}
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			texts[i] = chunk.Content
+		}
+		ready = append(ready, doc)
+		readyChunks = append(readyChunks, texts)
+	}
+	if len(ready) == 0 {
+		return nil, fmt.Errorf("documents are still being processed, please try again in a moment")
+	}
+
+	aiMsgID := uuid.New().String()
+	readyIDs := make([]string, len(ready))
+	for i, doc := range ready {
+		readyIDs[i] = doc.ID
+	}
+	ctx = WithLLMLink(ctx, LLMLink{WorkspaceID: workspaceID, DocumentIDs: readyIDs, ChatMessageID: aiMsgID})
+
+	budget := cs.summarizer.DocumentBudget(len(ready))
+	var contextChunks []string
+	for i, doc := range ready {
+		fitted, err := cs.summarizer.FitContext(ctx, doc, readyChunks[i], budget)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare context for document %s: %w", doc.ID, err)
+		}
+		for _, chunk := range fitted {
+			contextChunks = append(contextChunks, fmt.Sprintf("[From: %s]\n%s", doc.DisplayName(), chunk))
+		}
+	}
+
+	scopeJSON, err := json.Marshal(scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chat scope: %w", err)
+	}
+	scopeKey := collectionScopeKey(scope)
+
+	if err := cs.storeCollectionMessage(ctx, uuid.New().String(), userID, workspaceID, scopeJSON, scopeKey, "user", message); err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("a collection of %d documents", len(ready))
+	aiResponse, err := cs.aiService.GenerateInsight(ctx, message, contextChunks, label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate AI response: %w", err)
+	}
+
+	if err := cs.storeCollectionMessage(ctx, aiMsgID, userID, workspaceID, scopeJSON, scopeKey, "ai", aiResponse); err != nil {
+		return nil, err
+	}
+
+	return &models.ChatResponse{
+		ID:        aiMsgID,
+		Message:   aiResponse,
+		Timestamp: time.Now(),
+	}, nil
+}
+
+func (cs *ChatService) storeCollectionMessage(ctx context.Context, messageID, userID, workspaceID string, scopeJSON []byte, scopeKey, messageType, content string) error {
+	query := `INSERT INTO collection_chat_history (id, user_id, workspace_id, scope, scope_key, message_type, message_content, timestamp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)`
+	if _, err := cs.db.ExecContext(ctx, query, messageID, userID, workspaceID, scopeJSON, scopeKey, messageType, content); err != nil {
+		return fmt.Errorf("failed to store %s message: %w", messageType, err)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -20,20 +22,41 @@ import (
 type DocumentService struct {
 	db             *sql.DB
 	storageService *StorageService
+	aiService      *AIService
+	summarizer     *SummarizationService
+	pageRenderer   *PageRenderer
+	access         *AccessPolicy
+	usage          *UsageService
 }
 
-func NewDocumentService(db *sql.DB, storageService *StorageService) *DocumentService {
+// NewDocumentService creates the document service. aiService may be nil, in
+// which case documents are processed without generating summaries,
+// pageRenderer may be nil, in which case page images are unavailable, and
+// usage may be nil, in which case no quotas are enforced.
+func NewDocumentService(db *sql.DB, storageService *StorageService, aiService *AIService, summarizer *SummarizationService, pageRenderer *PageRenderer, usage *UsageService) *DocumentService {
 	return &DocumentService{
 		db:             db,
 		storageService: storageService,
+		aiService:      aiService,
+		summarizer:     summarizer,
+		pageRenderer:   pageRenderer,
+		access:         NewAccessPolicy(db),
+		usage:          usage,
 	}
 }
 
-func (ds *DocumentService) CreateDocument(ctx context.Context, userID, fileName string, fileContent io.Reader) (*models.Document, error) {
+// CreateDocument stores the file in a workspace and starts processing it.
+// When reuseProcessed is set and the workspace already has a processed
+// document with identical content, its chunks and extracted data are copied
+// instead of extracting everything again.
+func (ds *DocumentService) CreateDocument(ctx context.Context, userID, workspaceID, fileName string, fileContent io.Reader, reuseProcessed bool) (*models.Document, error) {
 	// Validate inputs
 	if strings.TrimSpace(userID) == "" {
 		return nil, fmt.Errorf("userID cannot be empty")
 	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionEdit); err != nil {
+		return nil, err
+	}
 	if strings.TrimSpace(fileName) == "" {
 		return nil, fmt.Errorf("fileName cannot be empty")
 	}
@@ -49,20 +72,26 @@ func (ds *DocumentService) CreateDocument(ctx context.Context, userID, fileName
 		return nil, fmt.Errorf("storage service is not initialized - please check your GCS configuration")
 	}
 
+	// The size is only known once stored, so quotas are checked before and after
+	if err := ds.checkUploadQuota(ctx, userID, 0, ""); err != nil {
+		return nil, err
+	}
+
 	// Upload file to storage first
-	storagePath, err := ds.storageService.UploadFile(ctx, fileName, fileContent)
+	uploaded, err := ds.storageService.UploadFile(ctx, fileContent)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file to storage: %w", err)
 	}
+	if err := ds.checkUploadQuota(ctx, userID, uploaded.Size, uploaded.SHA256); err != nil {
+		ds.discardUnreferencedBlob(ctx, uploaded)
+		return nil, err
+	}
 
 	// Create document record only after successful upload with proper transaction handling
 	tx, err := ds.db.BeginTx(ctx, nil)
 	if err != nil {
 		// Clean up uploaded file if transaction fails to start
-		cleanupErr := ds.storageService.DeleteFile(ctx, storagePath)
-		if cleanupErr != nil {
-			fmt.Printf("Warning: failed to cleanup uploaded file after transaction error: %v\n", cleanupErr)
-		}
+		ds.discardUnreferencedBlob(ctx, uploaded)
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
@@ -75,52 +104,220 @@ func (ds *DocumentService) CreateDocument(ctx context.Context, userID, fileName
 		}
 	}()
 
-	query := `INSERT INTO documents (id, user_id, file_name, storage_path, uploaded_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
-	_, err = tx.ExecContext(ctx, query, docID, userID, fileName, storagePath)
+	query := `INSERT INTO documents (id, user_id, workspace_id, file_name, storage_path, sha256, size_bytes, uploaded_at) VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)`
+	_, err = tx.ExecContext(ctx, query, docID, userID, workspaceID, fileName, uploaded.Path, uploaded.SHA256, uploaded.Size)
 	if err != nil {
 		// Clean up uploaded file if database insert fails
-		cleanupErr := ds.storageService.DeleteFile(ctx, storagePath)
-		if cleanupErr != nil {
-			fmt.Printf("Warning: failed to cleanup uploaded file after DB error: %v\n", cleanupErr)
-		}
+		ds.discardUnreferencedBlob(ctx, uploaded)
+		return nil, fmt.Errorf("failed to create document record: %w", err)
+	}
+
+	if err = ds.acquireBlob(ctx, tx, uploaded); err != nil {
+		ds.discardUnreferencedBlob(ctx, uploaded)
 		return nil, fmt.Errorf("failed to create document record: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
 		// Clean up uploaded file if commit fails
-		cleanupErr := ds.storageService.DeleteFile(ctx, storagePath)
-		if cleanupErr != nil {
-			fmt.Printf("Warning: failed to cleanup uploaded file after commit error: %v\n", cleanupErr)
-		}
+		ds.discardUnreferencedBlob(ctx, uploaded)
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	// Get the created document
 	doc, err := ds.GetDocument(ctx, docID, userID)
 	if err != nil {
-		// Clean up both storage and database record if retrieval fails
-		cleanupErr := ds.storageService.DeleteFile(ctx, storagePath)
-		if cleanupErr != nil {
-			fmt.Printf("Warning: failed to cleanup uploaded file after retrieval error: %v\n", cleanupErr)
-		}
 		return nil, fmt.Errorf("failed to retrieve created document: %w", err)
 	}
 
-	// Process document content in background
-	go ds.processDocumentContent(context.Background(), doc)
+	duplicateID, err := ds.findProcessedDuplicate(ctx, doc)
+	if err != nil {
+		fmt.Printf("Warning: failed to look up duplicates of document %s: %v\n", docID, err)
+	} else if duplicateID != "" {
+		doc.DuplicateOf = &duplicateID
+	}
+
+	// Process document content in background, metered to the uploader
+	processCtx := WithUsageOwner(context.Background(), userID)
+	processCtx = WithLLMLink(processCtx, LLMLink{WorkspaceID: doc.WorkspaceID, DocumentIDs: []string{doc.ID}})
+	if reuseProcessed && doc.DuplicateOf != nil {
+		doc.ReusedProcessing = true
+		go ds.reuseProcessedDocument(processCtx, doc, duplicateID)
+	} else {
+		go ds.processDocument(processCtx, doc)
+	}
 
 	return doc, nil
 }
 
-func (ds *DocumentService) GetDocuments(ctx context.Context, userID string) ([]*models.Document, error) {
+// checkUploadQuota is UsageService.CheckUpload, skipped without metering
+func (ds *DocumentService) checkUploadQuota(ctx context.Context, userID string, size int64, sha256 string) error {
+	if ds.usage == nil {
+		return nil
+	}
+	return ds.usage.CheckUpload(ctx, userID, size, sha256)
+}
+
+// checkLLMQuota is UsageService.CheckLLM, skipped without metering
+func (ds *DocumentService) checkLLMQuota(ctx context.Context, userID string, comparison bool) error {
+	if ds.usage == nil {
+		return nil
+	}
+	return ds.usage.CheckLLM(ctx, userID, comparison)
+}
+
+// documentColumns is the select list understood by scanDocument
+const documentColumns = `id, user_id, workspace_id, file_name, storage_path, CASE WHEN uploaded_at IS NULL THEN CURRENT_TIMESTAMP ELSE uploaded_at END as uploaded_at,
+	sha256, size_bytes, folder_id, display_title, description, custom_metadata, version, deleted_at, storage_missing, title, author, pdf_created_at, pdf_modified_at, page_count, outline, is_encrypted, is_image_only, has_thumbnail`
+
+func scanDocument(row rowScanner) (*models.Document, error) {
+	doc := &models.Document{}
+	var uploadedAt time.Time
+	var title, author sql.NullString
+	var createdAt, modifiedAt sql.NullTime
+	var pageCount sql.NullInt64
+	var outline, customMetadata []byte
+	var encrypted, imageOnly, hasThumbnail bool
+
+	err := row.Scan(&doc.ID, &doc.UserID, &doc.WorkspaceID, &doc.FileName, &doc.StoragePath, &uploadedAt, &doc.SHA256, &doc.SizeBytes, &doc.FolderID,
+		&doc.DisplayTitle, &doc.Description, &customMetadata, &doc.Version, &doc.DeletedAt, &doc.StorageMissing, &title, &author, &createdAt, &modifiedAt, &pageCount, &outline, &encrypted, &imageOnly, &hasThumbnail)
+	if err != nil {
+		return nil, err
+	}
+	doc.UploadedAt = &uploadedAt
+
+	doc.CustomMetadata = map[string]string{}
+	if len(customMetadata) > 0 {
+		if err := json.Unmarshal(customMetadata, &doc.CustomMetadata); err != nil {
+			return nil, fmt.Errorf("failed to decode custom metadata: %w", err)
+		}
+	}
+
+	if hasThumbnail {
+		thumbnailURL := fmt.Sprintf("/api/documents/%s/pages/1/image?width=%d", doc.ID, ThumbnailWidth)
+		doc.ThumbnailURL = &thumbnailURL
+	}
+
+	// page_count is only set once PDF metadata has been extracted
+	if pageCount.Valid {
+		doc.Metadata = &models.DocumentMetadata{
+			Title:     title.String,
+			Author:    author.String,
+			PageCount: int(pageCount.Int64),
+			Outline:   []models.OutlineEntry{},
+			Encrypted: encrypted,
+			ImageOnly: imageOnly,
+		}
+		if createdAt.Valid {
+			doc.Metadata.CreatedAt = &createdAt.Time
+		}
+		if modifiedAt.Valid {
+			doc.Metadata.ModifiedAt = &modifiedAt.Time
+		}
+		if len(outline) > 0 {
+			if err := json.Unmarshal(outline, &doc.Metadata.Outline); err != nil {
+				return nil, fmt.Errorf("failed to decode outline: %w", err)
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// documentSorts maps the sort keys of ListDocuments to their SQL expression
+// and the cast that turns a cursor value back into that type
+var documentSorts = map[string]struct{ expr, cast string }{
+	"uploaded_at": {"COALESCE(uploaded_at, TIMESTAMP '1970-01-01')", "::timestamp"},
+	"name":        {"LOWER(COALESCE(display_title, file_name))", ""},
+	"size":        {"COALESCE(size_bytes, 0)", "::bigint"},
+}
+
+// documentConditions builds the WHERE clause shared by GetDocuments and
+// ListDocuments
+func documentConditions(workspaceID string, filter models.DocumentFilter) ([]string, []interface{}) {
+	conditions := []string{"workspace_id = $1", "deleted_at IS NULL"}
+	args := []interface{}{workspaceID}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.Title != "" {
+		addCondition("title ILIKE $%d", "%"+escapeLike(filter.Title)+"%")
+	}
+	if filter.Author != "" {
+		addCondition("author ILIKE $%d", "%"+escapeLike(filter.Author)+"%")
+	}
+	if filter.MinPages != nil {
+		addCondition("page_count >= $%d", *filter.MinPages)
+	}
+	if filter.MaxPages != nil {
+		addCondition("page_count <= $%d", *filter.MaxPages)
+	}
+	if filter.Encrypted != nil {
+		addCondition("is_encrypted = $%d", *filter.Encrypted)
+	}
+	if filter.ImageOnly != nil {
+		addCondition("is_image_only = $%d", *filter.ImageOnly)
+	}
+	if filter.CreatedAfter != nil {
+		addCondition("pdf_created_at >= $%d", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		addCondition("pdf_created_at < $%d", *filter.CreatedBefore)
+	}
+
+	// A document is ready once its chunks are stored
+	switch filter.Status {
+	case "ready":
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM document_chunks c WHERE c.document_id = documents.id)")
+	case "processing":
+		conditions = append(conditions, "NOT EXISTS (SELECT 1 FROM document_chunks c WHERE c.document_id = documents.id)")
+	}
+	if filter.FileType != "" {
+		addCondition("LOWER(file_name) LIKE $%d", "%."+escapeLike(strings.ToLower(filter.FileType)))
+	}
+	if filter.UploadedAfter != nil {
+		addCondition("uploaded_at >= $%d", *filter.UploadedAfter)
+	}
+	if filter.UploadedBefore != nil {
+		addCondition("uploaded_at < $%d", *filter.UploadedBefore)
+	}
+	if filter.Name != "" {
+		addCondition("(file_name ILIKE $%[1]d OR display_title ILIKE $%[1]d)", "%"+escapeLike(filter.Name)+"%")
+	}
+
+	scope := filter.Collection
+	if scope.FolderID == models.RootFolderID {
+		conditions = append(conditions, "folder_id IS NULL")
+	} else if scope.FolderID != "" && scope.IncludeSubfolders {
+		addCondition("folder_id IN ("+fmt.Sprintf(descendantFoldersQuery, "$%d")+")", scope.FolderID)
+	} else if scope.FolderID != "" {
+		addCondition("folder_id = $%d", scope.FolderID)
+	}
+	// Every listed tag must be present
+	for _, tag := range scope.Tags {
+		addCondition(`EXISTS (SELECT 1 FROM document_tags dt JOIN tags t ON t.id = dt.tag_id
+			WHERE dt.document_id = documents.id AND LOWER(t.name) = LOWER($%d))`, strings.TrimSpace(tag))
+	}
+
+	return conditions, args
+}
+
+// GetDocuments returns every document of the workspace matching the filter,
+// newest first
+func (ds *DocumentService) GetDocuments(ctx context.Context, userID, workspaceID string, filter models.DocumentFilter) ([]*models.Document, error) {
 	// Validate userID to prevent empty or invalid queries
 	if strings.TrimSpace(userID) == "" {
 		return nil, fmt.Errorf("userID cannot be empty")
 	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
 
-	// Fixed SQL query formatting to prevent parameter mismatch issues
-	query := `SELECT id, user_id, file_name, storage_path, CASE WHEN uploaded_at IS NULL THEN CURRENT_TIMESTAMP ELSE uploaded_at END as uploaded_at FROM documents WHERE user_id = $1 ORDER BY uploaded_at DESC`
-	rows, err := ds.db.QueryContext(ctx, query, userID)
+	conditions, args := documentConditions(workspaceID, filter)
+
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY uploaded_at DESC`
+	rows, err := ds.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query documents: %w", err)
 	}
@@ -128,48 +325,172 @@ func (ds *DocumentService) GetDocuments(ctx context.Context, userID string) ([]*
 
 	var documents []*models.Document
 	for rows.Next() {
-		doc := &models.Document{}
-		var uploadedAt time.Time
-		err := rows.Scan(&doc.ID, &doc.UserID, &doc.FileName, &doc.StoragePath, &uploadedAt)
+		doc, err := scanDocument(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan document: %w", err)
 		}
-		doc.UploadedAt = &uploadedAt
 		documents = append(documents, doc)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read documents: %w", err)
+	}
+
+	if err := ds.attachTags(ctx, documents); err != nil {
+		return nil, err
+	}
 
 	return documents, nil
 }
 
+// ListDocuments returns one page of the documents matching the filter and the
+// total number of matches. Pages are keyed on the sort value and the document
+// ID, so documents added or removed meanwhile do not shift later pages.
+func (ds *DocumentService) ListDocuments(ctx context.Context, userID, workspaceID string, filter models.DocumentFilter, page models.PageRequest) (*models.DocumentPage, error) {
+	if strings.TrimSpace(userID) == "" {
+		return nil, fmt.Errorf("userID cannot be empty")
+	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+
+	if page.Sort == "" {
+		page.Sort = "uploaded_at"
+	}
+	sort, ok := documentSorts[page.Sort]
+	if !ok {
+		return nil, fmt.Errorf("invalid sort %q", page.Sort)
+	}
+	page, err := normalizePage(page, "desc")
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := decodeCursor(page.Cursor, page.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions, args := documentConditions(workspaceID, filter)
+	where := strings.Join(conditions, " AND ")
+
+	result := &models.DocumentPage{Documents: []*models.Document{}}
+	if err := ds.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM documents WHERE `+where, args...).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	if cursor != nil {
+		args = append(args, cursor.Value, cursor.ID)
+		where += " AND " + keysetCondition(sort.expr, sort.cast, "id", page.Order, len(args)-1, len(args))
+	}
+	args = append(args, page.Limit+1)
+
+	query := `SELECT ` + documentColumns + `, (` + sort.expr + `)::text FROM documents WHERE ` + where +
+		fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT $%d`, sort.expr, page.Order, page.Order, len(args))
+	rows, err := ds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+
+	var lastSortValue string
+	for rows.Next() {
+		var sortValue string
+		doc, err := scanDocument(rowWithExtra{row: rows, extra: []interface{}{&sortValue}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		if len(result.Documents) == page.Limit {
+			// One row past the limit means there is another page
+			last := result.Documents[len(result.Documents)-1]
+			next := encodeCursor(pageCursor{Sort: page.Sort, Value: lastSortValue, ID: last.ID})
+			result.NextCursor = &next
+			break
+		}
+		result.Documents = append(result.Documents, doc)
+		lastSortValue = sortValue
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read documents: %w", err)
+	}
+
+	if err := ds.attachTags(ctx, result.Documents); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListAllDocuments returns every document ListDocuments would page through,
+// for callers that do not page
+func (ds *DocumentService) ListAllDocuments(ctx context.Context, userID, workspaceID string, filter models.DocumentFilter, page models.PageRequest) ([]*models.Document, error) {
+	page.Limit = MaxPageLimit
+	page.Cursor = ""
+
+	documents := []*models.Document{}
+	for {
+		result, err := ds.ListDocuments(ctx, userID, workspaceID, filter, page)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, result.Documents...)
+		if result.NextCursor == nil {
+			return documents, nil
+		}
+		page.Cursor = *result.NextCursor
+	}
+}
+
+// GetDocument returns a document the user may view
 func (ds *DocumentService) GetDocument(ctx context.Context, docID, userID string) (*models.Document, error) {
-	// Fixed SQL query formatting to prevent parameter mismatch issues
-	query := `SELECT id, user_id, file_name, storage_path, CASE WHEN uploaded_at IS NULL THEN CURRENT_TIMESTAMP ELSE uploaded_at END as uploaded_at FROM documents WHERE id = $1 AND user_id = $2`
-	row := ds.db.QueryRowContext(ctx, query, docID, userID)
+	doc, err := ds.AuthorizeDocument(ctx, docID, userID, ActionView)
+	if err != nil {
+		return nil, err
+	}
 
-	doc := &models.Document{}
-	var uploadedAt time.Time
-	err := row.Scan(&doc.ID, &doc.UserID, &doc.FileName, &doc.StoragePath, &uploadedAt)
+	if err := ds.attachTags(ctx, []*models.Document{doc}); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// AuthorizeDocument loads a document outside the trash and checks that the
+// user may perform action on it, as a workspace member or through a share.
+// Tags are not attached.
+func (ds *DocumentService) AuthorizeDocument(ctx context.Context, docID, userID string, action Action) (*models.Document, error) {
+	return ds.authorizeDocument(ctx, docID, userID, action, false)
+}
+
+func (ds *DocumentService) authorizeDocument(ctx context.Context, docID, userID string, action Action, trashed bool) (*models.Document, error) {
+	condition, notFound := "deleted_at IS NULL", "document not found"
+	if trashed {
+		condition, notFound = "deleted_at IS NOT NULL", "document not found in trash"
+	}
+
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE id = $1 AND ` + condition
+	doc, err := scanDocument(ds.db.QueryRowContext(ctx, query, docID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("document not found")
+			return nil, errors.New(notFound)
 		}
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
-	doc.UploadedAt = &uploadedAt
 
+	if err := ds.access.AuthorizeDocument(ctx, userID, doc.WorkspaceID, doc.ID, action); err != nil {
+		return nil, err
+	}
 	return doc, nil
 }
 
+// DeleteDocument moves a document to the trash. It disappears from every
+// listing but keeps its data until it is restored or purged.
 func (ds *DocumentService) DeleteDocument(ctx context.Context, docID, userID string) error {
-	// Get document first to get storage path
-	doc, err := ds.GetDocument(ctx, docID, userID)
-	if err != nil {
+	if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionEdit); err != nil {
 		return err
 	}
 
-	// Delete from database (will cascade to chunks and chat history)
-	query := `DELETE FROM documents WHERE id = $1 AND user_id = $2`
-	result, err := ds.db.ExecContext(ctx, query, docID, userID)
+	query := `UPDATE documents SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL`
+	result, err := ds.db.ExecContext(ctx, query, docID)
 	if err != nil {
 		return fmt.Errorf("failed to delete document: %w", err)
 	}
@@ -183,14 +504,6 @@ func (ds *DocumentService) DeleteDocument(ctx context.Context, docID, userID str
 		return fmt.Errorf("document not found")
 	}
 
-	// Delete file from storage (only if storage path exists)
-	if doc.StoragePath != nil {
-		if err := ds.storageService.DeleteFile(ctx, *doc.StoragePath); err != nil {
-			// Log error but don't fail the operation
-			fmt.Printf("Warning: failed to delete file from storage: %v\n", err)
-		}
-	}
-
 	return nil
 }
 
@@ -216,6 +529,15 @@ func (ds *DocumentService) GetDocumentChunks(ctx context.Context, docID string)
 	return chunks, nil
 }
 
+// processDocument runs the full ingestion pipeline: chunking followed by the
+// post-processing stages that depend on the stored chunks
+func (ds *DocumentService) processDocument(ctx context.Context, doc *models.Document) {
+	ds.processDocumentContent(ctx, doc)
+	ds.generateThumbnail(ctx, doc)
+	ds.generateDocumentSummary(ctx, doc)
+	ds.extractEntitiesAndMetrics(ctx, doc)
+}
+
 func (ds *DocumentService) processDocumentContent(ctx context.Context, doc *models.Document) {
 	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
 	log.Println(logPrefix + "Starting document processing...")
@@ -262,21 +584,50 @@ func (ds *DocumentService) processDocumentContent(ctx context.Context, doc *mode
 	log.Printf(logPrefix+"Successfully downloaded file. Size: %d bytes\n", len(content))
 
 	var text string
+	var pages []string
+	var tables []pdfTable
+	var metadata *models.DocumentMetadata
 	ext := strings.ToLower(filepath.Ext(doc.FileName))
 	switch ext {
 	case ".pdf":
+		log.Println(logPrefix + "Reading PDF metadata...")
+		metadata, err = extractPDFMetadata(content, doc.FileName)
+		if err != nil {
+			log.Printf(logPrefix+"PDF metadata extraction failed: %v\n", err)
+		}
+
 		log.Println(logPrefix + "Extracting text from PDF...")
-		text, err = ds.extractTextFromPDF(content)
+		pages, tables, err = ds.extractTextFromPDF(content)
 		if err != nil {
 			log.Printf(logPrefix+"PDF text extraction failed: %v\n", err)
 		}
+		text = strings.Join(pages, "")
+
+		if metadata != nil {
+			if metadata.PageCount == 0 {
+				metadata.PageCount = len(pages)
+			}
+			// Pages without any extractable text are scans
+			metadata.ImageOnly = !metadata.Encrypted && metadata.PageCount > 0 && strings.TrimSpace(text) == ""
+			if saveErr := ds.saveDocumentMetadata(ctx, doc.ID, metadata); saveErr != nil {
+				log.Printf(logPrefix+"Failed to store PDF metadata: %v\n", saveErr)
+			}
+		}
 	case ".txt":
 		log.Println(logPrefix + "Processing text file...")
 		text = string(content)
+		pages = []string{text}
 	default:
 		log.Printf(logPrefix+"Unsupported file extension: %s\n", ext)
 		text = ""
 	}
+	if ds.usage != nil {
+		pageCount := len(pages)
+		if metadata != nil && metadata.PageCount > pageCount {
+			pageCount = metadata.PageCount
+		}
+		ds.usage.RecordPages(ctx, usageOwner(ctx), pageCount)
+	}
 
 	if err != nil || strings.TrimSpace(text) == "" {
 		log.Printf(logPrefix+"Text extraction failed or content empty: %v\n", err)
@@ -285,8 +636,14 @@ func (ds *DocumentService) processDocumentContent(ctx context.Context, doc *mode
 		log.Printf(logPrefix+"Successfully extracted %d characters of text\n", len(text))
 	}
 
-	chunks := ds.chunkText(text, 1000)
-	log.Printf(logPrefix+"Created %d text chunks for processing\n", len(chunks))
+	var chunks []string
+	if metadata != nil && len(metadata.Outline) > 0 && strings.TrimSpace(text) != "" {
+		chunks = ds.chunkBySections(pages, outlineSections(metadata.Outline), 1000)
+		log.Printf(logPrefix+"Created %d section-aware chunks from the PDF outline\n", len(chunks))
+	} else {
+		chunks = ds.chunkText(text, 1000)
+		log.Printf(logPrefix+"Created %d text chunks for processing\n", len(chunks))
+	}
 
 	successCount := 0
 	for i, chunk := range chunks {
@@ -300,6 +657,114 @@ func (ds *DocumentService) processDocumentContent(ctx context.Context, doc *mode
 		}
 	}
 	log.Printf(logPrefix+"Successfully stored %d out of %d chunks\n", successCount, len(chunks))
+
+	if len(tables) > 0 {
+		ds.storeTables(ctx, doc, tables, len(chunks))
+	}
+}
+
+func (ds *DocumentService) generateDocumentSummary(ctx context.Context, doc *models.Document) {
+	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
+
+	if ds.aiService == nil {
+		log.Println(logPrefix + "AI service not available - skipping summary generation.")
+		return
+	}
+
+	chunks, err := ds.GetDocumentChunks(ctx, doc.ID)
+	if err != nil {
+		log.Printf(logPrefix+"Error getting chunks for summary: %v\n", err)
+		return
+	}
+	if len(chunks) == 0 {
+		log.Println(logPrefix + "No chunks available - skipping summary generation.")
+		return
+	}
+
+	chunkTexts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		chunkTexts = append(chunkTexts, chunk.Content)
+	}
+
+	// Large documents are reduced hierarchically before the final summary
+	chunkTexts, err = ds.summarizer.FitContext(ctx, doc, chunkTexts, ds.summarizer.ContextBudget())
+	if err != nil {
+		log.Printf(logPrefix+"Failed to fit document into context: %v\n", err)
+		return
+	}
+
+	log.Println(logPrefix + "Generating document summary...")
+	summary, err := ds.aiService.GenerateDocumentSummary(ctx, chunkTexts, doc.FileName)
+	if err != nil {
+		log.Printf(logPrefix+"Summary generation failed: %v\n", err)
+		return
+	}
+
+	if err := ds.saveDocumentSummary(ctx, doc.ID, summary); err != nil {
+		log.Printf(logPrefix+"Failed to store summary: %v\n", err)
+		return
+	}
+	log.Println(logPrefix + "Document summary stored.")
+}
+
+func (ds *DocumentService) saveDocumentSummary(ctx context.Context, docID string, summary *models.DocumentSummary) error {
+	keyEntities, err := json.Marshal(summary.KeyEntities)
+	if err != nil {
+		return fmt.Errorf("failed to encode key entities: %w", err)
+	}
+	keyFigures, err := json.Marshal(summary.KeyFigures)
+	if err != nil {
+		return fmt.Errorf("failed to encode key figures: %w", err)
+	}
+	suggestedQuestions, err := json.Marshal(summary.SuggestedQuestions)
+	if err != nil {
+		return fmt.Errorf("failed to encode suggested questions: %w", err)
+	}
+
+	query := `INSERT INTO document_summaries (document_id, executive_summary, description, key_entities, key_figures, suggested_questions, generated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		ON CONFLICT (document_id) DO UPDATE SET
+			executive_summary = EXCLUDED.executive_summary,
+			description = EXCLUDED.description,
+			key_entities = EXCLUDED.key_entities,
+			key_figures = EXCLUDED.key_figures,
+			suggested_questions = EXCLUDED.suggested_questions,
+			generated_at = EXCLUDED.generated_at`
+	_, err = ds.db.ExecContext(ctx, query, docID, summary.ExecutiveSummary, summary.Description, keyEntities, keyFigures, suggestedQuestions)
+	if err != nil {
+		return fmt.Errorf("failed to save document summary: %w", err)
+	}
+
+	return nil
+}
+
+// GetDocumentSummary returns the generated summary for a document, or nil if
+// none has been generated yet. Callers are expected to have checked ownership.
+func (ds *DocumentService) GetDocumentSummary(ctx context.Context, docID string) (*models.DocumentSummary, error) {
+	query := `SELECT document_id, executive_summary, description, key_entities, key_figures, suggested_questions, generated_at FROM document_summaries WHERE document_id = $1`
+	row := ds.db.QueryRowContext(ctx, query, docID)
+
+	summary := &models.DocumentSummary{}
+	var keyEntities, keyFigures, suggestedQuestions []byte
+	err := row.Scan(&summary.DocumentID, &summary.ExecutiveSummary, &summary.Description, &keyEntities, &keyFigures, &suggestedQuestions, &summary.GeneratedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get document summary: %w", err)
+	}
+
+	if err := json.Unmarshal(keyEntities, &summary.KeyEntities); err != nil {
+		return nil, fmt.Errorf("failed to decode key entities: %w", err)
+	}
+	if err := json.Unmarshal(keyFigures, &summary.KeyFigures); err != nil {
+		return nil, fmt.Errorf("failed to decode key figures: %w", err)
+	}
+	if err := json.Unmarshal(suggestedQuestions, &summary.SuggestedQuestions); err != nil {
+		return nil, fmt.Errorf("failed to decode suggested questions: %w", err)
+	}
+
+	return summary, nil
 }
 
 func (ds *DocumentService) createFallbackChunk(ctx context.Context, doc *models.Document) {
@@ -315,25 +780,97 @@ func (ds *DocumentService) createFallbackChunk(ctx context.Context, doc *models.
 	}
 }
 
-func (ds *DocumentService) extractTextFromPDF(content []byte) (string, error) {
+// extractTextFromPDF returns the plain text of each page, indexed from page 1
+// at position 0, together with the tables detected on them
+func (ds *DocumentService) extractTextFromPDF(content []byte) ([]string, []pdfTable, error) {
 	reader := bytes.NewReader(content)
 	pdfReader, err := pdf.NewReader(reader, int64(len(content)))
 	if err != nil {
-		return "", fmt.Errorf("unable to create PDF reader: %w", err)
+		return nil, nil, fmt.Errorf("unable to create PDF reader: %w", err)
 	}
 
-	var textBuilder strings.Builder
+	var tables []pdfTable
 	numPages := pdfReader.NumPage()
+	pages := make([]string, numPages)
 	for pageIndex := 1; pageIndex <= numPages; pageIndex++ {
 		page := pdfReader.Page(pageIndex)
+
+		pageTables, err := detectPageTables(page, pageIndex)
+		if err != nil {
+			log.Printf("Table detection skipped: %v\n", err)
+		}
+		tables = append(tables, pageTables...)
+
 		pageText, err := page.GetPlainText(nil)
 		if err != nil {
 			continue
 		}
-		textBuilder.WriteString(pageText)
+		pages[pageIndex-1] = pageText
+	}
+
+	return pages, tables, nil
+}
+
+// chunkBySections chunks each outline section separately so no chunk spans two
+// sections, and prefixes every chunk with the section it belongs to
+func (ds *DocumentService) chunkBySections(pages []string, sections []outlineSection, chunkSize int) []string {
+	var chunks []string
+
+	addChunks := func(title string, startPage, endPage int) {
+		if startPage < 1 {
+			startPage = 1
+		}
+		if endPage > len(pages) {
+			endPage = len(pages)
+		}
+		if startPage > endPage {
+			return
+		}
+
+		text := strings.Join(pages[startPage-1:endPage], " ")
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+
+		prefix := ""
+		if title != "" {
+			prefix = fmt.Sprintf("[Section: %s]\n", title)
+		}
+		for _, chunk := range ds.chunkText(text, chunkSize-len(prefix)) {
+			chunks = append(chunks, prefix+chunk)
+		}
+	}
+
+	// Pages before the first bookmark (cover, contents) have no section
+	if len(sections) > 0 && sections[0].StartPage > 1 {
+		addChunks("", 1, sections[0].StartPage-1)
+	}
+
+	for i, section := range sections {
+		endPage := len(pages)
+		if i+1 < len(sections) {
+			endPage = sections[i+1].StartPage - 1
+		}
+		addChunks(section.Title, section.StartPage, endPage)
+	}
+
+	return chunks
+}
+
+func (ds *DocumentService) saveDocumentMetadata(ctx context.Context, docID string, metadata *models.DocumentMetadata) error {
+	outline, err := json.Marshal(metadata.Outline)
+	if err != nil {
+		return fmt.Errorf("failed to encode outline: %w", err)
+	}
+
+	query := `UPDATE documents SET title = $2, author = $3, pdf_created_at = $4, pdf_modified_at = $5, page_count = $6, outline = $7, is_encrypted = $8, is_image_only = $9 WHERE id = $1`
+	_, err = ds.db.ExecContext(ctx, query, docID, metadata.Title, metadata.Author, metadata.CreatedAt, metadata.ModifiedAt,
+		metadata.PageCount, outline, metadata.Encrypted, metadata.ImageOnly)
+	if err != nil {
+		return fmt.Errorf("failed to save document metadata: %w", err)
 	}
 
-	return textBuilder.String(), nil
+	return nil
 }
 
 func (ds *DocumentService) chunkText(text string, chunkSize int) []string {
@@ -368,11 +905,15 @@ func (ds *DocumentService) chunkText(text string, chunkSize int) []string {
 
 // ReprocessDocument manually processes a document that might be stuck
 func (ds *DocumentService) ReprocessDocument(ctx context.Context, docID, userID string) error {
-	doc, err := ds.GetDocument(ctx, docID, userID)
+	doc, err := ds.AuthorizeDocument(ctx, docID, userID, ActionEdit)
 	if err != nil {
 		return err
 	}
-
+	if ds.usage != nil {
+		if err := ds.usage.CheckPages(ctx, userID); err != nil {
+			return err
+		}
+	}
 	// Delete existing chunks if any
 	deleteQuery := `DELETE FROM document_chunks WHERE document_id = $1`
 	_, err = ds.db.ExecContext(ctx, deleteQuery, docID)
@@ -380,8 +921,27 @@ func (ds *DocumentService) ReprocessDocument(ctx context.Context, docID, userID
 		fmt.Printf("Warning: failed to delete existing chunks: %v\n", err)
 	}
 
-	// Process the document again
-	ds.processDocumentContent(ctx, doc)
+	// Drop the previous summary so a stale one is never served
+	_, err = ds.db.ExecContext(ctx, `DELETE FROM document_summaries WHERE document_id = $1`, docID)
+	if err != nil {
+		fmt.Printf("Warning: failed to delete existing summary: %v\n", err)
+	}
+	if err := ds.summarizer.ClearCache(ctx, docID); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if err := ds.clearExtractedFacts(ctx, docID); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	_, err = ds.db.ExecContext(ctx, `DELETE FROM document_tables WHERE document_id = $1`, docID)
+	if err != nil {
+		fmt.Printf("Warning: failed to delete existing tables: %v\n", err)
+	}
+
+	// Process the document again in the background, like a new upload; the
+	// request's context ends as soon as the handler answers
+	processCtx := WithUsageOwner(context.Background(), userID)
+	processCtx = WithLLMLink(processCtx, LLMLink{WorkspaceID: doc.WorkspaceID, DocumentIDs: []string{doc.ID}})
+	go ds.processDocument(processCtx, doc)
 
 	return nil
 }
@@ -396,16 +956,18 @@ func (ds *DocumentService) CompareDocuments(ctx context.Context, documentIDs []s
 		return nil, nil, fmt.Errorf("maximum 5 documents can be compared at once")
 	}
 
-	// Verify all documents belong to the user and get document info
+	// Verify the user may chat about every document and get document info
 	documents := make([]*models.Document, 0, len(documentIDs))
 	documentsChunks := make([][]string, 0, len(documentIDs))
 
 	for _, docID := range documentIDs {
-		// Verify document ownership
-		doc, err := ds.GetDocument(ctx, docID, userID)
+		doc, err := ds.AuthorizeDocument(ctx, docID, userID, ActionChat)
 		if err != nil {
 			return nil, nil, fmt.Errorf("document %s not found or access denied: %w", docID, err)
 		}
+		if len(documents) > 0 && doc.WorkspaceID != documents[0].WorkspaceID {
+			return nil, nil, fmt.Errorf("invalid request: documents from different workspaces cannot be compared")
+		}
 		documents = append(documents, doc)
 
 		// Get document chunks for content analysis
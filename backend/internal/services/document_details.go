@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"strategy-analyst/internal/models"
+)
+
+const (
+	maxDisplayTitleLength  = 255
+	maxDescriptionLength   = 5000
+	maxCustomMetadataKeys  = 50
+	maxCustomMetadataKey   = 64
+	maxCustomMetadataValue = 1024
+)
+
+// ErrVersionMismatch is returned by UpdateDocument when the document changed
+// since the version the caller last read
+var ErrVersionMismatch = errors.New("document has been modified")
+
+// UpdateDocument edits a document's display title, description, custom
+// metadata, folder and tags in one transaction. When version is positive the
+// update only applies if the document is still at that version; every
+// successful update increments it.
+func (ds *DocumentService) UpdateDocument(ctx context.Context, docID, userID string, version int, req models.UpdateDocumentRequest) (*models.Document, error) {
+	doc, err := ds.AuthorizeDocument(ctx, docID, userID, ActionEdit)
+	if err != nil {
+		return nil, err
+	}
+	if req.MoveFolder && req.FolderID != nil {
+		if err := ds.checkFolderInWorkspace(ctx, *req.FolderID, doc.WorkspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	sets := []string{"version = version + 1"}
+	args := []interface{}{docID}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.DisplayTitle != nil {
+		title := strings.TrimSpace(*req.DisplayTitle)
+		if len(title) > maxDisplayTitleLength {
+			return nil, fmt.Errorf("invalid display title: longer than %d characters", maxDisplayTitleLength)
+		}
+		set("display_title", nullIfEmpty(title))
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if len(description) > maxDescriptionLength {
+			return nil, fmt.Errorf("invalid description: longer than %d characters", maxDescriptionLength)
+		}
+		set("description", nullIfEmpty(description))
+	}
+	if req.MoveFolder {
+		set("folder_id", req.FolderID)
+	}
+
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the row so that concurrent edits are checked one at a time
+	var currentVersion int
+	var currentMetadata []byte
+	err = tx.QueryRowContext(ctx, `SELECT version, custom_metadata FROM documents WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, docID).
+		Scan(&currentVersion, &currentMetadata)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("document not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	if version > 0 && version != currentVersion {
+		return nil, fmt.Errorf("%w: current version is %d", ErrVersionMismatch, currentVersion)
+	}
+
+	if req.CustomMetadata != nil {
+		metadata := map[string]string{}
+		if len(currentMetadata) > 0 {
+			if err := json.Unmarshal(currentMetadata, &metadata); err != nil {
+				return nil, fmt.Errorf("failed to decode custom metadata: %w", err)
+			}
+		}
+		if err := mergeCustomMetadata(metadata, req.CustomMetadata); err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode custom metadata: %w", err)
+		}
+		set("custom_metadata", encoded)
+	}
+
+	query := `UPDATE documents SET ` + strings.Join(sets, ", ") + ` WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to update document: %w", err)
+	}
+
+	if req.Tags != nil {
+		if err := setDocumentTags(ctx, tx, docID, userID, doc.WorkspaceID, *req.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ds.GetDocument(ctx, docID, userID)
+}
+
+// mergeCustomMetadata applies changes to metadata; an empty value removes
+// the key
+func mergeCustomMetadata(metadata, changes map[string]string) error {
+	for key, value := range changes {
+		key = strings.TrimSpace(key)
+		if key == "" || len(key) > maxCustomMetadataKey {
+			return fmt.Errorf("invalid custom metadata key %q", key)
+		}
+		if value == "" {
+			delete(metadata, key)
+			continue
+		}
+		if len(value) > maxCustomMetadataValue {
+			return fmt.Errorf("invalid custom metadata value for %q: longer than %d characters", key, maxCustomMetadataValue)
+		}
+		metadata[key] = value
+	}
+
+	if len(metadata) > maxCustomMetadataKeys {
+		return fmt.Errorf("invalid custom metadata: more than %d keys", maxCustomMetadataKeys)
+	}
+	return nil
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"strategy-analyst/internal/models"
+)
+
+// ContentDisposition builds a Content-Disposition header value that survives
+// non-ASCII file names
+func ContentDisposition(dispositionType, fileName string) string {
+	value := mime.FormatMediaType(dispositionType, map[string]string{"filename": fileName})
+	if value == "" {
+		return dispositionType
+	}
+	return value
+}
+
+// DocumentContentType returns the MIME type a document is served with
+func DocumentContentType(doc *models.Document) string {
+	switch strings.ToLower(filepath.Ext(doc.FileName)) {
+	case ".pdf":
+		return "application/pdf"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(doc.FileName)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// OpenDocumentFile checks ownership the same way as GetDocument and opens the
+// original upload for streaming
+func (ds *DocumentService) OpenDocumentFile(ctx context.Context, docID, userID string) (*models.Document, *ObjectReader, error) {
+	doc, err := ds.GetDocument(ctx, docID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.StoragePath == nil {
+		return nil, nil, fmt.Errorf("document file not found")
+	}
+
+	reader, err := ds.storageService.OpenObject(ctx, *doc.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, reader, nil
+}
+
+// SignedDownloadURL checks ownership and returns a short-lived URL for the
+// original upload. It errors when the storage backend cannot sign URLs.
+func (ds *DocumentService) SignedDownloadURL(ctx context.Context, docID, userID string, ttl time.Duration) (string, error) {
+	doc, err := ds.GetDocument(ctx, docID, userID)
+	if err != nil {
+		return "", err
+	}
+	if doc.StoragePath == nil {
+		return "", fmt.Errorf("document file not found")
+	}
+
+	return ds.storageService.SignedURL(*doc.StoragePath, doc.FileName, DocumentContentType(doc), ttl)
+}
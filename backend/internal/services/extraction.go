@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+// Characters of chunk content sent to a single extraction call
+const extractionGroupChars = 16000
+
+var entityTypes = map[string]bool{
+	"company":  true,
+	"person":   true,
+	"product":  true,
+	"location": true,
+}
+
+// extractEntitiesAndMetrics is the ingestion stage that fills the
+// document_entities and document_metrics tables from the stored chunks
+func (ds *DocumentService) extractEntitiesAndMetrics(ctx context.Context, doc *models.Document) {
+	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
+
+	if ds.aiService == nil {
+		log.Println(logPrefix + "AI service not available - skipping entity and metric extraction.")
+		return
+	}
+
+	chunks, err := ds.GetDocumentChunks(ctx, doc.ID)
+	if err != nil {
+		log.Printf(logPrefix+"Error getting chunks for extraction: %v\n", err)
+		return
+	}
+
+	entityCount, metricCount := 0, 0
+	for _, group := range groupChunksByLength(chunks, extractionGroupChars) {
+		texts := make([]string, len(group))
+		for i, chunk := range group {
+			texts[i] = chunk.Content
+		}
+
+		facts, err := ds.aiService.ExtractFacts(ctx, texts, doc.FileName)
+		if err != nil {
+			log.Printf(logPrefix+"Extraction failed for chunks %d-%d: %v\n", group[0].ChunkIndex, group[len(group)-1].ChunkIndex, err)
+			continue
+		}
+
+		for _, entity := range facts.Entities {
+			name := strings.TrimSpace(entity.Name)
+			entityType := strings.ToLower(strings.TrimSpace(entity.Type))
+			if name == "" || !entityTypes[entityType] {
+				continue
+			}
+
+			query := `INSERT INTO document_entities (id, document_id, chunk_id, name, entity_type, mentions, created_at)
+				VALUES ($1, $2, $3, $4, $5, 1, CURRENT_TIMESTAMP)
+				ON CONFLICT (document_id, entity_type, LOWER(name)) DO UPDATE SET mentions = document_entities.mentions + 1`
+			_, err := ds.db.ExecContext(ctx, query, uuid.New().String(), doc.ID, sourceChunkID(group, entity.Chunk), name, entityType)
+			if err != nil {
+				log.Printf(logPrefix+"Failed to store entity %q: %v\n", name, err)
+				continue
+			}
+			entityCount++
+		}
+
+		for _, metric := range facts.Metrics {
+			name := strings.ToLower(strings.TrimSpace(metric.Name))
+			if name == "" {
+				continue
+			}
+
+			query := `INSERT INTO document_metrics (id, document_id, chunk_id, name, value, value_text, unit, period, context, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, CURRENT_TIMESTAMP)`
+			_, err := ds.db.ExecContext(ctx, query, uuid.New().String(), doc.ID, sourceChunkID(group, metric.Chunk), name,
+				metric.Value, strings.TrimSpace(metric.ValueText), strings.TrimSpace(metric.Unit), strings.TrimSpace(metric.Period), strings.TrimSpace(metric.Context))
+			if err != nil {
+				log.Printf(logPrefix+"Failed to store metric %q: %v\n", name, err)
+				continue
+			}
+			metricCount++
+		}
+	}
+
+	log.Printf(logPrefix+"Extracted %d entity mentions and %d metrics\n", entityCount, metricCount)
+}
+
+// clearExtractedFacts removes the entities and metrics of a document before it
+// is reprocessed
+func (ds *DocumentService) clearExtractedFacts(ctx context.Context, docID string) error {
+	if _, err := ds.db.ExecContext(ctx, `DELETE FROM document_entities WHERE document_id = $1`, docID); err != nil {
+		return fmt.Errorf("failed to delete entities: %w", err)
+	}
+	if _, err := ds.db.ExecContext(ctx, `DELETE FROM document_metrics WHERE document_id = $1`, docID); err != nil {
+		return fmt.Errorf("failed to delete metrics: %w", err)
+	}
+	return nil
+}
+
+// authorizeFacts checks that the user may view the facts of one document,
+// which may be shared with them, or else of the whole workspace, and returns
+// the workspace to query
+func (ds *DocumentService) authorizeFacts(ctx context.Context, userID, workspaceID, documentID string) (string, error) {
+	if documentID != "" {
+		doc, err := ds.AuthorizeDocument(ctx, documentID, userID, ActionView)
+		if err != nil {
+			return "", err
+		}
+		return doc.WorkspaceID, nil
+	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return "", err
+	}
+	return workspaceID, nil
+}
+
+// GetEntities returns the entities across the documents of a workspace,
+// optionally narrowed to a single document, type or name substring
+func (ds *DocumentService) GetEntities(ctx context.Context, userID, workspaceID string, filter models.EntityFilter) ([]*models.DocumentEntity, error) {
+	if strings.TrimSpace(userID) == "" {
+		return nil, fmt.Errorf("userID cannot be empty")
+	}
+	workspaceID, err := ds.authorizeFacts(ctx, userID, workspaceID, filter.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"d.workspace_id = $1", "d.deleted_at IS NULL"}
+	args := []interface{}{workspaceID}
+
+	if filter.DocumentID != "" {
+		args = append(args, filter.DocumentID)
+		conditions = append(conditions, fmt.Sprintf("e.document_id = $%d", len(args)))
+	}
+	if filter.EntityType != "" {
+		args = append(args, strings.ToLower(filter.EntityType))
+		conditions = append(conditions, fmt.Sprintf("e.entity_type = $%d", len(args)))
+	}
+	if filter.Query != "" {
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf("e.name ILIKE $%d", len(args)))
+	}
+
+	query := `SELECT e.id, e.document_id, d.file_name, e.chunk_id, e.name, e.entity_type, e.mentions, e.created_at
+		FROM document_entities e JOIN documents d ON d.id = e.document_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY e.mentions DESC, e.name`
+	rows, err := ds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query entities: %w", err)
+	}
+	defer rows.Close()
+
+	entities := []*models.DocumentEntity{}
+	for rows.Next() {
+		entity := &models.DocumentEntity{}
+		err := rows.Scan(&entity.ID, &entity.DocumentID, &entity.DocumentName, &entity.ChunkID, &entity.Name, &entity.EntityType, &entity.Mentions, &entity.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan entity: %w", err)
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, rows.Err()
+}
+
+// GetMetrics returns the metrics across the documents of a workspace,
+// optionally narrowed by document, metric name, unit, period and value range
+func (ds *DocumentService) GetMetrics(ctx context.Context, userID, workspaceID string, filter models.MetricFilter) ([]*models.DocumentMetric, error) {
+	if strings.TrimSpace(userID) == "" {
+		return nil, fmt.Errorf("userID cannot be empty")
+	}
+	workspaceID, err := ds.authorizeFacts(ctx, userID, workspaceID, filter.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"d.workspace_id = $1", "d.deleted_at IS NULL"}
+	args := []interface{}{workspaceID}
+
+	if filter.DocumentID != "" {
+		args = append(args, filter.DocumentID)
+		conditions = append(conditions, fmt.Sprintf("m.document_id = $%d", len(args)))
+	}
+	if filter.Name != "" {
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+		conditions = append(conditions, fmt.Sprintf("m.name ILIKE $%d", len(args)))
+	}
+	if filter.Unit != "" {
+		args = append(args, filter.Unit)
+		conditions = append(conditions, fmt.Sprintf("LOWER(m.unit) = LOWER($%d)", len(args)))
+	}
+	if filter.Period != "" {
+		args = append(args, "%"+escapeLike(filter.Period)+"%")
+		conditions = append(conditions, fmt.Sprintf("m.period ILIKE $%d", len(args)))
+	}
+	if filter.MinValue != nil {
+		args = append(args, *filter.MinValue)
+		conditions = append(conditions, fmt.Sprintf("m.value >= $%d", len(args)))
+	}
+	if filter.MaxValue != nil {
+		args = append(args, *filter.MaxValue)
+		conditions = append(conditions, fmt.Sprintf("m.value <= $%d", len(args)))
+	}
+
+	query := `SELECT m.id, m.document_id, d.file_name, m.chunk_id, m.name, m.value, m.value_text, m.unit, m.period, m.context, m.created_at
+		FROM document_metrics m JOIN documents d ON d.id = m.document_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY m.name, m.period, d.file_name`
+	rows, err := ds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query metrics: %w", err)
+	}
+	defer rows.Close()
+
+	metrics := []*models.DocumentMetric{}
+	for rows.Next() {
+		metric := &models.DocumentMetric{}
+		err := rows.Scan(&metric.ID, &metric.DocumentID, &metric.DocumentName, &metric.ChunkID, &metric.Name, &metric.Value,
+			&metric.ValueText, &metric.Unit, &metric.Period, &metric.Context, &metric.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, rows.Err()
+}
+
+// groupChunksByLength packs consecutive chunks into groups of at most maxChars
+func groupChunksByLength(chunks []*models.DocumentChunk, maxChars int) [][]*models.DocumentChunk {
+	var groups [][]*models.DocumentChunk
+	var current []*models.DocumentChunk
+	currentLen := 0
+
+	for _, chunk := range chunks {
+		if currentLen+len(chunk.Content) > maxChars && len(current) > 0 {
+			groups = append(groups, current)
+			current = nil
+			currentLen = 0
+		}
+		current = append(current, chunk)
+		currentLen += len(chunk.Content)
+	}
+
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	return groups
+}
+
+// sourceChunkID maps the 1-based chunk label used in the prompt back to the
+// stored chunk, or nil if the model referenced a chunk outside the group
+func sourceChunkID(group []*models.DocumentChunk, label int) *string {
+	if label < 1 || label > len(group) {
+		return nil
+	}
+	return &group[label-1].ID
+}
+
+func escapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
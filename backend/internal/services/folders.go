@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"strategy-analyst/internal/models"
+)
+
+const maxFolderNameLength = 255
+
+// descendantFoldersQuery selects a folder and every folder below it; %s is
+// the placeholder of the root folder ID
+const descendantFoldersQuery = `WITH RECURSIVE subfolders AS (
+		SELECT id FROM folders WHERE id = %s
+		UNION ALL
+		SELECT f.id FROM folders f JOIN subfolders s ON f.parent_id = s.id
+	) SELECT id FROM subfolders`
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func validateFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("folder name is required")
+	}
+	if len(name) > maxFolderNameLength || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid folder name")
+	}
+	return name, nil
+}
+
+// folderColumns is the select list understood by scanFolder
+const folderColumns = `f.id, f.workspace_id, f.parent_id, f.name, f.created_at, f.updated_at,
+	(SELECT COUNT(*) FROM documents d WHERE d.folder_id = f.id AND d.deleted_at IS NULL)`
+
+func scanFolder(row rowScanner) (*models.Folder, error) {
+	folder := &models.Folder{}
+	err := row.Scan(&folder.ID, &folder.WorkspaceID, &folder.ParentID, &folder.Name, &folder.CreatedAt, &folder.UpdatedAt, &folder.DocumentCount)
+	return folder, err
+}
+
+// GetFolders returns all folders of a workspace as a flat list; clients
+// build the tree from parent_id
+func (ds *DocumentService) GetFolders(ctx context.Context, userID, workspaceID string) ([]*models.Folder, error) {
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + folderColumns + ` FROM folders f WHERE f.workspace_id = $1 ORDER BY LOWER(f.name)`
+	rows, err := ds.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query folders: %w", err)
+	}
+	defer rows.Close()
+
+	folders := []*models.Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		folders = append(folders, folder)
+	}
+
+	return folders, rows.Err()
+}
+
+// GetFolder returns a folder the user may view
+func (ds *DocumentService) GetFolder(ctx context.Context, folderID, userID string) (*models.Folder, error) {
+	return ds.authorizeFolder(ctx, folderID, userID, ActionView)
+}
+
+// authorizeFolder loads a folder and checks that the user may perform action
+// in its workspace
+func (ds *DocumentService) authorizeFolder(ctx context.Context, folderID, userID string, action Action) (*models.Folder, error) {
+	folder, err := scanFolder(ds.db.QueryRowContext(ctx, `SELECT `+folderColumns+` FROM folders f WHERE f.id = $1`, folderID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("folder not found")
+		}
+		return nil, fmt.Errorf("failed to get folder: %w", err)
+	}
+
+	if err := ds.access.AuthorizeResource(ctx, userID, folder.WorkspaceID, action, "folder"); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// checkFolderInWorkspace fails unless the folder belongs to the workspace;
+// documents and folders are never filed across workspaces
+func (ds *DocumentService) checkFolderInWorkspace(ctx context.Context, folderID, workspaceID string) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1 AND workspace_id = $2)`
+	if err := ds.db.QueryRowContext(ctx, query, folderID, workspaceID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to get folder: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("folder not found")
+	}
+	return nil
+}
+
+// CreateFolder creates a folder in a workspace, at the top level or inside
+// parentID
+func (ds *DocumentService) CreateFolder(ctx context.Context, userID, workspaceID, name string, parentID *string) (*models.Folder, error) {
+	name, err := validateFolderName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionEdit); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if err := ds.checkFolderInWorkspace(ctx, *parentID, workspaceID); err != nil {
+			return nil, fmt.Errorf("parent %w", err)
+		}
+	}
+
+	folderID := uuid.New().String()
+	query := `INSERT INTO folders (id, user_id, workspace_id, parent_id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+	if _, err := ds.db.ExecContext(ctx, query, folderID, userID, workspaceID, parentID, name); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("a folder named %q already exists here", name)
+		}
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	return ds.GetFolder(ctx, folderID, userID)
+}
+
+// UpdateFolder renames a folder and/or moves it under another parent. A
+// folder cannot be moved into itself or one of its descendants.
+func (ds *DocumentService) UpdateFolder(ctx context.Context, folderID, userID string, req models.UpdateFolderRequest) (*models.Folder, error) {
+	folder, err := ds.authorizeFolder(ctx, folderID, userID, ActionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	name := folder.Name
+	if req.Name != nil {
+		if name, err = validateFolderName(*req.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	parentID := folder.ParentID
+	if req.Move {
+		parentID = req.ParentID
+		if parentID != nil {
+			if err := ds.checkFolderInWorkspace(ctx, *parentID, folder.WorkspaceID); err != nil {
+				return nil, fmt.Errorf("parent %w", err)
+			}
+
+			var cycle bool
+			query := `SELECT $2 IN (` + fmt.Sprintf(descendantFoldersQuery, "$1") + `)`
+			if err := ds.db.QueryRowContext(ctx, query, folderID, *parentID).Scan(&cycle); err != nil {
+				return nil, fmt.Errorf("failed to check folder hierarchy: %w", err)
+			}
+			if cycle {
+				return nil, fmt.Errorf("a folder cannot be moved into itself or its subfolders")
+			}
+		}
+	}
+
+	query := `UPDATE folders SET name = $2, parent_id = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	if _, err := ds.db.ExecContext(ctx, query, folderID, name, parentID); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("a folder named %q already exists here", name)
+		}
+		return nil, fmt.Errorf("failed to update folder: %w", err)
+	}
+
+	return ds.GetFolder(ctx, folderID, userID)
+}
+
+// DeleteFolder deletes a folder and its subfolders. Documents inside them are
+// not deleted; they move to the top level.
+func (ds *DocumentService) DeleteFolder(ctx context.Context, folderID, userID string) (*models.Folder, error) {
+	folder, err := ds.authorizeFolder(ctx, folderID, userID, ActionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ds.db.ExecContext(ctx, `DELETE FROM folders WHERE id = $1`, folderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete folder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("folder not found")
+	}
+
+	return folder, nil
+}
+
+// SetDocumentFolder files a document into a folder of its workspace, or takes
+// it out of any folder when folderID is nil
+func (ds *DocumentService) SetDocumentFolder(ctx context.Context, docID, userID string, folderID *string) (*models.Document, error) {
+	doc, err := ds.AuthorizeDocument(ctx, docID, userID, ActionEdit)
+	if err != nil {
+		return nil, err
+	}
+	if folderID != nil {
+		if err := ds.checkFolderInWorkspace(ctx, *folderID, doc.WorkspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := ds.db.ExecContext(ctx, `UPDATE documents SET folder_id = $2, version = version + 1 WHERE id = $1`, docID, folderID); err != nil {
+		return nil, fmt.Errorf("failed to move document: %w", err)
+	}
+
+	return ds.GetDocument(ctx, docID, userID)
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"strategy-analyst/internal/models"
+)
+
+// ModelPrice is what a model costs in US dollars per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+var builtinModelPrices = map[string]ModelPrice{
+	"gemini-2.0-flash":     {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.0-flash-exp": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+}
+
+// LoadModelPrices returns the built-in prices merged with the ones in the
+// JSON file at path, an object keyed by model name. An empty path loads only
+// the built-ins.
+func LoadModelPrices(path string) (map[string]ModelPrice, error) {
+	prices := make(map[string]ModelPrice, len(builtinModelPrices))
+	for model, price := range builtinModelPrices {
+		prices[model] = price
+	}
+
+	if path == "" {
+		return prices, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return prices, fmt.Errorf("failed to read model prices file: %w", err)
+	}
+
+	var custom map[string]ModelPrice
+	if err := json.Unmarshal(content, &custom); err != nil {
+		return prices, fmt.Errorf("failed to parse model prices file: %w", err)
+	}
+	for model, price := range custom {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			return prices, fmt.Errorf("invalid price for model %q: prices cannot be negative", model)
+		}
+		prices[model] = price
+	}
+
+	return prices, nil
+}
+
+// LLMLink is what the LLM calls made with a context are about
+type LLMLink struct {
+	WorkspaceID   string
+	DocumentIDs   []string
+	ChatMessageID string
+	ComparisonID  string
+}
+
+type llmLinkKey struct{}
+
+// WithLLMLink links the LLM calls made with ctx to a workspace, its
+// documents and the chat message or comparison they produce
+func WithLLMLink(ctx context.Context, link LLMLink) context.Context {
+	return context.WithValue(ctx, llmLinkKey{}, link)
+}
+
+func llmLinkOf(ctx context.Context) LLMLink {
+	link, _ := ctx.Value(llmLinkKey{}).(LLMLink)
+	return link
+}
+
+// cost prices a call, or returns nil when its model has no price
+func (us *UsageService) cost(model string, promptTokens, completionTokens int64) *float64 {
+	price, ok := us.prices[model]
+	if !ok {
+		return nil
+	}
+	cost := (float64(promptTokens)*price.InputPerMillion + float64(completionTokens)*price.OutputPerMillion) / 1e6
+	return &cost
+}
+
+// RecordLLMCall stores a call with the user and links of ctx, prices it and
+// adds its tokens to the user's monthly usage. Failures are only logged.
+func (us *UsageService) RecordLLMCall(ctx context.Context, operation, model string, promptTokens, completionTokens, totalTokens int64, latency time.Duration) {
+	userID := usageOwner(ctx)
+	link := llmLinkOf(ctx)
+	documentIDs := link.DocumentIDs
+	if documentIDs == nil {
+		documentIDs = []string{}
+	}
+
+	query := `INSERT INTO llm_calls (id, user_id, workspace_id, document_ids, chat_message_id, comparison_id,
+			operation, model, prompt_tokens, completion_tokens, total_tokens, latency_ms, cost_usd, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, CURRENT_TIMESTAMP)`
+	_, err := us.db.ExecContext(context.WithoutCancel(ctx), query, uuid.New().String(), nullIfEmpty(userID),
+		nullIfEmpty(link.WorkspaceID), pq.Array(documentIDs), nullIfEmpty(link.ChatMessageID), nullIfEmpty(link.ComparisonID),
+		operation, model, promptTokens, completionTokens, totalTokens, latency.Milliseconds(),
+		us.cost(model, promptTokens, completionTokens))
+	if err != nil {
+		fmt.Printf("Failed to record %s call of user %s: %v\n", operation, userID, err)
+	}
+
+	if promptTokens > 0 || completionTokens > 0 {
+		us.record(ctx, userID, monthlyUsage{inputTokens: promptTokens, outputTokens: completionTokens})
+	}
+}
+
+// llmCallScope restricts calls to a workspace, and to the user's own calls
+// unless they may manage it
+func (us *UsageService) llmCallScope(ctx context.Context, userID, workspaceID string) ([]string, []interface{}, error) {
+	role, err := us.access.Authorize(ctx, userID, workspaceID, ActionView)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conditions := []string{"c.workspace_id = $1"}
+	args := []interface{}{workspaceID}
+	if !RoleAllows(role, ActionManage) || CheckScope(ctx, ActionManage) != nil {
+		args = append(args, userID)
+		conditions = append(conditions, fmt.Sprintf("c.user_id = $%d", len(args)))
+	}
+	return conditions, args, nil
+}
+
+const llmUsageAggregates = `COUNT(*), COALESCE(SUM(c.prompt_tokens), 0), COALESCE(SUM(c.completion_tokens), 0),
+	COALESCE(SUM(c.total_tokens), 0), COALESCE(ROUND(AVG(c.latency_ms)), 0)::bigint,
+	COALESCE(SUM(c.cost_usd), 0)::float8, COUNT(*) FILTER (WHERE c.cost_usd IS NULL)`
+
+func scanLLMUsageRow(row rowScanner, usage *models.LLMUsageRow) error {
+	return row.Scan(&usage.Calls, &usage.PromptTokens, &usage.CompletionTokens, &usage.TotalTokens,
+		&usage.AvgLatencyMs, &usage.CostUSD, &usage.UnpricedCalls)
+}
+
+// GetLLMUsageReport totals a workspace's LLM calls made in [since, until)
+// by user, document or day. Owners see everyone's calls, other members only
+// their own.
+func (us *UsageService) GetLLMUsageReport(ctx context.Context, userID, workspaceID, groupBy string, since, until *time.Time) (*models.LLMUsageReport, error) {
+	var key, from string
+	switch groupBy {
+	case "", "day":
+		groupBy = "day"
+		key, from = `to_char(c.created_at, 'YYYY-MM-DD')`, `llm_calls c`
+	case "user":
+		key, from = `COALESCE(c.user_id, '')`, `llm_calls c`
+	case "document":
+		key, from = `d.document_id`, `llm_calls c CROSS JOIN LATERAL unnest(c.document_ids) AS d(document_id)`
+	default:
+		return nil, fmt.Errorf("invalid group_by %q: use user, document or day", groupBy)
+	}
+
+	conditions, args, err := us.llmCallScope(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if since != nil {
+		args = append(args, *since)
+		conditions = append(conditions, fmt.Sprintf("c.created_at >= $%d", len(args)))
+	}
+	if until != nil {
+		args = append(args, *until)
+		conditions = append(conditions, fmt.Sprintf("c.created_at < $%d", len(args)))
+	}
+	where := strings.Join(conditions, " AND ")
+
+	report := &models.LLMUsageReport{GroupBy: groupBy, Rows: []*models.LLMUsageRow{}}
+	query := `SELECT ` + llmUsageAggregates + ` FROM llm_calls c WHERE ` + where
+	if err := scanLLMUsageRow(us.db.QueryRowContext(ctx, query, args...), &report.Total); err != nil {
+		return nil, fmt.Errorf("failed to total LLM usage: %w", err)
+	}
+
+	query = `SELECT ` + llmUsageAggregates + `, ` + key + ` FROM ` + from + ` WHERE ` + where +
+		` GROUP BY ` + key + ` ORDER BY ` + key
+	rows, err := us.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query LLM usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := &models.LLMUsageRow{}
+		if err := scanLLMUsageRow(rowWithExtra{row: rows, extra: []interface{}{&row.Key}}, row); err != nil {
+			return nil, fmt.Errorf("failed to scan LLM usage: %w", err)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read LLM usage: %w", err)
+	}
+
+	return report, nil
+}
+
+// ListLLMCalls returns the LLM calls behind one chat message or comparison,
+// oldest first
+func (us *UsageService) ListLLMCalls(ctx context.Context, userID, workspaceID, chatMessageID, comparisonID string) ([]*models.LLMCall, error) {
+	if (chatMessageID == "") == (comparisonID == "") {
+		return nil, fmt.Errorf("invalid request: either chat_message_id or comparison_id is required")
+	}
+
+	conditions, args, err := us.llmCallScope(ctx, userID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if chatMessageID != "" {
+		args = append(args, chatMessageID)
+		conditions = append(conditions, fmt.Sprintf("c.chat_message_id = $%d", len(args)))
+	} else {
+		args = append(args, comparisonID)
+		conditions = append(conditions, fmt.Sprintf("c.comparison_id = $%d", len(args)))
+	}
+
+	query := `SELECT c.id, c.user_id, c.workspace_id, c.document_ids, c.chat_message_id, c.comparison_id, c.operation,
+			c.model, c.prompt_tokens, c.completion_tokens, c.total_tokens, c.latency_ms, c.cost_usd::float8, c.created_at
+		FROM llm_calls c WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY c.created_at, c.id`
+	rows, err := us.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query LLM calls: %w", err)
+	}
+	defer rows.Close()
+
+	calls := []*models.LLMCall{}
+	for rows.Next() {
+		call := &models.LLMCall{}
+		err := rows.Scan(&call.ID, &call.UserID, &call.WorkspaceID, pq.Array(&call.DocumentIDs), &call.ChatMessageID,
+			&call.ComparisonID, &call.Operation, &call.Model, &call.PromptTokens, &call.CompletionTokens,
+			&call.TotalTokens, &call.LatencyMs, &call.CostUSD, &call.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan LLM call: %w", err)
+		}
+		calls = append(calls, call)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read LLM calls: %w", err)
+	}
+
+	return calls, nil
+}
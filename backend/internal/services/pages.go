@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"strategy-analyst/internal/models"
+)
+
+// GetPageImage returns a PNG of a page (1-based) of a PDF the user may view
+func (ds *DocumentService) GetPageImage(ctx context.Context, docID, userID string, page, width int) ([]byte, error) {
+	if ds.pageRenderer == nil {
+		return nil, fmt.Errorf("page rendering is not available")
+	}
+
+	doc, err := ds.GetDocument(ctx, docID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToLower(filepath.Ext(doc.FileName)) != ".pdf" {
+		return nil, fmt.Errorf("page images are only available for PDF documents")
+	}
+	if doc.StoragePath == nil {
+		return nil, fmt.Errorf("document file is not available")
+	}
+	if page < 1 || (doc.Metadata != nil && doc.Metadata.PageCount > 0 && page > doc.Metadata.PageCount) {
+		return nil, fmt.Errorf("page %d not found", page)
+	}
+
+	return ds.pageRenderer.RenderPage(ctx, doc.ID, *doc.StoragePath, page, ClampPageImageWidth(width))
+}
+
+// generateThumbnail renders the first page for the document list. It goes
+// through the page cache, so later requests for the thumbnail are served
+// straight from the blob store.
+func (ds *DocumentService) generateThumbnail(ctx context.Context, doc *models.Document) {
+	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
+
+	if ds.pageRenderer == nil || doc.StoragePath == nil || strings.ToLower(filepath.Ext(doc.FileName)) != ".pdf" {
+		return
+	}
+
+	if _, err := ds.pageRenderer.RenderPage(ctx, doc.ID, *doc.StoragePath, 1, ThumbnailWidth); err != nil {
+		log.Printf(logPrefix+"Thumbnail generation failed: %v\n", err)
+		return
+	}
+
+	if _, err := ds.db.ExecContext(ctx, `UPDATE documents SET has_thumbnail = TRUE WHERE id = $1`, doc.ID); err != nil {
+		log.Printf(logPrefix+"Failed to record thumbnail: %v\n", err)
+		return
+	}
+	log.Println(logPrefix + "Thumbnail generated.")
+}
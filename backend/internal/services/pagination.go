@@ -0,0 +1,86 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"strategy-analyst/internal/models"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// pageCursor marks the last row of a page. Value is the row's sort key as
+// rendered by Postgres (::text), so it can be cast back without loss.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses an opaque cursor, rejecting cursors issued for a
+// different sort order
+func decodeCursor(raw, sort string) (*pageCursor, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" || cursor.Sort != sort {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// normalizePage applies the default limit and order and validates them
+func normalizePage(page models.PageRequest, defaultOrder string) (models.PageRequest, error) {
+	if page.Limit <= 0 {
+		page.Limit = DefaultPageLimit
+	}
+	page.Limit = min(page.Limit, MaxPageLimit)
+
+	page.Order = strings.ToLower(page.Order)
+	if page.Order == "" {
+		page.Order = defaultOrder
+	}
+	if page.Order != "asc" && page.Order != "desc" {
+		return page, fmt.Errorf("invalid order %q", page.Order)
+	}
+
+	return page, nil
+}
+
+// keysetCondition builds the "after the cursor" condition for a page ordered
+// by (sortExpr, idExpr); the cursor's value is cast back with cast
+func keysetCondition(sortExpr, cast, idExpr, order string, valuePlaceholder, idPlaceholder int) string {
+	operator := ">"
+	if order == "desc" {
+		operator = "<"
+	}
+	return fmt.Sprintf("(%s, %s) %s ($%d%s, $%d)", sortExpr, idExpr, operator, valuePlaceholder, cast, idPlaceholder)
+}
+
+// rowWithExtra scans the standard columns of a row followed by extra ones,
+// so scan helpers such as scanDocument can be reused for paged queries
+type rowWithExtra struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (r rowWithExtra) Scan(dest ...interface{}) error {
+	return r.row.Scan(append(dest, r.extra...)...)
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"encoding/base64"
+	"slices"
+	"sort"
+	"testing"
+
+	"strategy-analyst/internal/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []pageCursor{
+		{Sort: "uploaded_at", Value: "2026-03-01 09:30:00.123456", ID: "6f1c2a9e-0000-4000-8000-000000000001"},
+		{Sort: "name", Value: `Q3 "board" deck / draft, ünïcode`, ID: "doc-2"},
+		{Sort: "size", Value: "0", ID: "doc-3"},
+		{Sort: "name", Value: "", ID: "doc-4"},
+	}
+
+	for _, cursor := range cursors {
+		encoded := encodeCursor(cursor)
+		decoded, err := decodeCursor(encoded, cursor.Sort)
+		if err != nil {
+			t.Fatalf("decodeCursor(encodeCursor(%+v)) error = %v", cursor, err)
+		}
+		if *decoded != cursor {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v", cursor, *decoded)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	valid := encodeCursor(pageCursor{Sort: "uploaded_at", Value: "2026-03-01 09:30:00", ID: "doc-1"})
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   string
+	}{
+		{name: "cursor of a different sort", cursor: valid, sort: "name"},
+		{name: "cursor without a sort", cursor: encode(`{"v":"a","id":"doc-1"}`), sort: "name"},
+		{name: "cursor without an ID", cursor: encode(`{"s":"name","v":"a"}`), sort: "name"},
+		{name: "not base64", cursor: "not a cursor!", sort: "uploaded_at"},
+		{name: "not JSON", cursor: encode("uploaded_at|doc-1"), sort: "uploaded_at"},
+		{name: "truncated", cursor: valid[:len(valid)-4], sort: "uploaded_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := decodeCursor(tt.cursor, tt.sort); err == nil {
+				t.Errorf("decodeCursor(%q, %q) = %+v, want an error", tt.cursor, tt.sort, cursor)
+			}
+		})
+	}
+
+	if cursor, err := decodeCursor("", "name"); cursor != nil || err != nil {
+		t.Errorf(`decodeCursor("") = %+v, %v, want no cursor and no error`, cursor, err)
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{order: "asc", want: "(d.uploaded_at, d.id) > ($3::timestamp, $4)"},
+		{order: "desc", want: "(d.uploaded_at, d.id) < ($3::timestamp, $4)"},
+	}
+
+	for _, tt := range tests {
+		if got := keysetCondition("d.uploaded_at", "::timestamp", "d.id", tt.order, 3, 4); got != tt.want {
+			t.Errorf("keysetCondition(%s) = %q, want %q", tt.order, got, tt.want)
+		}
+	}
+}
+
+// TestKeysetPagingWithTies pages through rows that share sort values the way
+// the queries do: ordered by (value, id), each page starting after the
+// previous page's cursor. The row comparison in keysetCondition includes the
+// ID, so rows tied on the value are neither skipped nor repeated.
+func TestKeysetPagingWithTies(t *testing.T) {
+	type row struct{ value, id string }
+	rows := []row{
+		{"2026-01-01", "a"}, {"2026-01-01", "b"}, {"2026-01-01", "c"},
+		{"2026-01-02", "d"},
+		{"2026-01-03", "e"}, {"2026-01-03", "f"}, {"2026-01-03", "g"}, {"2026-01-03", "h"},
+	}
+	// (value, id) > (cursor value, cursor id), as Postgres compares row values
+	after := func(r row, cursor *pageCursor, order string) bool {
+		if cursor == nil {
+			return true
+		}
+		cmp := r.value > cursor.Value || (r.value == cursor.Value && r.id > cursor.ID)
+		if order == "desc" {
+			cmp = r.value < cursor.Value || (r.value == cursor.Value && r.id < cursor.ID)
+		}
+		return cmp
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		for _, limit := range []int{1, 2, 3, 5} {
+			sorted := slices.Clone(rows)
+			sort.Slice(sorted, func(i, j int) bool {
+				less := sorted[i].value < sorted[j].value || (sorted[i].value == sorted[j].value && sorted[i].id < sorted[j].id)
+				if order == "desc" {
+					return !less
+				}
+				return less
+			})
+
+			var seen []string
+			raw := ""
+			for pages := 0; ; pages++ {
+				if pages > len(rows) {
+					t.Fatalf("%s/%d: paging did not terminate", order, limit)
+				}
+				cursor, err := decodeCursor(raw, "uploaded_at")
+				if err != nil {
+					t.Fatalf("%s/%d: decodeCursor error = %v", order, limit, err)
+				}
+
+				var page []row
+				for _, r := range sorted {
+					if after(r, cursor, order) && len(page) < limit {
+						page = append(page, r)
+					}
+				}
+				for _, r := range page {
+					seen = append(seen, r.id)
+				}
+				if len(page) < limit {
+					break
+				}
+				last := page[len(page)-1]
+				raw = encodeCursor(pageCursor{Sort: "uploaded_at", Value: last.value, ID: last.id})
+			}
+
+			want := make([]string, len(sorted))
+			for i, r := range sorted {
+				want[i] = r.id
+			}
+			if !slices.Equal(seen, want) {
+				t.Errorf("%s/%d: paged through %v, want %v", order, limit, seen, want)
+			}
+		}
+	}
+}
+
+func TestNormalizePage(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    models.PageRequest
+		want    models.PageRequest
+		wantErr bool
+	}{
+		{name: "defaults", page: models.PageRequest{}, want: models.PageRequest{Limit: DefaultPageLimit, Order: "desc"}},
+		{name: "limit is capped", page: models.PageRequest{Limit: 1000}, want: models.PageRequest{Limit: MaxPageLimit, Order: "desc"}},
+		{name: "negative limit", page: models.PageRequest{Limit: -1}, want: models.PageRequest{Limit: DefaultPageLimit, Order: "desc"}},
+		{name: "order is case-insensitive", page: models.PageRequest{Limit: 10, Order: "ASC"}, want: models.PageRequest{Limit: 10, Order: "asc"}},
+		{name: "invalid order", page: models.PageRequest{Order: "sideways"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePage(tt.page, "desc")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("normalizePage(%+v) = %+v, want an error", tt.page, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizePage(%+v) error = %v", tt.page, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizePage(%+v) = %+v, want %+v", tt.page, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+
+	"strategy-analyst/internal/models"
+)
+
+// extractPDFMetadata reads the info dictionary, page count and outline of a
+// PDF with pdfcpu. Files pdfcpu cannot open because they are password
+// protected are reported as encrypted rather than as an error.
+func extractPDFMetadata(content []byte, fileName string) (metadata *models.DocumentMetadata, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			metadata = nil
+			err = fmt.Errorf("pdfcpu failed to read %s: %v", fileName, r)
+		}
+	}()
+
+	metadata = &models.DocumentMetadata{Outline: []models.OutlineEntry{}}
+
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+
+	info, err := api.PDFInfo(bytes.NewReader(content), fileName, nil, conf)
+	if err != nil {
+		if isEncryptionError(err) {
+			metadata.Encrypted = true
+			return metadata, nil
+		}
+		return nil, fmt.Errorf("failed to read PDF info: %w", err)
+	}
+
+	metadata.Title = strings.TrimSpace(info.Title)
+	metadata.Author = strings.TrimSpace(info.Author)
+	metadata.PageCount = info.PageCount
+	metadata.Encrypted = info.Encrypted
+	metadata.CreatedAt = parsePDFDate(info.CreationDate)
+	metadata.ModifiedAt = parsePDFDate(info.ModificationDate)
+
+	if info.Outlines {
+		conf := model.NewDefaultConfiguration()
+		conf.ValidationMode = model.ValidationRelaxed
+
+		bookmarks, err := api.Bookmarks(bytes.NewReader(content), conf)
+		if err == nil {
+			metadata.Outline = convertBookmarks(bookmarks)
+		}
+	}
+
+	return metadata, nil
+}
+
+func isEncryptionError(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "password") || strings.Contains(message, "encrypt")
+}
+
+// parsePDFDate accepts both raw PDF dates (D:YYYYMMDDHHmmSS...) and the
+// RFC 3339 form pdfcpu produces from XMP metadata
+func parsePDFDate(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	if t, ok := types.DateTime(value, true); ok {
+		return &t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return &t
+	}
+
+	return nil
+}
+
+func convertBookmarks(bookmarks []pdfcpu.Bookmark) []models.OutlineEntry {
+	entries := make([]models.OutlineEntry, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		entries = append(entries, models.OutlineEntry{
+			Title:    strings.TrimSpace(bookmark.Title),
+			Page:     bookmark.PageFrom,
+			Children: convertBookmarks(bookmark.Kids),
+		})
+	}
+	return entries
+}
+
+// outlineSection is a run of pages that belongs to one outline entry
+type outlineSection struct {
+	Title     string
+	StartPage int
+}
+
+// outlineSections flattens the outline into sections ordered by start page.
+// Nested entries are titled with their full path ("Strategy > Risks"), and
+// entries that start on the same page are merged.
+func outlineSections(outline []models.OutlineEntry) []outlineSection {
+	var sections []outlineSection
+
+	var walk func(entries []models.OutlineEntry, parent string)
+	walk = func(entries []models.OutlineEntry, parent string) {
+		for _, entry := range entries {
+			title := entry.Title
+			if parent != "" {
+				title = parent + " > " + title
+			}
+			if entry.Page > 0 {
+				sections = append(sections, outlineSection{Title: title, StartPage: entry.Page})
+			}
+			walk(entry.Children, title)
+		}
+	}
+	walk(outline, "")
+
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].StartPage < sections[j].StartPage
+	})
+
+	var merged []outlineSection
+	for _, section := range sections {
+		n := len(merged)
+		if n > 0 && merged[n-1].StartPage == section.StartPage {
+			// Prefer the deepest title when several entries share a page
+			merged[n-1].Title = section.Title
+			continue
+		}
+		merged = append(merged, section)
+	}
+
+	return merged
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Table detection works on the positioned glyphs of a page. Glyphs are joined
+// into words, words into lines, and each line is split into cells wherever
+// the horizontal gap is much wider than a space. A run of consecutive lines
+// with the same number of cells whose cells line up is treated as a table.
+const (
+	// Minimum lines (header included) for a run to count as a table
+	minTableRows = 3
+	// Gap, in multiples of the font size, that separates two cells
+	cellGapFactor = 1.2
+	// Gap, in multiples of the font size, that separates two words
+	wordGapFactor = 0.2
+	// Vertical distance, in multiples of the font size, within one line
+	lineToleranceFactor = 0.5
+	// Horizontal slack, in points, when checking that cells line up
+	columnTolerance = 8.0
+)
+
+// pdfTable is a table detected on a PDF page. The first row is the header.
+type pdfTable struct {
+	PageNumber int
+	Rows       [][]string
+}
+
+type pdfWord struct {
+	x0, x1, y, size float64
+	text            string
+}
+
+type pdfCell struct {
+	x0, x1 float64
+	text   string
+}
+
+// detectPageTables finds tables on a single page. Malformed content streams
+// make the PDF library panic, so a page that cannot be read yields no tables.
+func detectPageTables(page pdf.Page, pageNumber int) (tables []pdfTable, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tables = nil
+			err = fmt.Errorf("failed to read page %d content: %v", pageNumber, r)
+		}
+	}()
+
+	words := groupWords(page.Content().Text)
+	lines := groupLines(words)
+
+	var run [][]pdfCell
+	flush := func() {
+		if len(run) >= minTableRows {
+			table := pdfTable{PageNumber: pageNumber}
+			for _, line := range run {
+				row := make([]string, len(line))
+				for i, cell := range line {
+					row[i] = cell.text
+				}
+				table.Rows = append(table.Rows, row)
+			}
+			tables = append(tables, table)
+		}
+		run = nil
+	}
+
+	for _, line := range lines {
+		cells := splitCells(line)
+		if len(cells) < 2 {
+			flush()
+			continue
+		}
+		if len(run) > 0 && !columnsAlign(run[len(run)-1], cells) {
+			flush()
+		}
+		run = append(run, cells)
+	}
+	flush()
+
+	return tables, nil
+}
+
+// groupWords joins consecutive glyphs on the same baseline into words
+func groupWords(texts []pdf.Text) []pdfWord {
+	var words []pdfWord
+	var current *pdfWord
+
+	for _, t := range texts {
+		size := t.FontSize
+		if size <= 0 {
+			size = 10
+		}
+
+		width := t.W
+		if width <= 0 {
+			// Fonts without width tables report zero; approximate instead
+			width = size * 0.5 * float64(len([]rune(t.S)))
+		}
+
+		if strings.TrimSpace(t.S) == "" {
+			if current != nil {
+				words = append(words, *current)
+				current = nil
+			}
+			continue
+		}
+
+		if current != nil &&
+			math.Abs(t.Y-current.y) < size*lineToleranceFactor &&
+			t.X >= current.x0 &&
+			t.X-current.x1 < size*wordGapFactor {
+			current.text += t.S
+			if t.X+width > current.x1 {
+				current.x1 = t.X + width
+			} else {
+				// Zero-width fonts never advance X; grow the estimate instead
+				current.x1 += width
+			}
+			continue
+		}
+
+		if current != nil {
+			words = append(words, *current)
+		}
+		current = &pdfWord{x0: t.X, x1: t.X + width, y: t.Y, size: size, text: t.S}
+	}
+
+	if current != nil {
+		words = append(words, *current)
+	}
+
+	return words
+}
+
+// groupLines buckets words into lines, top of the page first, and orders the
+// words of each line from left to right
+func groupLines(words []pdfWord) [][]pdfWord {
+	sorted := make([]pdfWord, len(words))
+	copy(sorted, words)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].y > sorted[j].y
+	})
+
+	var lines [][]pdfWord
+	for _, word := range sorted {
+		n := len(lines)
+		if n > 0 && math.Abs(lines[n-1][0].y-word.y) < word.size*lineToleranceFactor {
+			lines[n-1] = append(lines[n-1], word)
+			continue
+		}
+		lines = append(lines, []pdfWord{word})
+	}
+
+	for _, line := range lines {
+		sort.Slice(line, func(i, j int) bool {
+			return line[i].x0 < line[j].x0
+		})
+	}
+
+	return lines
+}
+
+// splitCells splits a line into cells at gaps much wider than a space
+func splitCells(line []pdfWord) []pdfCell {
+	var cells []pdfCell
+	for i, word := range line {
+		if i > 0 && word.x0-line[i-1].x1 < word.size*cellGapFactor {
+			last := &cells[len(cells)-1]
+			last.text += " " + word.text
+			last.x1 = word.x1
+			continue
+		}
+		cells = append(cells, pdfCell{x0: word.x0, x1: word.x1, text: word.text})
+	}
+	return cells
+}
+
+// columnsAlign reports whether two lines have the same number of cells and
+// every cell shares a left edge, right edge or centre with the one above it
+func columnsAlign(a, b []pdfCell) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		left := math.Abs(a[i].x0-b[i].x0) <= columnTolerance
+		right := math.Abs(a[i].x1-b[i].x1) <= columnTolerance
+		centre := math.Abs((a[i].x0+a[i].x1)/2-(b[i].x0+b[i].x1)/2) <= columnTolerance
+		if !left && !right && !centre {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tableToMarkdown renders a table so the LLM can read it inside a chunk
+func tableToMarkdown(title string, rows [][]string) string {
+	var md strings.Builder
+
+	md.WriteString(title + "\n\n")
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = markdownCell(cell)
+		}
+		md.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			md.WriteString("|" + strings.Repeat(" --- |", len(row)) + "\n")
+		}
+	}
+
+	return md.String()
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The reconciler compares the bucket with the database. Objects fall into
+// four namespaces, each with its own owner:
+//
+//	blobs/sha256/<hash> and legacy names  referenced by documents.storage_path or blobs
+//	renders/<document id>/                page images of an existing document
+//	uploads/<session id>/                 parts of an open upload session
+//	tmp/                                  in-flight uploads, never needed afterwards
+//
+// An object without its owner is an orphan. Orphans are only reported once
+// they are older than the grace period, which must exceed the time between
+// writing an object and committing the row that references it.
+
+// ReconcileOptions configures ReconcileStorage
+type ReconcileOptions struct {
+	// Objects updated more recently than this are never reported
+	GracePeriod time.Duration
+	// Queue orphans for deletion instead of only reporting them
+	DeleteOrphans bool
+}
+
+// OrphanedObject is a stored object that nothing references
+type OrphanedObject struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Updated time.Time `json:"updated"`
+	Reason  string    `json:"reason"`
+}
+
+// MissingObject is a document whose file is not in the bucket
+type MissingObject struct {
+	DocumentID  string `json:"document_id"`
+	StoragePath string `json:"storage_path"`
+}
+
+// ReconcileReport is the outcome of one ReconcileStorage run
+type ReconcileReport struct {
+	StartedAt      time.Time        `json:"started_at"`
+	FinishedAt     time.Time        `json:"finished_at"`
+	ScannedObjects int              `json:"scanned_objects"`
+	Orphans        []OrphanedObject `json:"orphans"`
+	OrphanBytes    int64            `json:"orphan_bytes"`
+	// Objects and prefixes queued in pending_storage_deletions
+	QueuedDeletions int             `json:"queued_deletions"`
+	Missing         []MissingObject `json:"missing"`
+}
+
+// ReconcileStorage lists the bucket, reports objects that no row references
+// and documents whose object is gone, and sets documents.storage_missing
+// accordingly. With DeleteOrphans the orphans are queued for the purger,
+// which checks once more that they are unreferenced before deleting them.
+func (ds *DocumentService) ReconcileStorage(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	if ds.storageService == nil || !ds.storageService.IsInitialized() {
+		return nil, fmt.Errorf("storage service is not initialized")
+	}
+
+	report := &ReconcileReport{StartedAt: time.Now(), Orphans: []OrphanedObject{}, Missing: []MissingObject{}}
+
+	// Snapshot the database first: anything written after this is newer than
+	// the grace period and skipped. uploaded_at is compared in database time.
+	var scanStart time.Time
+	if err := ds.db.QueryRowContext(ctx, `SELECT LOCALTIMESTAMP`).Scan(&scanStart); err != nil {
+		return nil, fmt.Errorf("failed to read database time: %w", err)
+	}
+	referenced, err := ds.stringSet(ctx, `SELECT storage_path FROM documents WHERE storage_path IS NOT NULL
+		UNION SELECT storage_path FROM blobs`)
+	if err != nil {
+		return nil, err
+	}
+	documentIDs, err := ds.stringSet(ctx, `SELECT id FROM documents`)
+	if err != nil {
+		return nil, err
+	}
+	sessionIDs, err := ds.stringSet(ctx, `SELECT id FROM upload_sessions`)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := ds.stringSet(ctx, `SELECT object_name FROM pending_storage_deletions`)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-opts.GracePeriod)
+	seen := map[string]bool{}
+	// Objects or prefixes to queue in listing order, and whether each is a prefix
+	var deletions []string
+	isPrefix := map[string]bool{}
+
+	err = ds.storageService.ListObjects(ctx, func(obj StoredObject) error {
+		report.ScannedObjects++
+		seen[obj.Name] = true
+
+		unit, prefix, reason := orphanReason(obj.Name, referenced, documentIDs, sessionIDs)
+		if reason == "" || pending[unit] || obj.Updated.After(cutoff) {
+			return nil
+		}
+
+		report.Orphans = append(report.Orphans, OrphanedObject{Name: obj.Name, Size: obj.Size, Updated: obj.Updated, Reason: reason})
+		report.OrphanBytes += obj.Size
+		if _, ok := isPrefix[unit]; !ok {
+			deletions = append(deletions, unit)
+			isPrefix[unit] = prefix
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ds.flagMissingObjects(ctx, report, seen, scanStart); err != nil {
+		return nil, err
+	}
+
+	if opts.DeleteOrphans && len(deletions) > 0 {
+		tx, err := ds.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		for _, unit := range deletions {
+			if err := queueStorageDeletion(ctx, tx, unit, isPrefix[unit]); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		report.QueuedDeletions = len(deletions)
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// orphanReason returns why an object is orphaned, or "" if it is in use,
+// along with the object or prefix that would be deleted for it
+func orphanReason(name string, referenced, documentIDs, sessionIDs map[string]bool) (unit string, prefix bool, reason string) {
+	switch {
+	case strings.HasPrefix(name, "tmp/"):
+		return name, false, "temporary upload"
+	case strings.HasPrefix(name, "renders/"):
+		docID := strings.SplitN(strings.TrimPrefix(name, "renders/"), "/", 2)[0]
+		if documentIDs[docID] {
+			return "", false, ""
+		}
+		return pageImagePrefix(docID), true, "page images of a deleted document"
+	case strings.HasPrefix(name, "uploads/"):
+		sessionID := strings.SplitN(strings.TrimPrefix(name, "uploads/"), "/", 2)[0]
+		if sessionIDs[sessionID] {
+			return "", false, ""
+		}
+		return uploadPartsPrefix(sessionID), true, "part of a closed upload session"
+	case referenced[name]:
+		return "", false, ""
+	default:
+		return name, false, "not referenced by any document"
+	}
+}
+
+// flagMissingObjects records the documents whose object was not listed. Only
+// documents created before the scan started are considered.
+func (ds *DocumentService) flagMissingObjects(ctx context.Context, report *ReconcileReport, seen map[string]bool, scanStart time.Time) error {
+	rows, err := ds.db.QueryContext(ctx, `SELECT id, storage_path FROM documents
+		WHERE storage_path IS NOT NULL AND uploaded_at < $1`, scanStart)
+	if err != nil {
+		return fmt.Errorf("failed to query documents: %w", err)
+	}
+
+	missingIDs := []string{}
+	for rows.Next() {
+		var missing MissingObject
+		if err := rows.Scan(&missing.DocumentID, &missing.StoragePath); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan document: %w", err)
+		}
+		if !seen[missing.StoragePath] {
+			report.Missing = append(report.Missing, missing)
+			missingIDs = append(missingIDs, missing.DocumentID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read documents: %w", err)
+	}
+
+	query := `UPDATE documents SET storage_missing = (id = ANY($1))
+		WHERE uploaded_at < $2 AND (storage_missing OR id = ANY($1))`
+	if _, err := ds.db.ExecContext(ctx, query, pq.Array(missingIDs), scanStart); err != nil {
+		return fmt.Errorf("failed to flag missing documents: %w", err)
+	}
+	return nil
+}
+
+func (ds *DocumentService) stringSet(ctx context.Context, query string) (map[string]bool, error) {
+	rows, err := ds.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query references: %w", err)
+	}
+	defer rows.Close()
+
+	set := map[string]bool{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, fmt.Errorf("failed to scan reference: %w", err)
+		}
+		set[value] = true
+	}
+	return set, rows.Err()
+}
+
+// RunStorageReconciler reconciles the bucket with the database every
+// interval until ctx is cancelled
+func (ds *DocumentService) RunStorageReconciler(ctx context.Context, interval time.Duration, opts ReconcileOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := ds.ReconcileStorage(ctx, opts)
+			if err != nil {
+				fmt.Printf("Storage reconciliation failed: %v\n", err)
+				continue
+			}
+			if len(report.Orphans) > 0 || len(report.Missing) > 0 {
+				fmt.Printf("Storage reconciliation: %d objects scanned, %d orphans (%d bytes, %d deletions queued), %d documents missing their file\n",
+					report.ScannedObjects, len(report.Orphans), report.OrphanBytes, report.QueuedDeletions, len(report.Missing))
+			}
+		}
+	}
+}
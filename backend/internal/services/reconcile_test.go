@@ -0,0 +1,37 @@
+package services
+
+import "testing"
+
+func TestOrphanReason(t *testing.T) {
+	referenced := map[string]bool{"blobs/sha256/abc": true, "documents/legacy.pdf": true}
+	documentIDs := map[string]bool{"doc-1": true}
+	sessionIDs := map[string]bool{"session-1": true}
+
+	tests := []struct {
+		name       string
+		object     string
+		wantUnit   string
+		wantPrefix bool
+		wantReason string
+	}{
+		{name: "referenced blob", object: "blobs/sha256/abc"},
+		{name: "referenced legacy object", object: "documents/legacy.pdf"},
+		{name: "unreferenced blob", object: "blobs/sha256/def", wantUnit: "blobs/sha256/def", wantReason: "not referenced by any document"},
+		{name: "temporary upload", object: "tmp/upload-1", wantUnit: "tmp/upload-1", wantReason: "temporary upload"},
+		{name: "temporary uploads are never referenced", object: "tmp/blobs", wantUnit: "tmp/blobs", wantReason: "temporary upload"},
+		{name: "page image of a document", object: "renders/doc-1/page-1.png"},
+		{name: "page image of a deleted document", object: "renders/doc-2/page-1.png", wantUnit: "renders/doc-2/", wantPrefix: true, wantReason: "page images of a deleted document"},
+		{name: "part of an open session", object: "uploads/session-1/part-0-x"},
+		{name: "part of a closed session", object: "uploads/session-2/part-0-x", wantUnit: "uploads/session-2/", wantPrefix: true, wantReason: "part of a closed upload session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unit, prefix, reason := orphanReason(tt.object, referenced, documentIDs, sessionIDs)
+			if unit != tt.wantUnit || prefix != tt.wantPrefix || reason != tt.wantReason {
+				t.Errorf("orphanReason(%q) = %q, %v, %q, want %q, %v, %q",
+					tt.object, unit, prefix, reason, tt.wantUnit, tt.wantPrefix, tt.wantReason)
+			}
+		})
+	}
+}
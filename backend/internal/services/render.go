@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageImageWidth = 800
+	MinPageImageWidth     = 64
+	MaxPageImageWidth     = 2000
+	ThumbnailWidth        = 200
+
+	// Rendering is CPU heavy; cap the number of concurrent renderer processes
+	maxConcurrentRenders = 2
+)
+
+// PageRenderer renders PDF pages to PNG with a local poppler (pdftoppm)
+// binary and caches every rendered page in the blob store
+type PageRenderer struct {
+	storageService *StorageService
+	rendererPath   string
+	slots          chan struct{}
+}
+
+func NewPageRenderer(storageService *StorageService, rendererPath string) *PageRenderer {
+	return &PageRenderer{
+		storageService: storageService,
+		rendererPath:   rendererPath,
+		slots:          make(chan struct{}, maxConcurrentRenders),
+	}
+}
+
+// IsAvailable reports whether the renderer binary can be found
+func (pr *PageRenderer) IsAvailable() bool {
+	_, err := exec.LookPath(pr.rendererPath)
+	return err == nil
+}
+
+// ClampPageImageWidth keeps requested widths within the supported range
+func ClampPageImageWidth(width int) int {
+	if width <= 0 {
+		return DefaultPageImageWidth
+	}
+	return max(MinPageImageWidth, min(width, MaxPageImageWidth))
+}
+
+func pageImageObjectName(docID string, page, width int) string {
+	return fmt.Sprintf("renders/%s/page-%d-w%d.png", docID, page, width)
+}
+
+func pageImagePrefix(docID string) string {
+	return fmt.Sprintf("renders/%s/", docID)
+}
+
+// RenderPage returns page (1-based) of the PDF stored at storagePath as a PNG
+// of the given width, rendering it only if it is not already cached
+func (pr *PageRenderer) RenderPage(ctx context.Context, docID, storagePath string, page, width int) ([]byte, error) {
+	objectName := pageImageObjectName(docID, page, width)
+
+	cached, err := pr.storageService.DownloadFile(ctx, objectName)
+	if err == nil {
+		defer cached.Close()
+		return io.ReadAll(cached)
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return nil, fmt.Errorf("failed to read cached page image: %w", err)
+	}
+
+	image, err := pr.render(ctx, storagePath, page, width)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pr.storageService.WriteObject(ctx, objectName, "image/png", bytes.NewReader(image)); err != nil {
+		// Serving the image matters more than caching it
+		fmt.Printf("Warning: failed to cache page image %s: %v\n", objectName, err)
+	}
+
+	return image, nil
+}
+
+func (pr *PageRenderer) render(ctx context.Context, storagePath string, page, width int) ([]byte, error) {
+	select {
+	case pr.slots <- struct{}{}:
+		defer func() { <-pr.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	workDir, err := os.MkdirTemp("", "render-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create render directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	inputPath := filepath.Join(workDir, "input.pdf")
+	if err := pr.downloadTo(ctx, storagePath, inputPath); err != nil {
+		return nil, err
+	}
+
+	outputPrefix := filepath.Join(workDir, "page")
+	cmd := exec.CommandContext(ctx, pr.rendererPath,
+		"-png", "-singlefile",
+		"-f", strconv.Itoa(page), "-l", strconv.Itoa(page),
+		"-scale-to-x", strconv.Itoa(width), "-scale-to-y", "-1",
+		inputPath, outputPrefix)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "Wrong page range") {
+			return nil, fmt.Errorf("page %d not found", page)
+		}
+		return nil, fmt.Errorf("failed to render page %d: %v: %s", page, err, stderr.String())
+	}
+
+	image, err := os.ReadFile(outputPrefix + ".png")
+	if err != nil {
+		// pdftoppm exits cleanly without output for pages past the end
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("page %d not found", page)
+		}
+		return nil, fmt.Errorf("failed to read rendered page: %w", err)
+	}
+
+	return image, nil
+}
+
+func (pr *PageRenderer) downloadTo(ctx context.Context, storagePath, path string) error {
+	reader, err := pr.storageService.DownloadFile(ctx, storagePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return fmt.Errorf("failed to download document for rendering: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRenders removes every cached page image of a document
+func (pr *PageRenderer) DeleteRenders(ctx context.Context, docID string) error {
+	return pr.storageService.DeletePrefix(ctx, pageImagePrefix(docID))
+}
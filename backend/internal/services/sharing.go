@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"strategy-analyst/internal/models"
+)
+
+const (
+	// Lifetime of a share link created without an expiry, and the longest allowed
+	defaultShareLinkTTL = 7 * 24 * time.Hour
+	maxShareLinkTTL     = 90 * 24 * time.Hour
+	// Most chat messages a share link can include
+	maxShareLinkMessages = 200
+)
+
+func validateSharePermission(permission models.SharePermission) error {
+	if _, ok := shareActions[permission]; !ok {
+		return fmt.Errorf("invalid permission %q: must be view or chat", permission)
+	}
+	return nil
+}
+
+// GetDocumentShares lists the users a document is shared with
+func (ds *DocumentService) GetDocumentShares(ctx context.Context, docID, userID string) ([]*models.DocumentShare, error) {
+	if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionShare); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT s.document_id, s.user_id, u.email, s.permission, COALESCE(s.shared_by, ''), s.created_at
+		FROM document_shares s JOIN users u ON u.id = s.user_id
+		WHERE s.document_id = $1 ORDER BY LOWER(u.email)`
+	rows, err := ds.db.QueryContext(ctx, query, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []*models.DocumentShare{}
+	for rows.Next() {
+		share := &models.DocumentShare{}
+		if err := rows.Scan(&share.DocumentID, &share.UserID, &share.Email, &share.Permission, &share.SharedBy, &share.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan document share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// ShareDocument gives a user, found by email, view or chat access to one
+// document. Sharing with a user who already has a share changes its
+// permission.
+func (ds *DocumentService) ShareDocument(ctx context.Context, docID, userID string, req models.ShareDocumentRequest) (*models.DocumentShare, error) {
+	if err := validateSharePermission(req.Permission); err != nil {
+		return nil, err
+	}
+	if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionShare); err != nil {
+		return nil, err
+	}
+
+	share := &models.DocumentShare{DocumentID: docID, Permission: req.Permission, SharedBy: userID}
+	err := ds.db.QueryRowContext(ctx, `SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)`, strings.TrimSpace(req.Email)).
+		Scan(&share.UserID, &share.Email)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found: they must sign in once before a document can be shared with them")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if share.UserID == userID {
+		return nil, fmt.Errorf("invalid request: a document cannot be shared with yourself")
+	}
+
+	query := `INSERT INTO document_shares (document_id, user_id, permission, shared_by, created_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (document_id, user_id) DO UPDATE SET permission = EXCLUDED.permission, shared_by = EXCLUDED.shared_by
+		RETURNING created_at`
+	if err := ds.db.QueryRowContext(ctx, query, docID, share.UserID, share.Permission, userID).Scan(&share.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to share document: %w", err)
+	}
+
+	return share, nil
+}
+
+// RevokeDocumentShare removes a user's access to a shared document. Users the
+// document is shared with may also remove their own share.
+func (ds *DocumentService) RevokeDocumentShare(ctx context.Context, docID, userID, sharedWithID string) error {
+	if sharedWithID != userID {
+		if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionShare); err != nil {
+			return err
+		}
+	} else if err := CheckScope(ctx, ActionShare); err != nil {
+		return err
+	}
+
+	result, err := ds.db.ExecContext(ctx, `DELETE FROM document_shares WHERE document_id = $1 AND user_id = $2`, docID, sharedWithID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("share not found")
+	}
+	return nil
+}
+
+// GetSharedDocuments lists the documents outside the trash that are shared
+// with the user, most recently shared first
+func (ds *DocumentService) GetSharedDocuments(ctx context.Context, userID string) ([]*models.SharedDocument, error) {
+	// The share columns are selected through a subquery so that the document
+	// columns stay unambiguous
+	query := `SELECT ` + documentColumns + `, s.permission, COALESCE(s.shared_by, ''), s.shared_at
+		FROM documents JOIN (SELECT document_id, permission, shared_by, created_at AS shared_at FROM document_shares WHERE user_id = $1) s
+			ON s.document_id = documents.id
+		WHERE deleted_at IS NULL ORDER BY s.shared_at DESC`
+	rows, err := ds.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shared documents: %w", err)
+	}
+	defer rows.Close()
+
+	shared := []*models.SharedDocument{}
+	documents := []*models.Document{}
+	for rows.Next() {
+		item := &models.SharedDocument{}
+		doc, err := scanDocument(rowWithExtra{row: rows, extra: []interface{}{&item.Permission, &item.SharedBy, &item.SharedAt}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan shared document: %w", err)
+		}
+		item.Document = doc
+		shared = append(shared, item)
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read shared documents: %w", err)
+	}
+
+	if err := ds.attachTags(ctx, documents); err != nil {
+		return nil, err
+	}
+	return shared, nil
+}
+
+// hashShareToken returns the stored form of a share link token
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateShareLink creates a read-only link to a document's summary and the
+// chosen messages of its chat, which works without signing in until it
+// expires or is revoked. The token is only returned here.
+func (ds *DocumentService) CreateShareLink(ctx context.Context, docID, userID string, req models.CreateShareLinkRequest) (*models.ShareLink, error) {
+	ttl := defaultShareLinkTTL
+	if req.ExpiresInHours < 0 {
+		return nil, fmt.Errorf("invalid expiry: expires_in_hours must be positive")
+	}
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl > maxShareLinkTTL {
+		return nil, fmt.Errorf("invalid expiry: share links last at most %d hours", int(maxShareLinkTTL.Hours()))
+	}
+	if len(req.MessageIDs) > maxShareLinkMessages {
+		return nil, fmt.Errorf("invalid request: a share link can include at most %d messages", maxShareLinkMessages)
+	}
+	if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionShare); err != nil {
+		return nil, err
+	}
+
+	messageIDs := []string{}
+	seen := map[string]bool{}
+	for _, id := range req.MessageIDs {
+		if !seen[id] {
+			seen[id] = true
+			messageIDs = append(messageIDs, id)
+		}
+	}
+	// Only the creator's own questions and the answers to them, which are
+	// stored under their user ID, may be published; the document's chat is
+	// shared with other members who never agreed to that
+	if len(messageIDs) > 0 {
+		var found int
+		query := `SELECT COUNT(*) FROM chat_history WHERE document_id = $1 AND id = ANY($2) AND user_id = $3`
+		if err := ds.db.QueryRowContext(ctx, query, docID, pq.Array(messageIDs), userID).Scan(&found); err != nil {
+			return nil, fmt.Errorf("failed to check messages: %w", err)
+		}
+		if found != len(messageIDs) {
+			return nil, fmt.Errorf("invalid request: messages must be your own messages in the document's chat")
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+
+	link := &models.ShareLink{
+		ID:         uuid.New().String(),
+		DocumentID: docID,
+		Token:      base64.RawURLEncoding.EncodeToString(secret),
+		MessageIDs: messageIDs,
+		CreatedBy:  userID,
+	}
+	query := `INSERT INTO share_links (id, document_id, token_hash, message_ids, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP + $6 * INTERVAL '1 second')
+		RETURNING created_at, expires_at`
+	err := ds.db.QueryRowContext(ctx, query, link.ID, docID, hashShareToken(link.Token), pq.Array(messageIDs), userID, int64(ttl.Seconds())).
+		Scan(&link.CreatedAt, &link.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return link, nil
+}
+
+// GetShareLinks lists a document's share links, including expired and
+// revoked ones, newest first
+func (ds *DocumentService) GetShareLinks(ctx context.Context, docID, userID string) ([]*models.ShareLink, error) {
+	if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionShare); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, document_id, message_ids, COALESCE(created_by, ''), created_at, expires_at, revoked_at
+		FROM share_links WHERE document_id = $1 ORDER BY created_at DESC`
+	rows, err := ds.db.QueryContext(ctx, query, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []*models.ShareLink{}
+	for rows.Next() {
+		link := &models.ShareLink{}
+		err := rows.Scan(&link.ID, &link.DocumentID, pq.Array(&link.MessageIDs), &link.CreatedBy, &link.CreatedAt, &link.ExpiresAt, &link.RevokedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// RevokeShareLink stops a share link from working before it expires
+func (ds *DocumentService) RevokeShareLink(ctx context.Context, docID, linkID, userID string) error {
+	if _, err := ds.AuthorizeDocument(ctx, docID, userID, ActionShare); err != nil {
+		return err
+	}
+
+	query := `UPDATE share_links SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND document_id = $2 AND revoked_at IS NULL`
+	result, err := ds.db.ExecContext(ctx, query, linkID, docID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("share link not found")
+	}
+	return nil
+}
+
+// GetPublicShare returns what a share link shows. Unknown, expired and revoked
+// tokens, and links to documents in the trash, are all "not found".
+func (ds *DocumentService) GetPublicShare(ctx context.Context, token string) (*models.PublicShare, error) {
+	if strings.TrimSpace(token) == "" {
+		return nil, fmt.Errorf("share link not found")
+	}
+
+	var docID string
+	var messageIDs []string
+	share := &models.PublicShare{Messages: []*models.SharedMessage{}}
+	query := `SELECT l.id, l.document_id, l.message_ids, l.expires_at FROM share_links l JOIN documents d ON d.id = l.document_id
+		WHERE l.token_hash = $1 AND l.revoked_at IS NULL AND l.expires_at > CURRENT_TIMESTAMP AND d.deleted_at IS NULL`
+	err := ds.db.QueryRowContext(ctx, query, hashShareToken(token)).Scan(&share.LinkID, &docID, pq.Array(&messageIDs), &share.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("share link not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	doc, err := scanDocument(ds.db.QueryRowContext(ctx, `SELECT `+documentColumns+` FROM documents WHERE id = $1`, docID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	share.DocumentID = doc.ID
+	share.Title = doc.DisplayName()
+	share.FileName = doc.FileName
+	share.Description = doc.Description
+
+	if share.Summary, err = ds.GetDocumentSummary(ctx, docID); err != nil {
+		return nil, err
+	}
+
+	if len(messageIDs) > 0 {
+		query := `SELECT message_type, message_content, timestamp FROM chat_history
+			WHERE document_id = $1 AND id = ANY($2) ORDER BY timestamp ASC, id ASC`
+		rows, err := ds.db.QueryContext(ctx, query, docID, pq.Array(messageIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query shared messages: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			msg := &models.SharedMessage{}
+			if err := rows.Scan(&msg.MessageType, &msg.MessageContent, &msg.Timestamp); err != nil {
+				return nil, fmt.Errorf("failed to scan shared message: %w", err)
+			}
+			share.Messages = append(share.Messages, msg)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read shared messages: %w", err)
+		}
+	}
+
+	return share, nil
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"strategy-analyst/internal/models"
+)
+
+func TestValidateSharePermission(t *testing.T) {
+	for _, permission := range []models.SharePermission{models.SharePermissionView, models.SharePermissionChat} {
+		if err := validateSharePermission(permission); err != nil {
+			t.Errorf("validateSharePermission(%q) = %v, want nil", permission, err)
+		}
+	}
+	for _, permission := range []models.SharePermission{"", "edit", "owner", "VIEW"} {
+		if err := validateSharePermission(permission); err == nil {
+			t.Errorf("validateSharePermission(%q) succeeded, want an error", permission)
+		}
+	}
+}
+
+func TestHashShareToken(t *testing.T) {
+	hash := hashShareToken("token-1")
+	if len(hash) != 64 {
+		t.Errorf("hashShareToken() = %q, want 64 hex characters", hash)
+	}
+	if hash == "token-1" {
+		t.Error("hashShareToken() returned the token itself")
+	}
+	if hashShareToken("token-1") != hash {
+		t.Error("hashShareToken() is not deterministic")
+	}
+	if hashShareToken("token-2") == hash {
+		t.Error("hashShareToken() gave two tokens the same hash")
+	}
+}
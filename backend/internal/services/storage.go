@@ -2,13 +2,24 @@ package services
 
 import (
 	"context" // Context for handling requests
-	"fmt"     // Used for formatting strings
-	"io"      // Used for reading and writing files
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt" // Used for formatting strings
+	"io"  // Used for reading and writing files
+	"net/http"
+	"net/url"
 	"time"
 
 	"cloud.google.com/go/storage" // Google Cloud Storage client
+	"github.com/google/uuid"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
+// ErrObjectNotFound is returned (wrapped) when a requested object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
 // StorageService struct to store bucket name and client
 type StorageService struct {
 	bucketName string
@@ -53,27 +64,84 @@ func NewStorageService(bucketName string) *StorageService {
 	}
 }
 
-// UploadFile function to upload a file to the storage service
-func (s *StorageService) UploadFile(ctx context.Context, fileName string, content io.Reader) (string, error) {
+// UploadedFile describes an object written by UploadFile
+type UploadedFile struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// BlobObjectName is the content-addressed object name of a file
+func BlobObjectName(sha256Hex string) string {
+	return "blobs/sha256/" + sha256Hex
+}
+
+// UploadFile function to upload a file to the storage service. The content is
+// streamed to a temporary object while its size and SHA-256 are computed, then
+// moved to its content-addressed name; identical files therefore share one
+// object. If reading fails part-way the upload is aborted and nothing is kept.
+func (s *StorageService) UploadFile(ctx context.Context, content io.Reader) (*UploadedFile, error) {
 	if s.client == nil {
-		return "", fmt.Errorf("storage client not initialized")
+		return nil, fmt.Errorf("storage client not initialized")
 	}
 
 	bucket := s.client.Bucket(s.bucketName)
 
-	// Create unique filename with timestamp
-	uniqueFileName := fmt.Sprintf("%d_%s", time.Now().Unix(), fileName)
+	// The hash is only known once the content has been read
+	tempObj := bucket.Object("tmp/" + uuid.New().String())
 
-	obj := bucket.Object(uniqueFileName)
-	writer := obj.NewWriter(ctx)
+	hash := sha256.New()
+	size, err := s.writeStream(ctx, tempObj, "", io.TeeReader(content, hash))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+	defer func() {
+		if err := tempObj.Delete(context.Background()); err != nil {
+			fmt.Printf("Warning: failed to delete temporary upload %s: %v\n", tempObj.ObjectName(), err)
+		}
+	}()
 
-	defer writer.Close()
+	sum := hex.EncodeToString(hash.Sum(nil))
+	blob := bucket.Object(BlobObjectName(sum))
 
-	if _, err := io.Copy(writer, content); err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
+	// Copy only if no identical file is stored yet
+	_, err = blob.If(storage.Conditions{DoesNotExist: true}).CopierFrom(tempObj).Run(ctx)
+	if err != nil && !isPreconditionFailed(err) {
+		return nil, fmt.Errorf("failed to store file: %w", err)
 	}
 
-	return uniqueFileName, nil
+	return &UploadedFile{
+		Path:   blob.ObjectName(),
+		Size:   size,
+		SHA256: sum,
+	}, nil
+}
+
+// writeStream copies content into obj, aborting the upload on a read error
+func (s *StorageService) writeStream(ctx context.Context, obj *storage.ObjectHandle, contentType string, content io.Reader) (int64, error) {
+	// Cancelling the writer's context is the only way to abort an upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer := obj.NewWriter(ctx)
+	writer.ContentType = contentType
+	size, err := io.Copy(writer, content)
+	if err != nil {
+		cancel()
+		writer.Close()
+		return 0, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func isPreconditionFailed(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
 }
 
 func (s *StorageService) DownloadFile(ctx context.Context, fileName string) (io.ReadCloser, error) {
@@ -86,12 +154,53 @@ func (s *StorageService) DownloadFile(ctx context.Context, fileName string) (io.
 
 	reader, err := obj.NewReader(ctx)
 	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, fmt.Errorf("failed to download file: %w", ErrObjectNotFound)
+		}
 		return nil, fmt.Errorf("failed to download file: %w", err)
 	}
 
 	return reader, nil
 }
 
+// WriteObject stores content under the exact object name given, replacing
+// any existing object. Used for derived files such as rendered pages.
+func (s *StorageService) WriteObject(ctx context.Context, objectName, contentType string, content io.Reader) error {
+	if s.client == nil {
+		return fmt.Errorf("storage client not initialized")
+	}
+
+	obj := s.client.Bucket(s.bucketName).Object(objectName)
+	if _, err := s.writeStream(ctx, obj, contentType, content); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePrefix deletes every object whose name starts with prefix
+func (s *StorageService) DeletePrefix(ctx context.Context, prefix string) error {
+	if s.client == nil {
+		return fmt.Errorf("storage client not initialized")
+	}
+
+	bucket := s.client.Bucket(s.bucketName)
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("failed to delete object %s: %w", attrs.Name, err)
+		}
+	}
+}
+
 func (s *StorageService) DeleteFile(ctx context.Context, fileName string) error {
 	if s.client == nil {
 		return fmt.Errorf("storage client not initialized")
@@ -101,12 +210,178 @@ func (s *StorageService) DeleteFile(ctx context.Context, fileName string) error
 	obj := bucket.Object(fileName)
 
 	if err := obj.Delete(ctx); err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("failed to delete file: %w", ErrObjectNotFound)
+		}
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
 
 	return nil
 }
 
+// StoredObject describes an object found by ListObjects
+type StoredObject struct {
+	Name    string
+	Size    int64
+	Updated time.Time
+}
+
+// ListObjects calls fn for every object in the bucket, in name order, and
+// stops at the first error fn returns
+func (s *StorageService) ListObjects(ctx context.Context, fn func(StoredObject) error) error {
+	if s.client == nil {
+		return fmt.Errorf("storage client not initialized")
+	}
+
+	it := s.client.Bucket(s.bucketName).Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		if err := fn(StoredObject{Name: attrs.Name, Size: attrs.Size, Updated: attrs.Updated}); err != nil {
+			return err
+		}
+	}
+}
+
+// ObjectExists reports whether an object is stored under objectName
+func (s *StorageService) ObjectExists(ctx context.Context, objectName string) (bool, error) {
+	if s.client == nil {
+		return false, fmt.Errorf("storage client not initialized")
+	}
+
+	_, err := s.client.Bucket(s.bucketName).Object(objectName).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get object %s: %w", objectName, err)
+	}
+	return true, nil
+}
+
+// ObjectReader reads an object through ranged requests so it can be seeked,
+// which lets http.ServeContent answer Range requests without buffering
+type ObjectReader struct {
+	ctx         context.Context
+	obj         *storage.ObjectHandle
+	reader      *storage.Reader
+	offset      int64
+	Size        int64
+	ContentType string
+	Updated     time.Time
+}
+
+// OpenObject returns a seekable reader over an object
+func (s *StorageService) OpenObject(ctx context.Context, objectName string) (*ObjectReader, error) {
+	if s.client == nil {
+		return nil, fmt.Errorf("storage client not initialized")
+	}
+
+	obj := s.client.Bucket(s.bucketName).Object(objectName)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, fmt.Errorf("failed to open file: %w", ErrObjectNotFound)
+		}
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return &ObjectReader{
+		ctx:         ctx,
+		obj:         obj.Generation(attrs.Generation),
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		Updated:     attrs.Updated,
+	}, nil
+}
+
+func (o *ObjectReader) Read(p []byte) (int, error) {
+	if o.offset >= o.Size {
+		return 0, io.EOF
+	}
+
+	if o.reader == nil {
+		reader, err := o.obj.NewRangeReader(o.ctx, o.offset, -1)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read file: %w", err)
+		}
+		o.reader = reader
+	}
+
+	n, err := o.reader.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = o.offset + offset
+	case io.SeekEnd:
+		target = o.Size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("negative position")
+	}
+
+	// Reopen lazily at the new position on the next read
+	if target != o.offset {
+		o.closeReader()
+		o.offset = target
+	}
+	return target, nil
+}
+
+func (o *ObjectReader) Close() error {
+	o.closeReader()
+	return nil
+}
+
+func (o *ObjectReader) closeReader() {
+	if o.reader != nil {
+		o.reader.Close()
+		o.reader = nil
+	}
+}
+
+// SignedURL returns a short-lived URL that downloads the object directly from
+// the bucket as downloadName. It fails when the credentials in use cannot
+// sign, in which case callers should stream the object instead.
+func (s *StorageService) SignedURL(objectName, downloadName, contentType string, ttl time.Duration) (string, error) {
+	if s.client == nil {
+		return "", fmt.Errorf("storage client not initialized")
+	}
+
+	query := url.Values{}
+	query.Set("response-content-disposition", ContentDisposition("attachment", downloadName))
+	if contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+
+	signed, err := s.client.Bucket(s.bucketName).SignedURL(objectName, &storage.SignedURLOptions{
+		Scheme:          storage.SigningSchemeV4,
+		Method:          "GET",
+		Expires:         time.Now().Add(ttl),
+		QueryParameters: query,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign URL: %w", err)
+	}
+
+	return signed, nil
+}
+
 // IsInitialized checks if the GCS client is properly initialized
 func (s *StorageService) IsInitialized() bool {
 	return s.client != nil
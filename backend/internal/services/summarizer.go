@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"strategy-analyst/internal/models"
+)
+
+const (
+	// Upper bound on the characters sent to a single map/reduce call
+	summaryGroupChars = 24000
+	// Number of section summaries generated concurrently
+	summaryConcurrency = 4
+	// Safety net against summaries that refuse to shrink
+	maxSummaryLevels = 5
+	// Least content each document gets when several share one prompt
+	minDocumentContextChars = 2000
+)
+
+// SummarizationService fits document content into the model's context window.
+// Content that is too large is summarized hierarchically: chunk groups are
+// summarized first, then the summaries themselves, until the result fits.
+// Every intermediate summary is cached per document so repeated questions
+// against the same large document only pay for summarization once.
+type SummarizationService struct {
+	db            *sql.DB
+	aiService     *AIService
+	contextBudget int
+}
+
+func NewSummarizationService(db *sql.DB, aiService *AIService, contextBudget int) *SummarizationService {
+	return &SummarizationService{
+		db:            db,
+		aiService:     aiService,
+		contextBudget: contextBudget,
+	}
+}
+
+// ContextBudget is the number of characters of document content that fit in a
+// single prompt
+func (ss *SummarizationService) ContextBudget() int {
+	return ss.contextBudget
+}
+
+// DocumentBudget splits the context budget evenly between documents that
+// share one prompt, but never below minDocumentContextChars each
+func (ss *SummarizationService) DocumentBudget(documents int) int {
+	return max(ss.contextBudget/max(documents, 1), minDocumentContextChars)
+}
+
+// FitContext returns chunks unchanged when they fit within budget characters,
+// and otherwise the highest-level summaries needed to fit
+func (ss *SummarizationService) FitContext(ctx context.Context, doc *models.Document, chunks []string, budget int) ([]string, error) {
+	if totalLength(chunks) <= budget {
+		return chunks, nil
+	}
+	if ss.aiService == nil {
+		return nil, fmt.Errorf("AI service not available for summarization")
+	}
+
+	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
+	current := chunks
+	for level := 1; level <= maxSummaryLevels; level++ {
+		groupChars := min(summaryGroupChars, budget)
+		groups := groupByLength(current, groupChars)
+		log.Printf(logPrefix+"Summarizing %d sections into %d groups (level %d)\n", len(current), len(groups), level)
+
+		summaries, err := ss.summarizeLevel(ctx, doc, level, groupChars, groups)
+		if err != nil {
+			return nil, err
+		}
+
+		if totalLength(summaries) <= budget {
+			return summaries, nil
+		}
+		if len(summaries) == 1 || totalLength(summaries) >= totalLength(current) {
+			// Summaries stopped shrinking; truncate rather than loop forever
+			return truncateToBudget(summaries, budget), nil
+		}
+		current = summaries
+	}
+
+	return truncateToBudget(current, budget), nil
+}
+
+// summarizeLevel summarizes groups packed to at most groupChars characters.
+// Cached summaries are keyed by the group size as well as the position, since
+// a different budget splits the same sections into different groups.
+func (ss *SummarizationService) summarizeLevel(ctx context.Context, doc *models.Document, level, groupChars int, groups [][]string) ([]string, error) {
+	summaries := make([]string, len(groups))
+	errs := make([]error, len(groups))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, summaryConcurrency)
+	for i, group := range groups {
+		wg.Add(1)
+		go func(i int, group []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summaries[i], errs[i] = ss.summarizeGroup(ctx, doc, level, groupChars, i, group)
+		}(i, group)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize group %d at level %d: %w", i, level, err)
+		}
+	}
+
+	return summaries, nil
+}
+
+func (ss *SummarizationService) summarizeGroup(ctx context.Context, doc *models.Document, level, groupChars, groupIndex int, group []string) (string, error) {
+	sourceHash := hashSections(group)
+
+	cached, err := ss.getCachedSummary(ctx, doc.ID, level, groupChars, groupIndex, sourceHash)
+	if err != nil {
+		log.Printf("[Document: %s] Failed to read summary cache: %v\n", doc.ID, err)
+	} else if cached != "" {
+		return cached, nil
+	}
+
+	summary, err := ss.aiService.SummarizeSection(ctx, group, doc.FileName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := ss.cacheSummary(ctx, doc.ID, level, groupChars, groupIndex, sourceHash, summary); err != nil {
+		log.Printf("[Document: %s] Failed to cache summary: %v\n", doc.ID, err)
+	}
+
+	return summary, nil
+}
+
+func (ss *SummarizationService) getCachedSummary(ctx context.Context, docID string, level, groupChars, groupIndex int, sourceHash string) (string, error) {
+	query := `SELECT content FROM document_summary_nodes
+		WHERE document_id = $1 AND level = $2 AND group_chars = $3 AND group_index = $4 AND source_hash = $5`
+
+	var content string
+	err := ss.db.QueryRowContext(ctx, query, docID, level, groupChars, groupIndex, sourceHash).Scan(&content)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return content, nil
+}
+
+func (ss *SummarizationService) cacheSummary(ctx context.Context, docID string, level, groupChars, groupIndex int, sourceHash, content string) error {
+	query := `INSERT INTO document_summary_nodes (document_id, level, group_chars, group_index, source_hash, content, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)
+		ON CONFLICT (document_id, level, group_chars, group_index) DO UPDATE SET
+			source_hash = EXCLUDED.source_hash,
+			content = EXCLUDED.content,
+			created_at = EXCLUDED.created_at`
+	_, err := ss.db.ExecContext(ctx, query, docID, level, groupChars, groupIndex, sourceHash, content)
+	return err
+}
+
+// ClearCache drops the cached intermediate summaries of a document
+func (ss *SummarizationService) ClearCache(ctx context.Context, docID string) error {
+	_, err := ss.db.ExecContext(ctx, `DELETE FROM document_summary_nodes WHERE document_id = $1`, docID)
+	if err != nil {
+		return fmt.Errorf("failed to clear summary cache: %w", err)
+	}
+	return nil
+}
+
+// groupByLength packs consecutive sections into groups of at most maxChars
+// characters. A single oversized section still gets a group of its own.
+func groupByLength(sections []string, maxChars int) [][]string {
+	var groups [][]string
+	var current []string
+	currentLen := 0
+
+	for _, section := range sections {
+		if currentLen+len(section) > maxChars && len(current) > 0 {
+			groups = append(groups, current)
+			current = nil
+			currentLen = 0
+		}
+		current = append(current, section)
+		currentLen += len(section)
+	}
+
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+
+	return groups
+}
+
+func truncateToBudget(sections []string, budget int) []string {
+	var result []string
+	remaining := budget
+
+	for _, section := range sections {
+		if remaining <= 0 {
+			break
+		}
+		if len(section) > remaining {
+			section = strings.ToValidUTF8(section[:remaining], "")
+		}
+		result = append(result, section)
+		remaining -= len(section)
+	}
+
+	return result
+}
+
+func totalLength(sections []string) int {
+	total := 0
+	for _, section := range sections {
+		total += len(section)
+	}
+	return total
+}
+
+func hashSections(sections []string) string {
+	hash := sha256.New()
+	for _, section := range sections {
+		hash.Write([]byte(section))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+// storeTables saves detected tables and gives each one a chunk of its own
+// holding the Markdown rendering, numbered after the text chunks
+func (ds *DocumentService) storeTables(ctx context.Context, doc *models.Document, tables []pdfTable, firstChunkIndex int) {
+	logPrefix := fmt.Sprintf("[Document: %s] ", doc.ID)
+
+	stored := 0
+	for i, table := range tables {
+		rows, err := json.Marshal(table.Rows)
+		if err != nil {
+			log.Printf(logPrefix+"Failed to encode table %d: %v\n", i, err)
+			continue
+		}
+
+		chunkID := uuid.New().String()
+		title := fmt.Sprintf("Table %d (page %d)", i+1, table.PageNumber)
+		chunkQuery := `INSERT INTO document_chunks (id, document_id, chunk_index, content) VALUES ($1, $2, $3, $4)`
+		_, err = ds.db.ExecContext(ctx, chunkQuery, chunkID, doc.ID, firstChunkIndex+i, tableToMarkdown(title, table.Rows))
+		if err != nil {
+			log.Printf(logPrefix+"Failed to store chunk for table %d: %v\n", i, err)
+			continue
+		}
+
+		tableQuery := `INSERT INTO document_tables (id, document_id, chunk_id, page_number, table_index, rows, created_at) VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP)`
+		_, err = ds.db.ExecContext(ctx, tableQuery, uuid.New().String(), doc.ID, chunkID, table.PageNumber, i, rows)
+		if err != nil {
+			log.Printf(logPrefix+"Failed to store table %d: %v\n", i, err)
+			continue
+		}
+		stored++
+	}
+
+	log.Printf(logPrefix+"Stored %d out of %d detected tables\n", stored, len(tables))
+}
+
+// GetDocumentTables lists the tables detected in a document
+func (ds *DocumentService) GetDocumentTables(ctx context.Context, docID, userID string) ([]*models.DocumentTable, error) {
+	if _, err := ds.GetDocument(ctx, docID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, document_id, chunk_id, page_number, table_index, rows, created_at FROM document_tables WHERE document_id = $1 ORDER BY table_index`
+	rows, err := ds.db.QueryContext(ctx, query, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tables: %w", err)
+	}
+	defer rows.Close()
+
+	tables := []*models.DocumentTable{}
+	for rows.Next() {
+		table, err := scanTable(rows)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, rows.Err()
+}
+
+func (ds *DocumentService) GetDocumentTable(ctx context.Context, docID, tableID, userID string) (*models.DocumentTable, error) {
+	if _, err := ds.GetDocument(ctx, docID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT id, document_id, chunk_id, page_number, table_index, rows, created_at FROM document_tables WHERE id = $1 AND document_id = $2`
+	table, err := scanTable(ds.db.QueryRowContext(ctx, query, tableID, docID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("table not found")
+		}
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func scanTable(row rowScanner) (*models.DocumentTable, error) {
+	table := &models.DocumentTable{}
+	var rowsJSON []byte
+	if err := row.Scan(&table.ID, &table.DocumentID, &table.ChunkID, &table.PageNumber, &table.TableIndex, &rowsJSON, &table.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan table: %w", err)
+	}
+
+	if err := json.Unmarshal(rowsJSON, &table.Rows); err != nil {
+		return nil, fmt.Errorf("failed to decode table rows: %w", err)
+	}
+
+	// The first row is the header; expose it separately for convenience
+	if len(table.Rows) > 0 {
+		table.Columns = table.Rows[0]
+		table.Rows = table.Rows[1:]
+	}
+
+	return table, nil
+}
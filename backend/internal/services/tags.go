@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"strategy-analyst/internal/models"
+)
+
+const maxTagNameLength = 100
+
+func validateTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("tag name is required")
+	}
+	if len(name) > maxTagNameLength {
+		return "", fmt.Errorf("invalid tag name")
+	}
+	return name, nil
+}
+
+// GetTags returns the tags of a workspace with the number of documents using
+// each
+func (ds *DocumentService) GetTags(ctx context.Context, userID, workspaceID string) ([]*models.Tag, error) {
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT t.id, t.workspace_id, t.name, t.created_at, COUNT(d.id)
+		FROM tags t LEFT JOIN document_tags dt ON dt.tag_id = t.id
+		LEFT JOIN documents d ON d.id = dt.document_id AND d.deleted_at IS NULL
+		WHERE t.workspace_id = $1 GROUP BY t.id ORDER BY LOWER(t.name)`
+	rows, err := ds.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []*models.Tag{}
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.WorkspaceID, &tag.Name, &tag.CreatedAt, &tag.DocumentCount); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetTag returns a tag the user may view
+func (ds *DocumentService) GetTag(ctx context.Context, tagID, userID string) (*models.Tag, error) {
+	return ds.authorizeTag(ctx, tagID, userID, ActionView)
+}
+
+// authorizeTag loads a tag and checks that the user may perform action in
+// its workspace
+func (ds *DocumentService) authorizeTag(ctx context.Context, tagID, userID string, action Action) (*models.Tag, error) {
+	tag := &models.Tag{}
+	query := `SELECT t.id, t.workspace_id, t.name, t.created_at, (SELECT COUNT(*) FROM document_tags dt JOIN documents d ON d.id = dt.document_id
+			WHERE dt.tag_id = t.id AND d.deleted_at IS NULL)
+		FROM tags t WHERE t.id = $1`
+	err := ds.db.QueryRowContext(ctx, query, tagID).Scan(&tag.ID, &tag.WorkspaceID, &tag.Name, &tag.CreatedAt, &tag.DocumentCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tag not found")
+		}
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+
+	if err := ds.access.AuthorizeResource(ctx, userID, tag.WorkspaceID, action, "tag"); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// CreateTag creates a tag in a workspace; tag names are unique per
+// workspace, ignoring case
+func (ds *DocumentService) CreateTag(ctx context.Context, userID, workspaceID, name string) (*models.Tag, error) {
+	name, err := validateTagName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionEdit); err != nil {
+		return nil, err
+	}
+
+	tagID := uuid.New().String()
+	query := `INSERT INTO tags (id, user_id, workspace_id, name, created_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)`
+	if _, err := ds.db.ExecContext(ctx, query, tagID, userID, workspaceID, name); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("tag %q already exists", name)
+		}
+		return nil, fmt.Errorf("failed to create tag: %w", err)
+	}
+
+	return ds.GetTag(ctx, tagID, userID)
+}
+
+// RenameTag renames a tag on every document that carries it
+func (ds *DocumentService) RenameTag(ctx context.Context, tagID, userID, name string) (*models.Tag, error) {
+	name, err := validateTagName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ds.authorizeTag(ctx, tagID, userID, ActionEdit); err != nil {
+		return nil, err
+	}
+
+	result, err := ds.db.ExecContext(ctx, `UPDATE tags SET name = $2 WHERE id = $1`, tagID, name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("tag %q already exists", name)
+		}
+		return nil, fmt.Errorf("failed to rename tag: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("tag not found")
+	}
+
+	return ds.GetTag(ctx, tagID, userID)
+}
+
+// DeleteTag removes a tag from every document and deletes it
+func (ds *DocumentService) DeleteTag(ctx context.Context, tagID, userID string) (*models.Tag, error) {
+	tag, err := ds.authorizeTag(ctx, tagID, userID, ActionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ds.db.ExecContext(ctx, `DELETE FROM tags WHERE id = $1`, tagID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete tag: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return nil, fmt.Errorf("tag not found")
+	}
+	return tag, nil
+}
+
+// SetDocumentTags replaces the tags of a document. Tags are given by name and
+// created in the document's workspace on first use.
+func (ds *DocumentService) SetDocumentTags(ctx context.Context, docID, userID string, names []string) (*models.Document, error) {
+	doc, err := ds.AuthorizeDocument(ctx, docID, userID, ActionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setDocumentTags(ctx, tx, docID, userID, doc.WorkspaceID, names); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE documents SET version = version + 1 WHERE id = $1`, docID); err != nil {
+		return nil, fmt.Errorf("failed to update document: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ds.GetDocument(ctx, docID, userID)
+}
+
+func setDocumentTags(ctx context.Context, tx *sql.Tx, docID, userID, workspaceID string, names []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_tags WHERE document_id = $1`, docID); err != nil {
+		return fmt.Errorf("failed to clear tags: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, raw := range names {
+		name, err := validateTagName(raw)
+		if err != nil {
+			return err
+		}
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+
+		// Reuse an existing tag regardless of case, or create it
+		var tagID string
+		query := `INSERT INTO tags (id, user_id, workspace_id, name, created_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+			ON CONFLICT (workspace_id, LOWER(name)) DO UPDATE SET name = tags.name
+			RETURNING id`
+		if err := tx.QueryRowContext(ctx, query, uuid.New().String(), userID, workspaceID, name).Scan(&tagID); err != nil {
+			return fmt.Errorf("failed to create tag %q: %w", name, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO document_tags (document_id, tag_id) VALUES ($1, $2)`, docID, tagID); err != nil {
+			return fmt.Errorf("failed to tag document: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// attachTags loads the tag names of the given documents
+func (ds *DocumentService) attachTags(ctx context.Context, documents []*models.Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(documents))
+	byID := make(map[string]*models.Document, len(documents))
+	for i, doc := range documents {
+		ids[i] = doc.ID
+		doc.Tags = []string{}
+		byID[doc.ID] = doc
+	}
+
+	query := `SELECT dt.document_id, t.name FROM document_tags dt JOIN tags t ON t.id = dt.tag_id
+		WHERE dt.document_id = ANY($1) ORDER BY LOWER(t.name)`
+	rows, err := ds.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to query document tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var docID, name string
+		if err := rows.Scan(&docID, &name); err != nil {
+			return fmt.Errorf("failed to scan document tag: %w", err)
+		}
+		if doc := byID[docID]; doc != nil {
+			doc.Tags = append(doc.Tags, name)
+		}
+	}
+
+	return rows.Err()
+}
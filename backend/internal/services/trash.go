@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"strategy-analyst/internal/models"
+)
+
+// Deleted documents are kept in the trash (deleted_at is set) until they are
+// restored or purged. Purging removes the row, which cascades to everything
+// extracted from the document, and queues its storage objects in
+// pending_storage_deletions. The queue is worked off by RunPurger and a
+// failed deletion is retried with backoff until it succeeds, so a storage
+// outage cannot leave orphaned objects behind.
+
+const (
+	// Most queued storage deletions attempted per purger run
+	maxStorageDeletionsPerRun = 500
+	// Longest wait between two attempts to delete the same object
+	maxStorageDeletionBackoff = 6 * time.Hour
+)
+
+// ListTrash returns the deleted documents of a workspace, most recently
+// deleted first
+func (ds *DocumentService) ListTrash(ctx context.Context, userID, workspaceID string) ([]*models.Document, error) {
+	if _, err := ds.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE workspace_id = $1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := ds.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %w", err)
+	}
+	defer rows.Close()
+
+	documents := []*models.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+
+	if err := ds.attachTags(ctx, documents); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+// RestoreDocument moves a document out of the trash. If its folder was
+// deleted in the meantime it comes back at the top level.
+func (ds *DocumentService) RestoreDocument(ctx context.Context, docID, userID string) (*models.Document, error) {
+	if _, err := ds.authorizeDocument(ctx, docID, userID, ActionEdit, true); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE documents SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL`
+	result, err := ds.db.ExecContext(ctx, query, docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore document: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("document not found in trash")
+	}
+
+	return ds.GetDocument(ctx, docID, userID)
+}
+
+// PurgeDocument permanently deletes a document from the trash, which only
+// workspace owners may do, and returns the document as it was
+func (ds *DocumentService) PurgeDocument(ctx context.Context, docID, userID string) (*models.Document, error) {
+	doc, err := ds.authorizeDocument(ctx, docID, userID, ActionManage, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ds.purgeDocument(ctx, docID); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// PurgeExpiredDocuments permanently deletes every document that has been in
+// the trash for longer than retention
+func (ds *DocumentService) PurgeExpiredDocuments(ctx context.Context, retention time.Duration) (int, error) {
+	query := `SELECT id FROM documents WHERE deleted_at < CURRENT_TIMESTAMP - make_interval(secs => $1)`
+	rows, err := ds.db.QueryContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired documents: %w", err)
+	}
+
+	var docIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan document: %w", err)
+		}
+		docIDs = append(docIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read expired documents: %w", err)
+	}
+
+	purged := 0
+	for _, id := range docIDs {
+		ok, err := ds.purgeDocument(ctx, id)
+		if err != nil {
+			fmt.Printf("Failed to purge document %s: %v\n", id, err)
+			continue
+		}
+		if ok {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// purgeDocument deletes a trashed document's row and queues its file and
+// page images for deletion in the same transaction. It reports false if the
+// document was restored or purged concurrently.
+func (ds *DocumentService) purgeDocument(ctx context.Context, docID string) (bool, error) {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sha256Hex, storagePath sql.NullString
+	query := `DELETE FROM documents WHERE id = $1 AND deleted_at IS NOT NULL RETURNING sha256, storage_path`
+	err = tx.QueryRowContext(ctx, query, docID).Scan(&sha256Hex, &storagePath)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	// Blobs are shared by identical uploads and only go once unreferenced
+	if storagePath.Valid {
+		counted := false
+		if sha256Hex.Valid {
+			if counted, err = releaseBlob(ctx, tx, sha256Hex.String, storagePath.String); err != nil {
+				return false, err
+			}
+		}
+		if !counted {
+			if err := queueStorageDeletion(ctx, tx, storagePath.String, false); err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := queueStorageDeletion(ctx, tx, pageImagePrefix(docID), true); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// queueStorageDeletion records that an object, or every object under a
+// prefix, is to be deleted from storage
+func queueStorageDeletion(ctx context.Context, tx *sql.Tx, objectName string, prefix bool) error {
+	query := `INSERT INTO pending_storage_deletions (object_name, is_prefix, created_at, next_attempt_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (object_name) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, objectName, prefix); err != nil {
+		return fmt.Errorf("failed to queue deletion of %s: %w", objectName, err)
+	}
+	return nil
+}
+
+// ProcessStorageDeletions attempts the queued storage deletions that are due.
+// It returns how many were completed; failed ones are rescheduled.
+func (ds *DocumentService) ProcessStorageDeletions(ctx context.Context) (int, error) {
+	if ds.storageService == nil || !ds.storageService.IsInitialized() {
+		return 0, nil
+	}
+
+	deleted := 0
+	for i := 0; i < maxStorageDeletionsPerRun; i++ {
+		done, ok, err := ds.processStorageDeletion(ctx)
+		if err != nil {
+			return deleted, err
+		}
+		if !ok {
+			break
+		}
+		if done {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// processStorageDeletion handles the next due deletion. ok is false when
+// none is due, and done reports whether the deletion completed.
+func (ds *DocumentService) processStorageDeletion(ctx context.Context) (done, ok bool, err error) {
+	tx, err := ds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The row stays locked while storage is called, so a concurrent upload of
+	// the same content waits in acquireBlob until the deletion is settled and
+	// then finds the object gone
+	var objectName string
+	var prefix bool
+	var attempts int
+	query := `SELECT object_name, is_prefix, attempts FROM pending_storage_deletions
+		WHERE next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY next_attempt_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+	err = tx.QueryRowContext(ctx, query).Scan(&objectName, &prefix, &attempts)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to query storage deletions: %w", err)
+	}
+
+	// An object that is referenced again is kept
+	referenced := false
+	if !prefix {
+		query = `SELECT EXISTS (SELECT 1 FROM blobs WHERE storage_path = $1)
+			OR EXISTS (SELECT 1 FROM documents WHERE storage_path = $1)`
+		if err := tx.QueryRowContext(ctx, query, objectName).Scan(&referenced); err != nil {
+			return false, false, fmt.Errorf("failed to check references of %s: %w", objectName, err)
+		}
+	}
+
+	if !referenced {
+		var deleteErr error
+		if prefix {
+			deleteErr = ds.storageService.DeletePrefix(ctx, objectName)
+		} else {
+			deleteErr = ds.storageService.DeleteFile(ctx, objectName)
+		}
+		if deleteErr != nil && !errors.Is(deleteErr, ErrObjectNotFound) {
+			backoff := storageDeletionBackoff(attempts)
+			query = `UPDATE pending_storage_deletions SET attempts = attempts + 1, last_error = $2,
+				next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3) WHERE object_name = $1`
+			if _, err := tx.ExecContext(ctx, query, objectName, deleteErr.Error(), backoff.Seconds()); err != nil {
+				return false, false, fmt.Errorf("failed to reschedule deletion of %s: %w", objectName, err)
+			}
+			if err := tx.Commit(); err != nil {
+				return false, false, fmt.Errorf("failed to commit transaction: %w", err)
+			}
+			fmt.Printf("Deleting %s from storage failed (attempt %d), retrying in %s: %v\n", objectName, attempts+1, backoff, deleteErr)
+			return false, true, nil
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pending_storage_deletions WHERE object_name = $1`, objectName); err != nil {
+		return false, false, fmt.Errorf("failed to complete deletion of %s: %w", objectName, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return !referenced, true, nil
+}
+
+// storageDeletionBackoff is how long to wait after a failed deletion, given
+// the number of earlier attempts: one minute at first, doubling every time up
+// to maxStorageDeletionBackoff
+func storageDeletionBackoff(attempts int) time.Duration {
+	if attempts < 16 && time.Minute<<attempts < maxStorageDeletionBackoff {
+		return time.Minute << attempts
+	}
+	return maxStorageDeletionBackoff
+}
+
+// RunPurger purges documents that have been in the trash for longer than
+// retention and works off the storage deletion queue every interval until
+// ctx is cancelled
+func (ds *DocumentService) RunPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := ds.PurgeExpiredDocuments(ctx, retention)
+			if err != nil {
+				fmt.Printf("Trash purge failed: %v\n", err)
+			} else if purged > 0 {
+				fmt.Printf("Purged %d documents from the trash\n", purged)
+			}
+
+			deleted, err := ds.ProcessStorageDeletions(ctx)
+			if err != nil {
+				fmt.Printf("Storage deletion failed: %v\n", err)
+			} else if deleted > 0 {
+				fmt.Printf("Deleted %d objects from storage\n", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStorageDeletionBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Minute},
+		{attempts: 1, want: 2 * time.Minute},
+		{attempts: 2, want: 4 * time.Minute},
+		{attempts: 8, want: 256 * time.Minute},
+		{attempts: 9, want: maxStorageDeletionBackoff},
+		{attempts: 15, want: maxStorageDeletionBackoff},
+		{attempts: 16, want: maxStorageDeletionBackoff},
+		// Shifting this far would overflow
+		{attempts: 100, want: maxStorageDeletionBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := storageDeletionBackoff(tt.attempts); got != tt.want {
+			t.Errorf("storageDeletionBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrFileTooLarge is returned (wrapped) when an upload exceeds the configured
+// maximum size
+var ErrFileTooLarge = errors.New("file exceeds the maximum upload size")
+
+// sizeLimitedReader fails with ErrFileTooLarge as soon as more than limit
+// bytes have been read, so oversized uploads are aborted mid-stream instead
+// of being silently truncated
+type sizeLimitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+// LimitUpload wraps r so that reading more than limit bytes fails. A limit of
+// zero or less disables the check.
+func LimitUpload(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	// Allow one byte past the limit to tell "exactly at" from "over"
+	return &sizeLimitedReader{reader: r, remaining: limit + 1}
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining <= 0 {
+		return n, ErrFileTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+// Largest part accepted in a single append request. Parts are kept well under
+// the server's read timeout so a flaky connection only loses one part.
+const MaxUploadPartBytes = 16 << 20
+
+// UploadService implements resumable uploads. A client creates a session
+// with the total size, appends parts at byte offsets in any order (re-sending
+// a part replaces it), and completes the session once every byte has been
+// received. Parts are stored as separate objects and concatenated into the
+// final document on completion; only then is CreateDocument called.
+type UploadService struct {
+	db              *sql.DB
+	storageService  *StorageService
+	documentService *DocumentService
+	maxSessionBytes int64
+	sessionTTL      time.Duration
+}
+
+func NewUploadService(db *sql.DB, storageService *StorageService, documentService *DocumentService, maxSessionBytes int64, sessionTTL time.Duration) *UploadService {
+	return &UploadService{
+		db:              db,
+		storageService:  storageService,
+		documentService: documentService,
+		maxSessionBytes: maxSessionBytes,
+		sessionTTL:      sessionTTL,
+	}
+}
+
+func uploadPartsPrefix(sessionID string) string {
+	return fmt.Sprintf("uploads/%s/", sessionID)
+}
+
+// uploadPartObjectName names the object of one attempt at sending a part.
+// Every attempt gets its own object, so a re-sent part that is rejected
+// cannot overwrite the part it was meant to replace.
+func uploadPartObjectName(sessionID string, offset int64) string {
+	return fmt.Sprintf("uploads/%s/part-%d-%s", sessionID, offset, uuid.New().String())
+}
+
+// Parts recorded before each attempt had its own object
+func legacyUploadPartObjectName(sessionID string, offset int64) string {
+	return fmt.Sprintf("uploads/%s/part-%d", sessionID, offset)
+}
+
+// CreateSession starts a resumable upload of a file of the given total size
+// into a workspace. The session itself belongs to the user who created it.
+func (us *UploadService) CreateSession(ctx context.Context, userID, workspaceID, fileName string, size int64) (*models.UploadSession, error) {
+	fileName = strings.TrimSpace(filepath.Base(fileName))
+	if fileName == "" || fileName == "." {
+		return nil, fmt.Errorf("file name is required")
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != ".pdf" && ext != ".txt" {
+		return nil, fmt.Errorf("only PDF and TXT files are supported")
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("size must be positive")
+	}
+	if us.maxSessionBytes > 0 && size > us.maxSessionBytes {
+		return nil, fmt.Errorf("upload session: %w", ErrFileTooLarge)
+	}
+	if _, err := us.documentService.access.Authorize(ctx, userID, workspaceID, ActionEdit); err != nil {
+		return nil, err
+	}
+	// Refuse up front rather than after every chunk has been sent
+	if err := us.documentService.checkUploadQuota(ctx, userID, size, ""); err != nil {
+		return nil, err
+	}
+
+	sessionID := uuid.New().String()
+	query := `INSERT INTO upload_sessions (id, user_id, workspace_id, file_name, total_size, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, $6)`
+	_, err := us.db.ExecContext(ctx, query, sessionID, userID, workspaceID, fileName, size, time.Now().Add(us.sessionTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload session: %w", err)
+	}
+
+	return us.GetSession(ctx, sessionID, userID)
+}
+
+// GetSession returns a session with the byte ranges received so far
+func (us *UploadService) GetSession(ctx context.Context, sessionID, userID string) (*models.UploadSession, error) {
+	session := &models.UploadSession{}
+	query := `SELECT id, workspace_id, file_name, total_size, created_at, expires_at FROM upload_sessions WHERE id = $1 AND user_id = $2`
+	err := us.db.QueryRowContext(ctx, query, sessionID, userID).
+		Scan(&session.ID, &session.WorkspaceID, &session.FileName, &session.Size, &session.CreatedAt, &session.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("upload session not found")
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+
+	parts, err := us.getParts(ctx, us.db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Ranges = mergeRanges(parts)
+	for _, r := range session.Ranges {
+		session.ReceivedBytes += r.End - r.Start
+	}
+
+	return session, nil
+}
+
+type uploadPart struct {
+	Offset     int64
+	Size       int64
+	ObjectName string
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (us *UploadService) getParts(ctx context.Context, q queryer, sessionID string) ([]uploadPart, error) {
+	query := `SELECT byte_offset, size, object_name FROM upload_parts WHERE session_id = $1 ORDER BY byte_offset`
+	rows, err := q.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query upload parts: %w", err)
+	}
+	defer rows.Close()
+
+	var parts []uploadPart
+	for rows.Next() {
+		var part uploadPart
+		var objectName sql.NullString
+		if err := rows.Scan(&part.Offset, &part.Size, &objectName); err != nil {
+			return nil, fmt.Errorf("failed to scan upload part: %w", err)
+		}
+		part.ObjectName = objectName.String
+		if !objectName.Valid {
+			part.ObjectName = legacyUploadPartObjectName(sessionID, part.Offset)
+		}
+		parts = append(parts, part)
+	}
+
+	return parts, rows.Err()
+}
+
+// mergeRanges collapses sorted, non-overlapping parts into contiguous ranges
+func mergeRanges(parts []uploadPart) []models.ByteRange {
+	ranges := []models.ByteRange{}
+	for _, part := range parts {
+		n := len(ranges)
+		if n > 0 && ranges[n-1].End == part.Offset {
+			ranges[n-1].End += part.Size
+			continue
+		}
+		ranges = append(ranges, models.ByteRange{Start: part.Offset, End: part.Offset + part.Size})
+	}
+	return ranges
+}
+
+// AppendPart stores the bytes of content as the part starting at offset.
+// Parts may arrive in any order but must not overlap other parts or run past
+// the declared size.
+func (us *UploadService) AppendPart(ctx context.Context, sessionID, userID string, offset int64, content io.Reader) (*models.UploadSession, error) {
+	if err := CheckScope(ctx, ActionEdit); err != nil {
+		return nil, err
+	}
+	session, err := us.GetSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || offset >= session.Size {
+		return nil, fmt.Errorf("offset %d is outside the upload", offset)
+	}
+
+	limit := min(session.Size-offset, MaxUploadPartBytes)
+	counter := &countingReader{reader: LimitUpload(content, limit)}
+
+	objectName := uploadPartObjectName(sessionID, offset)
+	if err := us.storageService.WriteObject(ctx, objectName, "application/octet-stream", counter); err != nil {
+		us.deletePartObject(ctx, objectName)
+		return nil, fmt.Errorf("failed to store upload part: %w", err)
+	}
+	if counter.n == 0 {
+		us.deletePartObject(ctx, objectName)
+		return nil, fmt.Errorf("upload part is empty")
+	}
+
+	replaced, err := us.recordPart(ctx, sessionID, uploadPart{Offset: offset, Size: counter.n, ObjectName: objectName})
+	if err != nil {
+		// The object is only meaningful once recorded
+		us.deletePartObject(ctx, objectName)
+		return nil, err
+	}
+	if replaced != "" {
+		us.deletePartObject(ctx, replaced)
+	}
+
+	return us.GetSession(ctx, sessionID, userID)
+}
+
+// deletePartObject removes a part object that no row refers to. Failures are
+// only logged: the session's prefix is deleted when it completes or expires.
+func (us *UploadService) deletePartObject(ctx context.Context, objectName string) {
+	if err := us.storageService.DeleteFile(context.WithoutCancel(ctx), objectName); err != nil {
+		fmt.Printf("Warning: failed to delete upload part %s: %v\n", objectName, err)
+	}
+}
+
+// checkPart verifies that part fits between the parts received so far. A
+// part at the offset of an earlier one replaces it, and the earlier part's
+// object name is returned.
+func checkPart(parts []uploadPart, part uploadPart) (string, error) {
+	replaced := ""
+	for _, existing := range parts {
+		if existing.Offset == part.Offset {
+			replaced = existing.ObjectName
+			continue
+		}
+		if part.Offset < existing.Offset+existing.Size && existing.Offset < part.Offset+part.Size {
+			return "", fmt.Errorf("part overlaps bytes %d-%d that were already received", existing.Offset, existing.Offset+existing.Size-1)
+		}
+	}
+	return replaced, nil
+}
+
+// recordPart records a stored part, replacing any part at the same offset,
+// and returns the object name of the replaced part
+func (us *UploadService) recordPart(ctx context.Context, sessionID string, part uploadPart) (replaced string, err error) {
+	tx, err := us.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Lock the session so concurrent appends are checked against each other
+	// and against completion
+	var completing bool
+	err = tx.QueryRowContext(ctx, `SELECT completing FROM upload_sessions WHERE id = $1 FOR UPDATE`, sessionID).Scan(&completing)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("upload session not found")
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to lock upload session: %w", err)
+	}
+	if completing {
+		err = errUploadCompleting
+		return "", err
+	}
+
+	parts, err := us.getParts(ctx, tx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	if replaced, err = checkPart(parts, part); err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO upload_parts (session_id, byte_offset, size, object_name, created_at) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (session_id, byte_offset) DO UPDATE SET size = EXCLUDED.size, object_name = EXCLUDED.object_name, created_at = EXCLUDED.created_at`
+	if _, err = tx.ExecContext(ctx, query, sessionID, part.Offset, part.Size, part.ObjectName); err != nil {
+		return "", fmt.Errorf("failed to record upload part: %w", err)
+	}
+
+	// Activity keeps the session alive
+	if _, err = tx.ExecContext(ctx, `UPDATE upload_sessions SET expires_at = $2 WHERE id = $1`, sessionID, time.Now().Add(us.sessionTTL)); err != nil {
+		return "", fmt.Errorf("failed to extend upload session: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return replaced, nil
+}
+
+// errUploadCompleting is returned when a session is changed while it is
+// being completed or aborted
+var errUploadCompleting = errors.New("upload is already being completed")
+
+// claimSession marks a session as completing so that parts can no longer
+// change and it cannot be completed or aborted twice. The claim outlives a
+// crash only until the session expires.
+func (us *UploadService) claimSession(ctx context.Context, sessionID, userID string) error {
+	query := `UPDATE upload_sessions SET completing = TRUE, expires_at = $3 WHERE id = $1 AND user_id = $2 AND NOT completing`
+	result, err := us.db.ExecContext(ctx, query, sessionID, userID, time.Now().Add(us.sessionTTL))
+	if err != nil {
+		return fmt.Errorf("failed to claim upload session: %w", err)
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return errUploadCompleting
+	}
+	return nil
+}
+
+// releaseSession lets a session whose completion failed take parts and be
+// completed again
+func (us *UploadService) releaseSession(ctx context.Context, sessionID string) {
+	_, err := us.db.ExecContext(context.WithoutCancel(ctx), `UPDATE upload_sessions SET completing = FALSE WHERE id = $1`, sessionID)
+	if err != nil {
+		fmt.Printf("Warning: failed to release upload session %s: %v\n", sessionID, err)
+	}
+}
+
+// CompleteSession assembles the parts into the final file, creates the
+// document from it and removes the session. reuseProcessed is passed on to
+// CreateDocument.
+func (us *UploadService) CompleteSession(ctx context.Context, sessionID, userID string, reuseProcessed bool) (doc *models.Document, err error) {
+	if _, err := us.GetSession(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+	if err := us.claimSession(ctx, sessionID, userID); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			us.releaseSession(ctx, sessionID)
+		}
+	}()
+
+	// The parts cannot change any more
+	session, err := us.GetSession(ctx, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if session.ReceivedBytes != session.Size || len(session.Ranges) != 1 {
+		return nil, fmt.Errorf("upload is incomplete: received %d of %d bytes", session.ReceivedBytes, session.Size)
+	}
+
+	parts, err := us.getParts(ctx, us.db, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &partsReader{
+		ctx:            ctx,
+		storageService: us.storageService,
+		parts:          parts,
+	}
+	defer content.Close()
+
+	doc, err = us.documentService.CreateDocument(ctx, userID, session.WorkspaceID, session.FileName, content, reuseProcessed)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.deleteSession(ctx, sessionID); err != nil {
+		// The janitor retries once the session expires
+		fmt.Printf("Warning: failed to remove completed upload session %s: %v\n", sessionID, err)
+	}
+
+	return doc, nil
+}
+
+// AbortSession discards a session and every part received for it
+func (us *UploadService) AbortSession(ctx context.Context, sessionID, userID string) error {
+	if err := CheckScope(ctx, ActionEdit); err != nil {
+		return err
+	}
+	if _, err := us.GetSession(ctx, sessionID, userID); err != nil {
+		return err
+	}
+	if err := us.claimSession(ctx, sessionID, userID); err != nil {
+		return err
+	}
+	if err := us.deleteSession(ctx, sessionID); err != nil {
+		us.releaseSession(ctx, sessionID)
+		return err
+	}
+	return nil
+}
+
+func (us *UploadService) deleteSession(ctx context.Context, sessionID string) error {
+	if err := us.storageService.DeletePrefix(ctx, uploadPartsPrefix(sessionID)); err != nil {
+		return fmt.Errorf("failed to delete upload parts: %w", err)
+	}
+	if _, err := us.db.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = $1`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+	return nil
+}
+
+// CollectExpiredSessions removes sessions that have seen no activity within
+// the session TTL, together with their parts
+func (us *UploadService) CollectExpiredSessions(ctx context.Context) (int, error) {
+	rows, err := us.db.QueryContext(ctx, `SELECT id FROM upload_sessions WHERE expires_at < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query expired upload sessions: %w", err)
+	}
+
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan upload session: %w", err)
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read expired upload sessions: %w", err)
+	}
+
+	removed := 0
+	for _, id := range sessionIDs {
+		if err := us.deleteSession(ctx, id); err != nil {
+			fmt.Printf("Failed to remove expired upload session %s: %v\n", id, err)
+			continue
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// RunJanitor collects expired sessions every interval until ctx is cancelled
+func (us *UploadService) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := us.CollectExpiredSessions(ctx)
+			if err != nil {
+				fmt.Printf("Upload session cleanup failed: %v\n", err)
+			} else if removed > 0 {
+				fmt.Printf("Removed %d abandoned upload sessions\n", removed)
+			}
+		}
+	}
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// partsReader reads the parts of a session back to back, opening each part
+// only when the previous one is exhausted
+type partsReader struct {
+	ctx            context.Context
+	storageService *StorageService
+	parts          []uploadPart
+	current        io.ReadCloser
+}
+
+func (p *partsReader) Read(buf []byte) (int, error) {
+	for {
+		if p.current == nil {
+			if len(p.parts) == 0 {
+				return 0, io.EOF
+			}
+			reader, err := p.storageService.DownloadFile(p.ctx, p.parts[0].ObjectName)
+			if err != nil {
+				return 0, err
+			}
+			p.current = reader
+			p.parts = p.parts[1:]
+		}
+
+		n, err := p.current.Read(buf)
+		if err == io.EOF {
+			p.current.Close()
+			p.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.current != nil {
+		p.current.Close()
+		p.current = nil
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"strategy-analyst/internal/models"
+)
+
+func TestCheckPart(t *testing.T) {
+	received := []uploadPart{
+		{Offset: 0, Size: 10, ObjectName: "uploads/s/part-0-a"},
+		{Offset: 10, Size: 10, ObjectName: "uploads/s/part-10-b"},
+		{Offset: 30, Size: 5, ObjectName: "uploads/s/part-30-c"},
+	}
+
+	tests := []struct {
+		name         string
+		part         uploadPart
+		wantReplaced string
+		wantErr      string
+	}{
+		{name: "fills a gap", part: uploadPart{Offset: 20, Size: 10}},
+		{name: "re-send of the same size", part: uploadPart{Offset: 10, Size: 10}, wantReplaced: "uploads/s/part-10-b"},
+		{name: "shorter re-send", part: uploadPart{Offset: 0, Size: 4}, wantReplaced: "uploads/s/part-0-a"},
+		{name: "re-send overlapping the next part is rejected", part: uploadPart{Offset: 0, Size: 15}, wantErr: "overlaps bytes 10-19"},
+		{name: "overlaps the end of a part", part: uploadPart{Offset: 5, Size: 3}, wantErr: "overlaps bytes 0-9"},
+		{name: "overlaps the start of a part", part: uploadPart{Offset: 25, Size: 6}, wantErr: "overlaps bytes 30-34"},
+		{name: "covers a part", part: uploadPart{Offset: 20, Size: 20}, wantErr: "overlaps bytes 30-34"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replaced, err := checkPart(received, tt.part)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkPart(%+v) error = %v, want %q", tt.part, err, tt.wantErr)
+				}
+				// A rejected re-send must leave the part it would replace alone
+				if replaced != "" {
+					t.Errorf("checkPart(%+v) replaced %q, want nothing", tt.part, replaced)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkPart(%+v) error = %v", tt.part, err)
+			}
+			if replaced != tt.wantReplaced {
+				t.Errorf("checkPart(%+v) replaced %q, want %q", tt.part, replaced, tt.wantReplaced)
+			}
+		})
+	}
+}
+
+func TestUploadPartObjectNameIsUniquePerAttempt(t *testing.T) {
+	first := uploadPartObjectName("s", 10)
+	second := uploadPartObjectName("s", 10)
+	if first == second {
+		t.Errorf("two attempts at offset 10 share the object %q", first)
+	}
+	for _, name := range []string{first, second} {
+		if !strings.HasPrefix(name, uploadPartsPrefix("s")+"part-10-") {
+			t.Errorf("uploadPartObjectName() = %q, want it under %q", name, uploadPartsPrefix("s"))
+		}
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []uploadPart
+		want  []models.ByteRange
+	}{
+		{name: "no parts", want: []models.ByteRange{}},
+		{name: "one part", parts: []uploadPart{{Offset: 0, Size: 10}}, want: []models.ByteRange{{Start: 0, End: 10}}},
+		{
+			name:  "adjacent parts merge",
+			parts: []uploadPart{{Offset: 0, Size: 10}, {Offset: 10, Size: 5}, {Offset: 15, Size: 1}},
+			want:  []models.ByteRange{{Start: 0, End: 16}},
+		},
+		{
+			name:  "gaps split ranges",
+			parts: []uploadPart{{Offset: 0, Size: 10}, {Offset: 20, Size: 5}, {Offset: 25, Size: 5}, {Offset: 40, Size: 1}},
+			want:  []models.ByteRange{{Start: 0, End: 10}, {Start: 20, End: 30}, {Start: 40, End: 41}},
+		},
+		{
+			name:  "first part missing",
+			parts: []uploadPart{{Offset: 5, Size: 5}, {Offset: 10, Size: 5}},
+			want:  []models.ByteRange{{Start: 5, End: 15}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeRanges(tt.parts); !slices.Equal(got, tt.want) {
+				t.Errorf("mergeRanges() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
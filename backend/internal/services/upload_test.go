@@ -0,0 +1,56 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLimitUpload(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		limit   int64
+		wantErr bool
+	}{
+		{name: "under the limit", size: 9, limit: 10},
+		{name: "at the limit", size: 10, limit: 10},
+		{name: "one byte over the limit", size: 11, limit: 10, wantErr: true},
+		{name: "far over the limit", size: 1000, limit: 10, wantErr: true},
+		{name: "empty", size: 0, limit: 10},
+		{name: "zero disables the limit", size: 1000, limit: 0},
+		{name: "negative disables the limit", size: 1000, limit: -1},
+	}
+
+	for _, tt := range tests {
+		// Small reads must reach the same verdict as large ones
+		readers := map[string]func(io.Reader) io.Reader{
+			"whole":    func(r io.Reader) io.Reader { return r },
+			"one byte": iotest.OneByteReader,
+		}
+		for readerName, wrap := range readers {
+			t.Run(tt.name+"/"+readerName, func(t *testing.T) {
+				content := strings.Repeat("x", tt.size)
+				got, err := io.ReadAll(LimitUpload(wrap(strings.NewReader(content)), tt.limit))
+
+				if tt.wantErr {
+					if !errors.Is(err, ErrFileTooLarge) {
+						t.Fatalf("reading %d bytes with limit %d: error = %v, want ErrFileTooLarge", tt.size, tt.limit, err)
+					}
+					if int64(len(got)) > tt.limit+1 {
+						t.Errorf("read %d bytes before failing, want at most %d", len(got), tt.limit+1)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("reading %d bytes with limit %d: error = %v, want none", tt.size, tt.limit, err)
+				}
+				if string(got) != content {
+					t.Errorf("read %d bytes, want %d", len(got), tt.size)
+				}
+			})
+		}
+	}
+}
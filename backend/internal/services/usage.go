@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"strategy-analyst/internal/models"
+)
+
+// UsageLimits are the per-user quotas; zero means unlimited
+type UsageLimits struct {
+	StorageBytes        int64
+	Documents           int64
+	PagesPerMonth       int64
+	LLMTokensPerMonth   int64
+	ComparisonsPerMonth int64
+}
+
+// QuotaError reports that a user has reached a quota. Monthly quotas carry
+// the time they reset; storage and document quotas only free up when
+// documents are purged.
+type QuotaError struct {
+	Metric   string
+	Used     int64
+	Limit    int64
+	ResetsAt *time.Time
+}
+
+func (e *QuotaError) Error() string {
+	if e.ResetsAt != nil {
+		return fmt.Sprintf("monthly %s quota reached: %d of %d used, resets %s",
+			e.Metric, e.Used, e.Limit, e.ResetsAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s quota exceeded: %d of %d used; purge documents from the trash to free space",
+		e.Metric, e.Used, e.Limit)
+}
+
+type usageOwnerKey struct{}
+
+// WithUsageOwner attributes the LLM calls made with ctx to a user
+func WithUsageOwner(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, usageOwnerKey{}, userID)
+}
+
+func usageOwner(ctx context.Context) string {
+	userID, _ := ctx.Value(usageOwnerKey{}).(string)
+	return userID
+}
+
+// UsageService meters what each user consumes and enforces their quotas.
+// Checks run before work starts, so a call already in flight may take a
+// user slightly past a monthly quota.
+type UsageService struct {
+	db     *sql.DB
+	access *AccessPolicy
+	limits UsageLimits
+	// Prices of LLM calls by model name
+	prices map[string]ModelPrice
+}
+
+func NewUsageService(db *sql.DB, limits UsageLimits, prices map[string]ModelPrice) *UsageService {
+	return &UsageService{db: db, access: NewAccessPolicy(db), limits: limits, prices: prices}
+}
+
+// usagePeriod returns the start of the current month and of the next one
+func usagePeriod(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+type monthlyUsage struct {
+	pages, inputTokens, outputTokens, comparisons int64
+}
+
+func (us *UsageService) monthly(ctx context.Context, userID string) (monthlyUsage, error) {
+	var usage monthlyUsage
+	start, _ := usagePeriod(time.Now())
+	query := `SELECT pages_processed, llm_input_tokens, llm_output_tokens, comparisons
+		FROM usage_counters WHERE user_id = $1 AND period = $2`
+	err := us.db.QueryRowContext(ctx, query, userID, start).
+		Scan(&usage.pages, &usage.inputTokens, &usage.outputTokens, &usage.comparisons)
+	if err != nil && err != sql.ErrNoRows {
+		return usage, fmt.Errorf("failed to get usage: %w", err)
+	}
+	return usage, nil
+}
+
+// stored returns the bytes and number of the user's documents, trash
+// included, since they keep their storage until purged. Identical files are
+// kept once, so their bytes count once however often they were uploaded.
+// The last result reports whether the user already stores content with the
+// given hash.
+func (us *UsageService) stored(ctx context.Context, userID, sha256 string) (int64, int64, bool, error) {
+	var bytes, documents int64
+	var duplicate bool
+	query := `SELECT COALESCE(SUM(size_bytes), 0), COALESCE(SUM(copies), 0), COALESCE(BOOL_OR(sha256 = $2), FALSE)
+		FROM (SELECT MAX(size_bytes) AS size_bytes, COUNT(*) AS copies, MAX(sha256) AS sha256
+			FROM documents WHERE user_id = $1 GROUP BY COALESCE(sha256, id)) contents`
+	if err := us.db.QueryRowContext(ctx, query, userID, sha256).Scan(&bytes, &documents, &duplicate); err != nil {
+		return 0, 0, false, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	return bytes, documents, duplicate, nil
+}
+
+func limitOf(limit int64) *int64 {
+	if limit <= 0 {
+		return nil
+	}
+	return &limit
+}
+
+// GetUsage returns the user's consumption this month against their quotas
+func (us *UsageService) GetUsage(ctx context.Context, userID string) (*models.Usage, error) {
+	monthly, err := us.monthly(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	bytes, documents, _, err := us.stored(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := usagePeriod(time.Now())
+	return &models.Usage{
+		PeriodStart:     start,
+		PeriodEnd:       end,
+		StorageBytes:    models.UsageMetric{Used: bytes, Limit: limitOf(us.limits.StorageBytes)},
+		Documents:       models.UsageMetric{Used: documents, Limit: limitOf(us.limits.Documents)},
+		PagesProcessed:  models.UsageMetric{Used: monthly.pages, Limit: limitOf(us.limits.PagesPerMonth)},
+		LLMInputTokens:  monthly.inputTokens,
+		LLMOutputTokens: monthly.outputTokens,
+		LLMTokens:       models.UsageMetric{Used: monthly.inputTokens + monthly.outputTokens, Limit: limitOf(us.limits.LLMTokensPerMonth)},
+		Comparisons:     models.UsageMetric{Used: monthly.comparisons, Limit: limitOf(us.limits.ComparisonsPerMonth)},
+	}, nil
+}
+
+func monthlyQuotaError(metric string, used, limit int64) *QuotaError {
+	_, resetsAt := usagePeriod(time.Now())
+	return &QuotaError{Metric: metric, Used: used, Limit: limit, ResetsAt: &resetsAt}
+}
+
+// CheckUpload fails with a *QuotaError if storing size more bytes as a new
+// document would exceed the user's storage or document quota, or if their
+// monthly pages are used up. A size of 0 only checks what is used already.
+// Content with a sha256 the user already stores takes no more storage.
+func (us *UsageService) CheckUpload(ctx context.Context, userID string, size int64, sha256 string) error {
+	if us.limits.StorageBytes > 0 || us.limits.Documents > 0 {
+		bytes, documents, duplicate, err := us.stored(ctx, userID, sha256)
+		if err != nil {
+			return err
+		}
+		if limit := us.limits.Documents; limit > 0 && documents >= limit {
+			return &QuotaError{Metric: "documents", Used: documents, Limit: limit}
+		}
+		if limit := us.limits.StorageBytes; limit > 0 && !duplicate && (bytes+size > limit || (size == 0 && bytes >= limit)) {
+			return &QuotaError{Metric: "storage bytes", Used: bytes, Limit: limit}
+		}
+	}
+	return us.CheckPages(ctx, userID)
+}
+
+// CheckPages fails with a *QuotaError once the user's pages processed this
+// month reach the quota
+func (us *UsageService) CheckPages(ctx context.Context, userID string) error {
+	if us.limits.PagesPerMonth <= 0 {
+		return nil
+	}
+	monthly, err := us.monthly(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if monthly.pages >= us.limits.PagesPerMonth {
+		return monthlyQuotaError("pages processed", monthly.pages, us.limits.PagesPerMonth)
+	}
+	return nil
+}
+
+// CheckLLM fails with a *QuotaError once the user's LLM tokens this month
+// reach the quota, and for comparisons also once their comparisons do
+func (us *UsageService) CheckLLM(ctx context.Context, userID string, comparison bool) error {
+	if us.limits.LLMTokensPerMonth <= 0 && (!comparison || us.limits.ComparisonsPerMonth <= 0) {
+		return nil
+	}
+	monthly, err := us.monthly(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if limit := us.limits.ComparisonsPerMonth; comparison && limit > 0 && monthly.comparisons >= limit {
+		return monthlyQuotaError("comparisons", monthly.comparisons, limit)
+	}
+	if tokens, limit := monthly.inputTokens+monthly.outputTokens, us.limits.LLMTokensPerMonth; limit > 0 && tokens >= limit {
+		return monthlyQuotaError("LLM tokens", tokens, limit)
+	}
+	return nil
+}
+
+// record adds to the user's counters for this month
+func (us *UsageService) record(ctx context.Context, userID string, delta monthlyUsage) {
+	if userID == "" {
+		return
+	}
+	start, _ := usagePeriod(time.Now())
+
+	query := `INSERT INTO usage_counters (user_id, period, pages_processed, llm_input_tokens, llm_output_tokens, comparisons)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, period) DO UPDATE SET
+			pages_processed = usage_counters.pages_processed + EXCLUDED.pages_processed,
+			llm_input_tokens = usage_counters.llm_input_tokens + EXCLUDED.llm_input_tokens,
+			llm_output_tokens = usage_counters.llm_output_tokens + EXCLUDED.llm_output_tokens,
+			comparisons = usage_counters.comparisons + EXCLUDED.comparisons`
+	// Usage is recorded after the work is done, even if the client is gone
+	_, err := us.db.ExecContext(context.WithoutCancel(ctx), query, userID, start,
+		delta.pages, delta.inputTokens, delta.outputTokens, delta.comparisons)
+	if err != nil {
+		fmt.Printf("Failed to record usage for user %s: %v\n", userID, err)
+	}
+}
+
+// RecordPages counts pages extracted for the user
+func (us *UsageService) RecordPages(ctx context.Context, userID string, pages int) {
+	if pages > 0 {
+		us.record(ctx, userID, monthlyUsage{pages: int64(pages)})
+	}
+}
+
+// RecordComparison counts a completed comparison for the user
+func (us *UsageService) RecordComparison(ctx context.Context, userID string) {
+	us.record(ctx, userID, monthlyUsage{comparisons: 1})
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsagePeriod(t *testing.T) {
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "middle of the month",
+			now:       time.Date(2026, 3, 15, 12, 30, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "first instant of the month",
+			now:       time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "December rolls over the year",
+			now:       time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC),
+			wantStart: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "months are counted in UTC",
+			now:       time.Date(2026, 4, 1, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			wantStart: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := usagePeriod(tt.now)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("usagePeriod(%v) = %v, %v, want %v, %v", tt.now, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestLimitOf(t *testing.T) {
+	for _, limit := range []int64{0, -1} {
+		if got := limitOf(limit); got != nil {
+			t.Errorf("limitOf(%d) = %d, want nil", limit, *got)
+		}
+	}
+	if got := limitOf(10); got == nil || *got != 10 {
+		t.Errorf("limitOf(10) = %v, want 10", got)
+	}
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"strategy-analyst/internal/models"
+)
+
+const maxWorkspaceNameLength = 255
+
+type WorkspaceService struct {
+	db     *sql.DB
+	access *AccessPolicy
+}
+
+func NewWorkspaceService(db *sql.DB) *WorkspaceService {
+	return &WorkspaceService{db: db, access: NewAccessPolicy(db)}
+}
+
+func validateWorkspaceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("workspace name is required")
+	}
+	if len(name) > maxWorkspaceNameLength {
+		return "", fmt.Errorf("invalid workspace name")
+	}
+	return name, nil
+}
+
+func validateRole(role models.Role) error {
+	if _, ok := roleActions[role]; !ok {
+		return fmt.Errorf("invalid role %q: must be owner, editor or viewer", role)
+	}
+	return nil
+}
+
+// PersonalWorkspace returns the ID of the user's personal workspace, creating
+// it on first use. The user must already exist.
+func (ws *WorkspaceService) PersonalWorkspace(ctx context.Context, userID string) (string, error) {
+	var workspaceID string
+	err := ws.db.QueryRowContext(ctx, `SELECT id FROM workspaces WHERE personal_for = $1`, userID).Scan(&workspaceID)
+	if err == nil {
+		return workspaceID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get personal workspace: %w", err)
+	}
+
+	tx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A concurrent request may create it first; then its ID is returned
+	query := `INSERT INTO workspaces (id, name, personal_for, created_by, created_at, updated_at)
+		VALUES ($1, 'Personal', $2, $2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (personal_for) DO UPDATE SET personal_for = EXCLUDED.personal_for
+		RETURNING id`
+	if err := tx.QueryRowContext(ctx, query, uuid.New().String(), userID).Scan(&workspaceID); err != nil {
+		return "", fmt.Errorf("failed to create personal workspace: %w", err)
+	}
+	query = `INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES ($1, $2, 'owner', CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING`
+	if _, err := tx.ExecContext(ctx, query, workspaceID, userID); err != nil {
+		return "", fmt.Errorf("failed to add workspace owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return workspaceID, nil
+}
+
+// workspaceColumns is the select list understood by scanWorkspace; $1 is the
+// user whose role is reported
+const workspaceColumns = `w.id, w.name, w.personal_for IS NOT NULL, m.role,
+	(SELECT COUNT(*) FROM workspace_members c WHERE c.workspace_id = w.id), w.created_at, w.updated_at`
+
+func scanWorkspace(row rowScanner) (*models.Workspace, error) {
+	workspace := &models.Workspace{}
+	err := row.Scan(&workspace.ID, &workspace.Name, &workspace.Personal, &workspace.Role,
+		&workspace.MemberCount, &workspace.CreatedAt, &workspace.UpdatedAt)
+	return workspace, err
+}
+
+// ListWorkspaces returns the workspaces the user is a member of, personal
+// workspace first
+func (ws *WorkspaceService) ListWorkspaces(ctx context.Context, userID string) ([]*models.Workspace, error) {
+	query := `SELECT ` + workspaceColumns + ` FROM workspaces w
+		JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = $1
+		ORDER BY w.personal_for IS NULL, LOWER(w.name)`
+	rows, err := ws.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []*models.Workspace{}
+	for rows.Next() {
+		workspace, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	return workspaces, rows.Err()
+}
+
+func (ws *WorkspaceService) GetWorkspace(ctx context.Context, workspaceID, userID string) (*models.Workspace, error) {
+	query := `SELECT ` + workspaceColumns + ` FROM workspaces w
+		JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = $1
+		WHERE w.id = $2`
+	workspace, err := scanWorkspace(ws.db.QueryRowContext(ctx, query, userID, workspaceID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("workspace not found")
+		}
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	return workspace, nil
+}
+
+// CreateWorkspace creates a shared workspace owned by the user
+func (ws *WorkspaceService) CreateWorkspace(ctx context.Context, userID, name string) (*models.Workspace, error) {
+	name, err := validateWorkspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckScope(ctx, ActionManage); err != nil {
+		return nil, err
+	}
+
+	tx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	workspaceID := uuid.New().String()
+	query := `INSERT INTO workspaces (id, name, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`
+	if _, err := tx.ExecContext(ctx, query, workspaceID, name, userID); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	query = `INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES ($1, $2, 'owner', CURRENT_TIMESTAMP)`
+	if _, err := tx.ExecContext(ctx, query, workspaceID, userID); err != nil {
+		return nil, fmt.Errorf("failed to add workspace owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return ws.GetWorkspace(ctx, workspaceID, userID)
+}
+
+func (ws *WorkspaceService) RenameWorkspace(ctx context.Context, workspaceID, userID, name string) (*models.Workspace, error) {
+	name, err := validateWorkspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ws.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE workspaces SET name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+	if _, err := ws.db.ExecContext(ctx, query, workspaceID, name); err != nil {
+		return nil, fmt.Errorf("failed to rename workspace: %w", err)
+	}
+
+	return ws.GetWorkspace(ctx, workspaceID, userID)
+}
+
+// DeleteWorkspace deletes an empty shared workspace with its folders, tags
+// and conversations. Documents, including those in the trash, must be moved
+// or purged first so that their files are released properly.
+func (ws *WorkspaceService) DeleteWorkspace(ctx context.Context, workspaceID, userID string) error {
+	workspace, err := ws.GetWorkspace(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := ws.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+		return err
+	}
+	if workspace.Personal {
+		return fmt.Errorf("invalid request: a personal workspace cannot be deleted")
+	}
+
+	var hasDocuments bool
+	if err := ws.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM documents WHERE workspace_id = $1)`, workspaceID).Scan(&hasDocuments); err != nil {
+		return fmt.Errorf("failed to check workspace documents: %w", err)
+	}
+	if hasDocuments {
+		return fmt.Errorf("workspace cannot be deleted while it contains documents, including documents in the trash")
+	}
+
+	if _, err := ws.db.ExecContext(ctx, `DELETE FROM workspaces WHERE id = $1`, workspaceID); err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+	return nil
+}
+
+// GetMembers lists the members of a workspace
+func (ws *WorkspaceService) GetMembers(ctx context.Context, workspaceID, userID string) ([]*models.WorkspaceMember, error) {
+	if _, err := ws.access.Authorize(ctx, userID, workspaceID, ActionView); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT m.user_id, u.email, m.role, m.created_at
+		FROM workspace_members m JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1 ORDER BY m.created_at`
+	rows, err := ws.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []*models.WorkspaceMember{}
+	for rows.Next() {
+		member := &models.WorkspaceMember{}
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// AddMember adds a user to a shared workspace by email. The user must have
+// signed in at least once.
+func (ws *WorkspaceService) AddMember(ctx context.Context, workspaceID, userID string, req models.AddMemberRequest) (*models.WorkspaceMember, error) {
+	if err := validateRole(req.Role); err != nil {
+		return nil, err
+	}
+	workspace, err := ws.GetWorkspace(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ws.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+		return nil, err
+	}
+	if workspace.Personal {
+		return nil, fmt.Errorf("invalid request: a personal workspace cannot be shared")
+	}
+
+	member := &models.WorkspaceMember{Role: req.Role}
+	err = ws.db.QueryRowContext(ctx, `SELECT id, email FROM users WHERE LOWER(email) = LOWER($1)`, strings.TrimSpace(req.Email)).
+		Scan(&member.UserID, &member.Email)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found: they must sign in once before they can be added")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	query := `INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP) RETURNING created_at`
+	if err := ws.db.QueryRowContext(ctx, query, workspaceID, member.UserID, member.Role).Scan(&member.CreatedAt); err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%s is already a member", member.Email)
+		}
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+
+	return member, nil
+}
+
+// UpdateMemberRole changes a member's role; the last owner cannot be demoted
+func (ws *WorkspaceService) UpdateMemberRole(ctx context.Context, workspaceID, userID, memberID string, role models.Role) error {
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	if _, err := ws.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+		return err
+	}
+
+	return ws.changeMember(ctx, workspaceID, memberID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`, workspaceID, memberID, role)
+		return err
+	})
+}
+
+// RemoveMember removes a member from a workspace. Owners can remove anyone and
+// every member can leave; the last owner cannot.
+func (ws *WorkspaceService) RemoveMember(ctx context.Context, workspaceID, userID, memberID string) error {
+	if memberID != userID {
+		if _, err := ws.access.Authorize(ctx, userID, workspaceID, ActionManage); err != nil {
+			return err
+		}
+	} else if err := CheckScope(ctx, ActionManage); err != nil {
+		return err
+	}
+
+	return ws.changeMember(ctx, workspaceID, memberID, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`, workspaceID, memberID)
+		return err
+	})
+}
+
+// changeMember applies change to a membership and fails if it leaves the
+// workspace without an owner. The memberships are locked so that two owners
+// cannot demote each other at the same time.
+func (ws *WorkspaceService) changeMember(ctx context.Context, workspaceID, memberID string, change func(tx *sql.Tx) error) error {
+	tx, err := ws.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM workspace_members WHERE workspace_id = $1 FOR UPDATE`, workspaceID); err != nil {
+		return fmt.Errorf("failed to lock members: %w", err)
+	}
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM workspace_members WHERE workspace_id = $1 AND user_id = $2)`
+	if err := tx.QueryRowContext(ctx, query, workspaceID, memberID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to get member: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("member not found")
+	}
+
+	if err := change(tx); err != nil {
+		return fmt.Errorf("failed to update member: %w", err)
+	}
+
+	var owners int
+	query = `SELECT COUNT(*) FROM workspace_members WHERE workspace_id = $1 AND role = 'owner'`
+	if err := tx.QueryRowContext(ctx, query, workspaceID).Scan(&owners); err != nil {
+		return fmt.Errorf("failed to count owners: %w", err)
+	}
+	if owners == 0 {
+		return fmt.Errorf("invalid request: a workspace needs at least one owner")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
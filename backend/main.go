@@ -18,34 +18,32 @@ import (
 	"strategy-analyst/internal/handlers"
 	"strategy-analyst/internal/middleware"
 	"strategy-analyst/internal/services"
-
-	"firebase.google.com/go/v4/auth"
 )
 
 func main() {
+	// Admin commands run once and exit instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-storage" {
+		os.Exit(reconcileStorageCommand(os.Args[2:]))
+	}
+
 	// Start server immediately to pass health checks
 	log.Println("Starting server...")
 
 	// Load environment configuration
 	cfg := config.Load()
 
-	// Initialize Firebase with error handling
-	var authClient *auth.Client
-	var firebaseHealthy bool
-	firebaseApp, err := config.InitFirebase(cfg.FirebaseCredentialsPath)
+	// Initialize token verification with error handling; without it the API
+	// answers 503 but the rest of the server still starts
+	var authHealthy bool
+	verifier, err := newTokenVerifier(cfg)
 	if err != nil {
-		log.Printf("WARNING: Firebase initialization failed: %v", err)
-		log.Println("Starting server without Firebase authentication")
-		firebaseHealthy = false
+		log.Printf("WARNING: %s authentication initialization failed: %v", cfg.AuthProvider, err)
+		log.Println("Starting server without authentication")
+		verifier = nil
+		authHealthy = false
 	} else {
-		authClient, err = firebaseApp.Auth(context.Background())
-		if err != nil {
-			log.Printf("WARNING: Firebase Auth initialization failed: %v", err)
-			firebaseHealthy = false
-		} else {
-			log.Println("Firebase authentication initialized successfully")
-			firebaseHealthy = true
-		}
+		log.Printf("%s authentication initialized successfully", cfg.AuthProvider)
+		authHealthy = true
 	}
 
 	// Initialize database with error handling
@@ -94,6 +92,12 @@ func main() {
 	var documentService *services.DocumentService
 	var aiService *services.AIService
 	var chatService *services.ChatService
+	var analysisService *services.AnalysisService
+	var uploadService *services.UploadService
+	var workspaceService *services.WorkspaceService
+	var apiKeyService *services.APIKeyService
+	var auditService *services.AuditService
+	var usageService *services.UsageService
 	var storageHealthy, documentHealthy, aiHealthy, chatHealthy bool
 
 	// Initialize storage service
@@ -111,19 +115,24 @@ func main() {
 		storageHealthy = false
 	}
 
-	// Initialize document service
-	if db != nil && storageService != nil && databaseHealthy && storageHealthy {
-		documentService = services.NewDocumentService(db, storageService)
-		log.Println("Document service initialized successfully")
-		documentHealthy = true
-	} else {
-		log.Println("WARNING: Document service not available (missing database or storage)")
-		documentHealthy = false
+	// Usage is metered in the database; without it quotas are not enforced
+	if db != nil && databaseHealthy {
+		prices, err := services.LoadModelPrices(cfg.LLMPricingPath)
+		if err != nil {
+			log.Printf("WARNING: Failed to load LLM prices: %v", err)
+		}
+		usageService = services.NewUsageService(db, services.UsageLimits{
+			StorageBytes:        cfg.QuotaStorageBytes,
+			Documents:           cfg.QuotaDocuments,
+			PagesPerMonth:       cfg.QuotaPagesPerMonth,
+			LLMTokensPerMonth:   cfg.QuotaLLMTokensPerMonth,
+			ComparisonsPerMonth: cfg.QuotaComparisonsPerMonth,
+		}, prices)
 	}
 
 	// Initialize AI service
 	if cfg.GeminiAPIKey != "" {
-		aiService = services.NewAIService(cfg.GeminiAPIKey)
+		aiService = services.NewAIService(cfg.GeminiAPIKey, usageService)
 		log.Println("AI service initialized successfully")
 		aiHealthy = true
 	} else {
@@ -131,9 +140,39 @@ func main() {
 		aiHealthy = false
 	}
 
+	// Summarization fits oversized documents into the model's context window
+	summarizer := services.NewSummarizationService(db, aiService, cfg.ContextCharBudget)
+
+	// Page rendering needs a local poppler install; without it page images are disabled
+	var pageRenderer *services.PageRenderer
+	if storageHealthy {
+		pageRenderer = services.NewPageRenderer(storageService, cfg.PDFRendererPath)
+		if !pageRenderer.IsAvailable() {
+			log.Printf("WARNING: PDF renderer %q not found, page images will not work", cfg.PDFRendererPath)
+			pageRenderer = nil
+		}
+	}
+
+	// Workspaces, memberships, API keys and the audit log only need the database
+	if db != nil && databaseHealthy {
+		workspaceService = services.NewWorkspaceService(db)
+		apiKeyService = services.NewAPIKeyService(db)
+		auditService = services.NewAuditService(db)
+	}
+
+	// Initialize document service (summaries are skipped when AI is unavailable)
+	if db != nil && storageService != nil && databaseHealthy && storageHealthy {
+		documentService = services.NewDocumentService(db, storageService, aiService, summarizer, pageRenderer, usageService)
+		log.Println("Document service initialized successfully")
+		documentHealthy = true
+	} else {
+		log.Println("WARNING: Document service not available (missing database or storage)")
+		documentHealthy = false
+	}
+
 	// Initialize chat service
 	if db != nil && documentService != nil && aiService != nil && databaseHealthy && documentHealthy && aiHealthy {
-		chatService = services.NewChatService(db, documentService, aiService)
+		chatService = services.NewChatService(db, documentService, aiService, summarizer)
 		log.Println("Chat service initialized successfully")
 		chatHealthy = true
 	} else {
@@ -141,8 +180,48 @@ func main() {
 		chatHealthy = false
 	}
 
+	// Initialize analysis service (shares the chat service's dependencies)
+	if chatHealthy {
+		templates, err := services.LoadAnalysisTemplates(cfg.AnalysisTemplatesPath)
+		if err != nil {
+			log.Printf("WARNING: Failed to load custom analysis templates: %v", err)
+		}
+		analysisService = services.NewAnalysisService(db, documentService, aiService, summarizer, templates)
+		log.Printf("Analysis service initialized with %d templates", len(templates))
+	}
+
+	// Initialize resumable uploads (parts live in the same bucket as documents)
+	if documentService != nil {
+		uploadService = services.NewUploadService(db, storageService, documentService, cfg.MaxResumableUploadBytes,
+			time.Duration(cfg.UploadSessionTTLHours)*time.Hour)
+		go uploadService.RunJanitor(context.Background(), time.Hour)
+		log.Println("Upload service initialized successfully")
+	}
+
+	// Purge the trash and retry pending storage deletions in the background
+	trashRetention := time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+	if documentService != nil {
+		go documentService.RunPurger(context.Background(), 10*time.Minute, trashRetention)
+	}
+
+	// Look for orphaned objects and documents whose file is gone
+	if documentService != nil && cfg.StorageReconcileIntervalHours > 0 {
+		go documentService.RunStorageReconciler(context.Background(), time.Duration(cfg.StorageReconcileIntervalHours)*time.Hour, services.ReconcileOptions{
+			GracePeriod:   time.Duration(cfg.StorageOrphanGraceHours) * time.Hour,
+			DeleteOrphans: cfg.StorageReconcileDelete,
+		})
+	}
+
 	// Initialize handlers - always create them but they will handle nil services gracefully
-	h := handlers.New(db, authClient, documentService, chatService)
+	h := handlers.New(db, documentService, chatService, analysisService, uploadService, workspaceService, apiKeyService, auditService, usageService, handlers.Config{
+		DownloadURLTTL:          time.Duration(cfg.SignedURLTTLSeconds) * time.Second,
+		MaxUploadBytes:          cfg.MaxUploadBytes,
+		MaxResumableUploadBytes: cfg.MaxResumableUploadBytes,
+		MaxBatchFiles:           cfg.MaxBatchFiles,
+		MaxArchiveEntries:       cfg.MaxArchiveEntries,
+		MaxArchiveBytes:         cfg.MaxArchiveBytes,
+		TrashRetention:          trashRetention,
+	})
 
 	// Setup routes
 	router := mux.NewRouter()
@@ -166,7 +245,7 @@ func main() {
 		status := map[string]interface{}{
 			"status": "OK",
 			"services": map[string]bool{
-				"firebase": firebaseHealthy,
+				"auth":     authHealthy,
 				"database": databaseHealthy,
 				"storage":  storageHealthy,
 				"document": documentHealthy,
@@ -176,10 +255,10 @@ func main() {
 		}
 
 		// Return 503 only if NO services are working (complete failure)
-		if !firebaseHealthy && !databaseHealthy && !storageHealthy && !aiHealthy {
+		if !authHealthy && !databaseHealthy && !storageHealthy && !aiHealthy {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			status["status"] = "CRITICAL"
-		} else if !firebaseHealthy || !databaseHealthy {
+		} else if !authHealthy || !databaseHealthy {
 			w.WriteHeader(http.StatusOK) // Still return 200 but mark as degraded
 			status["status"] = "DEGRADED"
 		} else {
@@ -189,42 +268,160 @@ func main() {
 		json.NewEncoder(w).Encode(status)
 	}).Methods("GET")
 
-	// Protected routes - only if auth is available
-	if authClient != nil {
-		api := router.PathPrefix("/api").Subrouter()
-		api.Use(middleware.AuthMiddleware(authClient))
-		api.Use(middleware.CORSMiddleware())
-
-		// User routes
-		api.HandleFunc("/user/profile", h.GetUserProfile).Methods("GET")
-
-		// Document routes - only if document service is available
-		if documentService != nil {
-			api.HandleFunc("/documents", h.GetDocuments).Methods("GET")
-			api.HandleFunc("/documents", h.UploadDocument).Methods("POST")
-			api.HandleFunc("/documents/{id}", h.GetDocument).Methods("GET")
-			api.HandleFunc("/documents/{id}", h.DeleteDocument).Methods("DELETE")
-			api.HandleFunc("/documents/{id}/status", h.GetDocumentStatus).Methods("GET")
-			api.HandleFunc("/documents/{id}/reprocess", h.ReprocessDocument).Methods("POST")
-			api.HandleFunc("/documents/compare", h.CompareDocuments).Methods("POST")
+	// Rate limits per caller and route; the Postgres store shares them
+	// between instances. Anonymous callers are limited by address.
+	rateLimits, err := middleware.ParseRateLimits(cfg.RateLimitDefault, cfg.RateLimitRoutes)
+	if err != nil {
+		log.Printf("WARNING: Invalid rate limit configuration, some limits are not enforced: %v", err)
+	}
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	if cfg.RateLimitStore == "postgres" {
+		if db != nil && databaseHealthy {
+			postgresStore := middleware.NewPostgresRateLimitStore(db)
+			go postgresStore.RunJanitor(context.Background(), 10*time.Minute)
+			rateLimitStore = postgresStore
+		} else {
+			log.Println("WARNING: Database unavailable, rate limits are kept in memory")
 		}
+	}
+	rateLimit := middleware.RateLimitMiddleware(rateLimitStore, rateLimits)
 
-		// Chat routes - only if chat service is available
-		if chatService != nil {
-			api.HandleFunc("/documents/{id}/chat", h.GetChatHistory).Methods("GET")
-			api.HandleFunc("/documents/{id}/chat", h.SendMessage).Methods("POST")
-		}
-	} else {
-		log.Println("WARNING: API endpoints not available without authentication")
+	// Client addresses for rate limits and the audit log come from
+	// X-Forwarded-For only when a trusted proxy sent it
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Printf("WARNING: Invalid TRUSTED_PROXIES, X-Forwarded-For is ignored: %v", err)
+	}
+
+	// Public share links work without signing in, so they are registered
+	// outside the authenticated /api subrouter
+	if documentService != nil {
+		router.Handle("/api/public/shares/{token}", middleware.CORSMiddleware()(rateLimit(http.HandlerFunc(h.GetPublicShare)))).Methods("GET")
+	}
+
+	// Protected routes; they answer 503 while authentication is unavailable
+	api := router.PathPrefix("/api").Subrouter()
+	var apiKeys middleware.APIKeyVerifier
+	if apiKeyService != nil {
+		apiKeys = apiKeyService
+	}
+	api.Use(middleware.AuthMiddleware(verifier, apiKeys))
+	api.Use(middleware.CORSMiddleware())
+
+	api.Use(rateLimit)
+
+	// User routes
+	api.HandleFunc("/user/profile", h.GetUserProfile).Methods("GET")
+
+	// Personal API keys
+	if apiKeyService != nil {
+		api.HandleFunc("/api-keys", h.GetAPIKeys).Methods("GET")
+		api.HandleFunc("/api-keys", h.CreateAPIKey).Methods("POST")
+		api.HandleFunc("/api-keys/{id}", h.RevokeAPIKey).Methods("DELETE")
+	}
+
+	// Audit log of the workspace, for its owners
+	if auditService != nil {
+		api.HandleFunc("/audit", h.GetAuditEvents).Methods("GET")
+		api.HandleFunc("/audit/export", h.ExportAuditEvents).Methods("GET")
+	}
+
+	// Usage against quotas, and LLM calls with their cost
+	if usageService != nil {
+		api.HandleFunc("/usage", h.GetUsage).Methods("GET")
+		api.HandleFunc("/usage/llm", h.GetLLMUsageReport).Methods("GET")
+		api.HandleFunc("/usage/llm/calls", h.GetLLMCalls).Methods("GET")
+	}
+
+	// Workspace routes
+	if workspaceService != nil {
+		api.HandleFunc("/workspaces", h.GetWorkspaces).Methods("GET")
+		api.HandleFunc("/workspaces", h.CreateWorkspace).Methods("POST")
+		api.HandleFunc("/workspaces/{id}", h.GetWorkspace).Methods("GET")
+		api.HandleFunc("/workspaces/{id}", h.RenameWorkspace).Methods("PATCH")
+		api.HandleFunc("/workspaces/{id}", h.DeleteWorkspace).Methods("DELETE")
+		api.HandleFunc("/workspaces/{id}/members", h.GetWorkspaceMembers).Methods("GET")
+		api.HandleFunc("/workspaces/{id}/members", h.AddWorkspaceMember).Methods("POST")
+		api.HandleFunc("/workspaces/{id}/members/{userId}", h.UpdateWorkspaceMember).Methods("PATCH")
+		api.HandleFunc("/workspaces/{id}/members/{userId}", h.RemoveWorkspaceMember).Methods("DELETE")
+	}
+
+	// Document routes - only if document service is available
+	if documentService != nil {
+		api.HandleFunc("/documents", h.GetDocuments).Methods("GET")
+		api.HandleFunc("/documents", h.UploadDocument).Methods("POST")
+		api.HandleFunc("/documents/{id}", h.GetDocument).Methods("GET")
+		api.HandleFunc("/documents/{id}", h.UpdateDocument).Methods("PATCH")
+		api.HandleFunc("/documents/{id}", h.DeleteDocument).Methods("DELETE")
+		api.HandleFunc("/documents/{id}/status", h.GetDocumentStatus).Methods("GET")
+		api.HandleFunc("/documents/{id}/reprocess", h.ReprocessDocument).Methods("POST")
+		api.HandleFunc("/documents/compare", h.CompareDocuments).Methods("POST")
+		api.HandleFunc("/documents/{id}/entities", h.GetEntities).Methods("GET")
+		api.HandleFunc("/documents/{id}/metrics", h.GetMetrics).Methods("GET")
+		api.HandleFunc("/documents/{id}/tables", h.GetDocumentTables).Methods("GET")
+		api.HandleFunc("/documents/{id}/tables/{tableId}/csv", h.DownloadTableCSV).Methods("GET")
+		api.HandleFunc("/documents/{id}/pages/{page:[0-9]+}/image", h.GetPageImage).Methods("GET")
+		api.HandleFunc("/documents/{id}/download", h.DownloadDocument).Methods("GET")
+		api.HandleFunc("/entities", h.GetEntities).Methods("GET")
+		api.HandleFunc("/metrics", h.GetMetrics).Methods("GET")
+
+		// Sharing single documents with users and by link
+		api.HandleFunc("/shared", h.GetSharedDocuments).Methods("GET")
+		api.HandleFunc("/documents/{id}/shares", h.GetDocumentShares).Methods("GET")
+		api.HandleFunc("/documents/{id}/shares", h.ShareDocument).Methods("POST")
+		api.HandleFunc("/documents/{id}/shares/{userId}", h.RevokeDocumentShare).Methods("DELETE")
+		api.HandleFunc("/documents/{id}/share-links", h.GetShareLinks).Methods("GET")
+		api.HandleFunc("/documents/{id}/share-links", h.CreateShareLink).Methods("POST")
+		api.HandleFunc("/documents/{id}/share-links/{linkId}", h.RevokeShareLink).Methods("DELETE")
+
+		// Folders, tags and collections
+		api.HandleFunc("/folders", h.GetFolders).Methods("GET")
+		api.HandleFunc("/folders", h.CreateFolder).Methods("POST")
+		api.HandleFunc("/folders/{id}", h.UpdateFolder).Methods("PATCH")
+		api.HandleFunc("/folders/{id}", h.DeleteFolder).Methods("DELETE")
+		api.HandleFunc("/tags", h.GetTags).Methods("GET")
+		api.HandleFunc("/tags", h.CreateTag).Methods("POST")
+		api.HandleFunc("/tags/{id}", h.RenameTag).Methods("PATCH")
+		api.HandleFunc("/tags/{id}", h.DeleteTag).Methods("DELETE")
+		api.HandleFunc("/documents/{id}/folder", h.SetDocumentFolder).Methods("PUT")
+		api.HandleFunc("/documents/{id}/tags", h.SetDocumentTags).Methods("PUT")
+		api.HandleFunc("/trash", h.GetTrash).Methods("GET")
+		api.HandleFunc("/trash/{id}/restore", h.RestoreDocument).Methods("POST")
+		api.HandleFunc("/trash/{id}", h.PurgeDocument).Methods("DELETE")
+
+		// Resumable uploads
+		api.HandleFunc("/uploads", h.CreateUploadSession).Methods("POST")
+		api.HandleFunc("/uploads/{id}", h.GetUploadSession).Methods("GET")
+		api.HandleFunc("/uploads/{id}", h.AbortUploadSession).Methods("DELETE")
+		api.HandleFunc("/uploads/{id}/parts/{offset:[0-9]+}", h.UploadPart).Methods("PUT")
+		api.HandleFunc("/uploads/{id}/complete", h.CompleteUploadSession).Methods("POST")
+	}
+
+	// Chat routes - only if chat service is available
+	if chatService != nil {
+		api.HandleFunc("/documents/{id}/chat", h.GetChatHistory).Methods("GET")
+		api.HandleFunc("/documents/{id}/chat", h.SendMessage).Methods("POST")
+		api.HandleFunc("/collections/chat", h.GetCollectionChatHistory).Methods("GET")
+		api.HandleFunc("/collections/chat", h.SendCollectionMessage).Methods("POST")
+	}
+
+	// Analysis routes - only if analysis service is available
+	if analysisService != nil {
+		api.HandleFunc("/analysis-templates", h.GetAnalysisTemplates).Methods("GET")
+		api.HandleFunc("/documents/{id}/analyses", h.GetAnalyses).Methods("GET")
+		api.HandleFunc("/documents/{id}/analyses", h.CreateAnalysis).Methods("POST")
+		api.HandleFunc("/documents/{id}/analyses/{analysisId}", h.GetAnalysis).Methods("GET")
+		api.HandleFunc("/documents/{id}/analyses/{analysisId}/export", h.ExportAnalysis).Methods("GET")
 	}
 
 	// Setup CORS for all routes
 	corsHandler := gorilla.CORS(
 		gorilla.AllowedOrigins([]string{"http://localhost:3000", "https://assignment-omara.vercel.app"}),
-		gorilla.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		gorilla.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
+		gorilla.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		gorilla.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "If-Match", "X-Workspace-ID", "X-Request-ID"}),
+		gorilla.ExposedHeaders([]string{"ETag", "X-Request-ID", "Retry-After"}),
 		gorilla.AllowCredentials(),
-	)(router)
+	)(middleware.ClientIPMiddleware(trustedProxies)(middleware.RequestIDMiddleware(router)))
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -235,14 +432,14 @@ func main() {
 	server := &http.Server{
 		Addr:         "0.0.0.0:" + port,
 		Handler:      corsHandler,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  handlers.RequestTimeout,
+		WriteTimeout: handlers.RequestTimeout,
 		IdleTimeout:  120 * time.Second,
 	}
 
 	log.Printf("Server starting on port %s", port)
-	log.Printf("Service Status - Firebase: %v, Database: %v, Storage: %v, Document: %v, AI: %v, Chat: %v",
-		firebaseHealthy, databaseHealthy, storageHealthy, documentHealthy, aiHealthy, chatHealthy)
+	log.Printf("Service Status - Auth: %v, Database: %v, Storage: %v, Document: %v, AI: %v, Chat: %v",
+		authHealthy, databaseHealthy, storageHealthy, documentHealthy, aiHealthy, chatHealthy)
 
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"strategy-analyst/internal/config"
+	"strategy-analyst/internal/database"
+	"strategy-analyst/internal/services"
+)
+
+// reconcileStorageCommand compares the bucket with the database once and
+// prints the report as JSON:
+//
+//	strategy-analyst reconcile-storage [-delete] [-grace 24h]
+//
+// With -delete the orphans are queued and deleted right away. It returns the
+// process exit code.
+func reconcileStorageCommand(args []string) int {
+	// Setup logs to stdout; keep it for the report
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+
+	cfg := config.Load()
+
+	flags := flag.NewFlagSet("reconcile-storage", flag.ContinueOnError)
+	deleteOrphans := flags.Bool("delete", false, "delete orphaned objects instead of only reporting them")
+	grace := flags.Duration("grace", time.Duration(cfg.StorageOrphanGraceHours)*time.Hour, "ignore objects updated more recently than this")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if cfg.DatabaseURL == "" || cfg.GCSBucket == "" {
+		fmt.Fprintln(os.Stderr, "DATABASE_URL and GCS_BUCKET are required")
+		return 1
+	}
+
+	db, err := database.Connect(cfg.DatabaseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	storageService := services.NewStorageService(cfg.GCSBucket)
+	if storageService == nil || !storageService.IsInitialized() {
+		fmt.Fprintln(os.Stderr, "GCS storage service failed to initialize")
+		return 1
+	}
+	documentService := services.NewDocumentService(db, storageService, nil, nil, nil, nil)
+
+	ctx := context.Background()
+	report, err := documentService.ReconcileStorage(ctx, services.ReconcileOptions{
+		GracePeriod:   *grace,
+		DeleteOrphans: *deleteOrphans,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *deleteOrphans {
+		deleted, err := documentService.ProcessStorageDeletions(ctx)
+		if err != nil {
+			log.Printf("Deleting orphans failed, the purger will retry: %v", err)
+		} else {
+			log.Printf("Deleted %d objects from storage", deleted)
+		}
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
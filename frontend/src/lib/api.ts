@@ -3,6 +3,13 @@ import { auth } from './firebase'
 const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080'
 
 class ApiClient {
+    // Sent as X-Workspace-ID; the backend uses the personal workspace when unset
+    private workspaceId: string | null = null
+
+    setWorkspace(workspaceId: string | null) {
+        this.workspaceId = workspaceId
+    }
+
     private async getAuthToken(): Promise<string | null> {
         const user = auth.currentUser
         if (!user) return null
@@ -30,6 +37,9 @@ class ApiClient {
         if (token) {
             (headers as Record<string, string>).Authorization = `Bearer ${token}`
         }
+        if (this.workspaceId) {
+            (headers as Record<string, string>)['X-Workspace-ID'] = this.workspaceId
+        }
 
         const response = await fetch(`${API_BASE_URL}${endpoint}`, {
             ...options,
@@ -59,9 +69,122 @@ class ApiClient {
         return this.request('/api/user/profile')
     }
 
+    // API key endpoints
+    async getAPIKeys(): Promise<APIKey[]> {
+        return this.request('/api/api-keys')
+    }
+
+    // The returned key is only shown once
+    async createAPIKey(name: string, scope: APIKeyScope): Promise<APIKey> {
+        return this.request('/api/api-keys', {
+            method: 'POST',
+            body: JSON.stringify({ name, scope }),
+        })
+    }
+
+    async revokeAPIKey(id: string): Promise<void> {
+        return this.request(`/api/api-keys/${id}`, {
+            method: 'DELETE',
+        })
+    }
+
+    // Audit log endpoints (workspace owners only)
+    async getAuditEvents(params: Record<string, string> = {}): Promise<AuditEventPage> {
+        const query = new URLSearchParams(params).toString()
+        return this.request(`/api/audit${query ? `?${query}` : ''}`)
+    }
+
+    // Returns the export file's contents
+    async exportAuditEvents(format: 'csv' | 'jsonl', params: Record<string, string> = {}): Promise<string> {
+        const query = new URLSearchParams({ ...params, format }).toString()
+        return this.request(`/api/audit/export?${query}`)
+    }
+
+    // Usage against the user's quotas
+    async getUsage(): Promise<Usage> {
+        return this.request('/api/usage')
+    }
+
+    // LLM tokens, latency and cost grouped by user, document or day
+    async getLLMUsageReport(groupBy: 'user' | 'document' | 'day' = 'day', params: Record<string, string> = {}): Promise<LLMUsageReport> {
+        const query = new URLSearchParams({ ...params, group_by: groupBy }).toString()
+        return this.request(`/api/usage/llm?${query}`)
+    }
+
+    async getLLMCalls(link: { chat_message_id: string } | { comparison_id: string }): Promise<LLMCall[]> {
+        const query = new URLSearchParams(link).toString()
+        return this.request(`/api/usage/llm/calls?${query}`)
+    }
+
+    // Workspace endpoints
+    async getWorkspaces(): Promise<Workspace[]> {
+        return this.request('/api/workspaces')
+    }
+
+    async createWorkspace(name: string): Promise<Workspace> {
+        return this.request('/api/workspaces', {
+            method: 'POST',
+            body: JSON.stringify({ name }),
+        })
+    }
+
+    async getWorkspace(id: string): Promise<Workspace> {
+        return this.request(`/api/workspaces/${id}`)
+    }
+
+    async renameWorkspace(id: string, name: string): Promise<Workspace> {
+        return this.request(`/api/workspaces/${id}`, {
+            method: 'PATCH',
+            body: JSON.stringify({ name }),
+        })
+    }
+
+    async deleteWorkspace(id: string): Promise<void> {
+        return this.request(`/api/workspaces/${id}`, {
+            method: 'DELETE',
+        })
+    }
+
+    async getWorkspaceMembers(id: string): Promise<WorkspaceMember[]> {
+        return this.request(`/api/workspaces/${id}/members`)
+    }
+
+    async addWorkspaceMember(id: string, email: string, role: WorkspaceRole): Promise<WorkspaceMember> {
+        return this.request(`/api/workspaces/${id}/members`, {
+            method: 'POST',
+            body: JSON.stringify({ email, role }),
+        })
+    }
+
+    async updateWorkspaceMember(id: string, userId: string, role: WorkspaceRole): Promise<void> {
+        return this.request(`/api/workspaces/${id}/members/${userId}`, {
+            method: 'PATCH',
+            body: JSON.stringify({ role }),
+        })
+    }
+
+    async removeWorkspaceMember(id: string, userId: string): Promise<void> {
+        return this.request(`/api/workspaces/${id}/members/${userId}`, {
+            method: 'DELETE',
+        })
+    }
+
     // Document endpoints
+    async getDocumentPage(params: Record<string, string> = {}): Promise<DocumentPage> {
+        const query = new URLSearchParams(params).toString()
+        return this.request(`/api/documents${query ? `?${query}` : ''}`)
+    }
+
+    // Follows next_cursor until every document has been loaded
     async getDocuments(): Promise<Document[]> {
-        return this.request('/api/documents')
+        const documents: Document[] = []
+        let cursor: string | null = null
+        do {
+            const page: DocumentPage = await this.getDocumentPage(cursor ? { limit: '200', cursor } : { limit: '200' })
+            documents.push(...page.documents)
+            cursor = page.next_cursor
+        } while (cursor)
+        return documents
     }
 
     async uploadDocument(file: File): Promise<UploadResponse> {
@@ -70,10 +193,13 @@ class ApiClient {
         const formData = new FormData()
         formData.append('document', file)
 
-        const headers: HeadersInit = {}
+        const headers: Record<string, string> = {}
         if (token) {
             headers.Authorization = `Bearer ${token}`
         }
+        if (this.workspaceId) {
+            headers['X-Workspace-ID'] = this.workspaceId
+        }
 
         const response = await fetch(`${API_BASE_URL}/api/documents`, {
             method: 'POST',
@@ -93,15 +219,99 @@ class ApiClient {
         return this.request(`/api/documents/${id}`)
     }
 
+    // Sends the version the edit is based on; fails with 412 if the document changed since
+    async updateDocument(id: string, version: number, changes: UpdateDocumentRequest): Promise<Document> {
+        return this.request(`/api/documents/${id}`, {
+            method: 'PATCH',
+            headers: { 'If-Match': `"v${version}"` },
+            body: JSON.stringify(changes),
+        })
+    }
+
     async deleteDocument(id: string): Promise<void> {
         return this.request(`/api/documents/${id}`, {
             method: 'DELETE',
         })
     }
 
+    // Sharing endpoints
+    async getSharedDocuments(): Promise<SharedDocument[]> {
+        return this.request('/api/shared')
+    }
+
+    async getDocumentShares(documentId: string): Promise<DocumentShare[]> {
+        return this.request(`/api/documents/${documentId}/shares`)
+    }
+
+    async shareDocument(documentId: string, email: string, permission: SharePermission): Promise<DocumentShare> {
+        return this.request(`/api/documents/${documentId}/shares`, {
+            method: 'POST',
+            body: JSON.stringify({ email, permission }),
+        })
+    }
+
+    async revokeDocumentShare(documentId: string, userId: string): Promise<void> {
+        return this.request(`/api/documents/${documentId}/shares/${userId}`, {
+            method: 'DELETE',
+        })
+    }
+
+    async getShareLinks(documentId: string): Promise<ShareLink[]> {
+        return this.request(`/api/documents/${documentId}/share-links`)
+    }
+
+    // The returned token is only shown once
+    async createShareLink(documentId: string, messageIds: string[] = [], expiresInHours?: number): Promise<ShareLink> {
+        return this.request(`/api/documents/${documentId}/share-links`, {
+            method: 'POST',
+            body: JSON.stringify({ message_ids: messageIds, expires_in_hours: expiresInHours }),
+        })
+    }
+
+    async revokeShareLink(documentId: string, linkId: string): Promise<void> {
+        return this.request(`/api/documents/${documentId}/share-links/${linkId}`, {
+            method: 'DELETE',
+        })
+    }
+
+    // Works without signing in
+    async getPublicShare(token: string): Promise<PublicShare> {
+        return this.request(`/api/public/shares/${token}`)
+    }
+
+    // Trash endpoints
+    async getTrash(): Promise<Document[]> {
+        return this.request('/api/trash')
+    }
+
+    async restoreDocument(id: string): Promise<Document> {
+        return this.request(`/api/trash/${id}/restore`, {
+            method: 'POST',
+        })
+    }
+
+    async purgeDocument(id: string): Promise<void> {
+        return this.request(`/api/trash/${id}`, {
+            method: 'DELETE',
+        })
+    }
+
     // Chat endpoints
+    async getChatHistoryPage(documentId: string, params: Record<string, string> = {}): Promise<ChatHistoryPage> {
+        const query = new URLSearchParams(params).toString()
+        return this.request(`/api/documents/${documentId}/chat${query ? `?${query}` : ''}`)
+    }
+
+    // Follows next_cursor until the whole conversation has been loaded
     async getChatHistory(documentId: string): Promise<ChatMessage[]> {
-        return this.request(`/api/documents/${documentId}/chat`)
+        const messages: ChatMessage[] = []
+        let cursor: string | null = null
+        do {
+            const page: ChatHistoryPage = await this.getChatHistoryPage(documentId, cursor ? { limit: '200', cursor } : { limit: '200' })
+            messages.push(...page.messages)
+            cursor = page.next_cursor
+        } while (cursor)
+        return messages
     }
 
     async sendMessage(documentId: string, message: string): Promise<ChatResponse> {
@@ -142,12 +352,191 @@ export interface UserProfile {
     created_at: string
 }
 
+export type APIKeyScope = 'read_only' | 'chat' | 'full'
+
+export interface APIKey {
+    id: string
+    name: string
+    prefix: string
+    // Only set when the key is created
+    key?: string
+    scope: APIKeyScope
+    created_at: string
+    last_used_at: string | null
+    revoked_at?: string
+}
+
+export interface AuditEvent {
+    id: string
+    occurred_at: string
+    // Null for anonymous share link views
+    actor_id: string | null
+    actor_email: string | null
+    api_key_id?: string
+    workspace_id: string | null
+    action: string
+    target_type: string
+    target_id: string
+    ip: string
+    user_agent: string
+    request_id: string
+    details?: Record<string, string>
+}
+
+export interface AuditEventPage {
+    events: AuditEvent[]
+    next_cursor: string | null
+}
+
+export interface UsageMetric {
+    used: number
+    // Null when unlimited
+    limit: number | null
+}
+
+export interface Usage {
+    period_start: string
+    period_end: string
+    storage_bytes: UsageMetric
+    documents: UsageMetric
+    pages_processed: UsageMetric
+    llm_input_tokens: number
+    llm_output_tokens: number
+    llm_tokens: UsageMetric
+    comparisons: UsageMetric
+}
+
+export interface LLMCall {
+    id: string
+    user_id: string | null
+    workspace_id: string | null
+    document_ids: string[]
+    chat_message_id?: string
+    comparison_id?: string
+    operation: string
+    model: string
+    prompt_tokens: number
+    completion_tokens: number
+    total_tokens: number
+    latency_ms: number
+    // Null when the model has no price
+    cost_usd: number | null
+    created_at: string
+}
+
+export interface LLMUsageRow {
+    key: string
+    calls: number
+    prompt_tokens: number
+    completion_tokens: number
+    total_tokens: number
+    avg_latency_ms: number
+    cost_usd: number
+    unpriced_calls: number
+}
+
+export interface LLMUsageReport {
+    group_by: 'user' | 'document' | 'day'
+    rows: LLMUsageRow[]
+    total: LLMUsageRow
+}
+
+export type WorkspaceRole = 'owner' | 'editor' | 'viewer'
+
+export interface Workspace {
+    id: string
+    name: string
+    personal: boolean
+    role: WorkspaceRole
+    member_count: number
+    created_at: string
+    updated_at: string
+}
+
+export interface WorkspaceMember {
+    user_id: string
+    email: string
+    role: WorkspaceRole
+    created_at: string
+}
+
 export interface Document {
     id: string
     user_id: string
+    workspace_id: string
     file_name: string
     storage_path: string | null
     uploaded_at: string | null
+    display_title: string | null
+    description: string | null
+    custom_metadata: Record<string, string>
+    version: number
+    // Only set for documents in the trash
+    deleted_at?: string
+    purge_at?: string
+}
+
+export type SharePermission = 'view' | 'chat'
+
+export interface SharedDocument extends Document {
+    permission: SharePermission
+    shared_by: string
+    shared_at: string
+}
+
+export interface DocumentShare {
+    document_id: string
+    user_id: string
+    email: string
+    permission: SharePermission
+    shared_by: string
+    created_at: string
+}
+
+export interface ShareLink {
+    id: string
+    document_id: string
+    // Only set when the link is created
+    token?: string
+    message_ids: string[]
+    created_by: string
+    created_at: string
+    expires_at: string
+    revoked_at?: string
+}
+
+export interface DocumentSummary {
+    document_id: string
+    executive_summary: string
+    description: string
+    key_entities: string[]
+    key_figures: { label: string; value: string; context?: string }[]
+    suggested_questions: string[]
+    generated_at: string
+}
+
+export interface PublicShare {
+    title: string
+    file_name: string
+    description: string | null
+    summary: DocumentSummary | null
+    messages: { message_type: 'user' | 'ai'; message_content: string; timestamp: string }[]
+    expires_at: string
+}
+
+export interface UpdateDocumentRequest {
+    display_title?: string | null
+    description?: string | null
+    // An empty value removes the key
+    custom_metadata?: Record<string, string>
+    folder_id?: string | null
+    tags?: string[]
+}
+
+export interface DocumentPage {
+    documents: Document[]
+    next_cursor: string | null
+    total: number
 }
 
 export interface UploadResponse {
@@ -164,7 +553,15 @@ export interface ChatMessage {
     timestamp: string
 }
 
+export interface ChatHistoryPage {
+    messages: ChatMessage[]
+    next_cursor: string | null
+    total: number
+}
+
 export interface ChatResponse {
+    // ID of the stored AI message
+    id: string
     message: string
     timestamp: string
 }
@@ -181,6 +578,8 @@ export interface CompareDocumentsResponse {
 }
 
 export interface DocumentComparison {
+    // Look up the comparison's LLM calls with getLLMCalls
+    id: string
     documents: Document[]
     summary: string
     similarities: string[]